@@ -0,0 +1,327 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// a local user from /etc/passwd and /etc/shadow, the password hash is never included
+type UserAccount struct {
+	Name           string                 `json:"name"`
+	Uid            int                    `json:"uid"`
+	Gid            int                    `json:"gid"`
+	Group          string                 `json:"group"`
+	Groups         []string               `json:"groups"`
+	Gecos          string                 `json:"gecos"`
+	Home           string                 `json:"home"`
+	HomeStat       map[string]interface{} `json:"homeStat"`
+	Shell          string                 `json:"shell"`
+	PasswordStatus string                 `json:"passwordStatus"`
+	HashInPasswd   bool                   `json:"hashInPasswd"`
+	HashAlgorithm  string                 `json:"hashAlgorithm,omitempty"`
+	LastChange     *int                   `json:"lastChange"`
+	MinDays        *int                   `json:"minDays"`
+	MaxDays        *int                   `json:"maxDays"`
+	WarnDays       *int                   `json:"warnDays"`
+	InactiveDays   *int                   `json:"inactiveDays"`
+	ExpireDate     *int                   `json:"expireDate"`
+	Line           int                    `json:"line"`
+}
+
+type GroupAccount struct {
+	Name           string   `json:"name"`
+	Gid            int      `json:"gid"`
+	Members        []string `json:"members"`
+	Administrators []string `json:"administrators"`
+	ShadowMembers  []string `json:"shadowMembers"`
+	PasswordStatus string   `json:"passwordStatus"`
+	Line           int      `json:"line"`
+}
+
+const passwdFile = "/etc/passwd"
+const shadowFile = "/etc/shadow"
+const groupFile = "/etc/group"
+const gshadowFile = "/etc/gshadow"
+
+var loginDefsFiles = []string{"/etc/login.defs", "/usr/etc/login.defs"}
+
+const (
+	passwordEmpty   = "empty"
+	passwordLocked  = "locked"
+	passwordSet     = "set"
+	passwordUnknown = "unknown"
+)
+
+// prefixes of crypt(3) hashes, a hash without prefix is DES
+var hashAlgorithms = []struct {
+	prefix    string
+	algorithm string
+}{
+	{"$1$", "md5"}, {"$2a$", "bcrypt"}, {"$2b$", "bcrypt"}, {"$2x$", "bcrypt"}, {"$2y$", "bcrypt"},
+	{"$5$", "sha256"}, {"$6$", "sha512"}, {"$7$", "scrypt"}, {"$y$", "yescrypt"}, {"$gy$", "gost-yescrypt"},
+	{"$sha1$", "sha1"}, {"$md5", "sun-md5"}, {"_", "bsdi"},
+}
+
+// users of /etc/passwd with the aging fields of /etc/shadow, {hashAlgorithm: true} adds the algorithm of the password hash
+func Users(options map[string]interface{}) ([]interface{}, error) {
+	withAlgorithm, _ := options["hashAlgorithm"].(bool)
+	users, err := readUsers(withAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	return toJavaScriptValue(users).([]interface{}), nil
+}
+
+func Groups() ([]interface{}, error) {
+	groups, err := readGroups()
+	if err != nil {
+		return nil, err
+	}
+	return toJavaScriptValue(groups).([]interface{}), nil
+}
+
+// settings of login.defs, a later line replaces an earlier one
+func LoginDefs() (map[string]interface{}, error) {
+	for _, path := range loginDefsFiles {
+		content, err := ioutil.ReadFile(hostPath(path))
+		if err != nil {
+			continue
+		}
+		saveFileArtefact(hostPath(path), content)
+		return parseLoginDefs(string(content)), nil
+	}
+	return nil, errors.New("login.defs: cannot read " + strings.Join(loginDefsFiles, " or "))
+}
+
+func readUsers(withAlgorithm bool) ([]UserAccount, error) {
+	passwdLines, err := readAccountFile(passwdFile, true)
+	if err != nil {
+		return nil, err
+	}
+	shadowLines, shadowErr := readAccountFile(shadowFile, false)
+	if shadowErr != nil {
+		WriteLog(shadowErr.Error()+", password status and aging are unknown", "WARN")
+	}
+	groups, err := readGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	shadowByName := make(map[string][]string)
+	for _, line := range shadowLines {
+		shadowByName[line.fields[0]] = line.fields
+	}
+	groupNames := make(map[int]string)
+	memberOf := make(map[string][]string)
+	for _, group := range groups {
+		if _, found := groupNames[group.Gid]; !found {
+			groupNames[group.Gid] = group.Name
+		}
+		for _, member := range group.Members {
+			memberOf[member] = append(memberOf[member], group.Name)
+		}
+	}
+
+	users := []UserAccount{}
+	for _, line := range passwdLines {
+		if len(line.fields) < 7 {
+			return nil, errors.New("passwd: " + passwdFile + " line " + fmt.Sprint(line.number) + " has less than 7 fields")
+		}
+		user := UserAccount{Name: line.fields[0], Gecos: line.fields[4], Home: line.fields[5], Shell: line.fields[6], Line: line.number}
+		user.Uid, err = strconv.Atoi(line.fields[2])
+		if err != nil {
+			return nil, errors.New("passwd: " + passwdFile + " line " + fmt.Sprint(line.number) + " has an invalid uid")
+		}
+		user.Gid, _ = strconv.Atoi(line.fields[3])
+		user.Group = groupNames[user.Gid]
+		user.Groups = append([]string{}, memberOf[user.Name]...)
+		sort.Strings(user.Groups)
+		user.HomeStat, _ = Stat(hostPath(user.Home))
+
+		// the hash is only kept in this function
+		hash := line.fields[1]
+		user.HashInPasswd = hash != "x" && hash != "*" && hash != "!" && hash != ""
+		user.PasswordStatus = passwordUnknown
+		if hash != "x" {
+			user.PasswordStatus = passwordStatus(hash)
+		}
+		if shadow, found := shadowByName[user.Name]; found && hash == "x" {
+			hash = shadow[1]
+			user.PasswordStatus = passwordStatus(hash)
+			aging := []**int{&user.LastChange, &user.MinDays, &user.MaxDays, &user.WarnDays, &user.InactiveDays, &user.ExpireDate}
+			for i, field := range aging {
+				if i+2 < len(shadow) {
+					*field = optionalNumber(shadow[i+2])
+				}
+			}
+		}
+		if withAlgorithm && user.PasswordStatus != passwordUnknown {
+			user.HashAlgorithm = hashAlgorithm(hash)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func readGroups() ([]GroupAccount, error) {
+	groupLines, err := readAccountFile(groupFile, true)
+	if err != nil {
+		return nil, err
+	}
+	gshadowLines, _ := readAccountFile(gshadowFile, false)
+	gshadowByName := make(map[string][]string)
+	for _, line := range gshadowLines {
+		gshadowByName[line.fields[0]] = line.fields
+	}
+
+	groups := []GroupAccount{}
+	for _, line := range groupLines {
+		if len(line.fields) < 4 {
+			return nil, errors.New("group: " + groupFile + " line " + fmt.Sprint(line.number) + " has less than 4 fields")
+		}
+		group := GroupAccount{Name: line.fields[0], Members: splitAccountList(line.fields[3]), Administrators: []string{}, ShadowMembers: []string{}, PasswordStatus: passwordUnknown, Line: line.number}
+		group.Gid, err = strconv.Atoi(line.fields[2])
+		if err != nil {
+			return nil, errors.New("group: " + groupFile + " line " + fmt.Sprint(line.number) + " has an invalid gid")
+		}
+		if gshadow, found := gshadowByName[group.Name]; found && len(gshadow) >= 4 {
+			group.PasswordStatus = passwordStatus(gshadow[1])
+			group.Administrators = splitAccountList(gshadow[2])
+			group.ShadowMembers = splitAccountList(gshadow[3])
+		} else if line.fields[1] != "x" {
+			group.PasswordStatus = passwordStatus(line.fields[1])
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+type accountLine struct {
+	fields []string
+	number int
+}
+
+// shadow files are never saved as artefact, they contain the password hashes
+func readAccountFile(path string, saveArtefact bool) ([]accountLine, error) {
+	content, err := ioutil.ReadFile(hostPath(path))
+	if err != nil {
+		return nil, errors.New("cannot read " + path)
+	}
+	if saveArtefact {
+		saveFileArtefact(hostPath(path), []byte(redactAccountHashes(string(content))))
+	}
+
+	var lines []accountLine
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimRight(line, "\r")
+		// NIS entries like "+@admins" are not local accounts
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-") {
+			continue
+		}
+		lines = append(lines, accountLine{fields: strings.Split(line, ":"), number: i + 1})
+	}
+	return lines, nil
+}
+
+// the artefact keeps "x", an empty field and the lock of a password, a hash becomes "*"
+func redactAccountHashes(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		fields := strings.Split(line, ":")
+		if strings.HasPrefix(line, "#") || len(fields) < 2 {
+			continue
+		}
+		lock := fields[1][:len(fields[1])-len(strings.TrimLeft(fields[1], "!"))]
+		if hash := strings.TrimLeft(fields[1], "!"); hash != "" && hash != "x" && hash != "*" {
+			fields[1] = lock + "*"
+			lines[i] = strings.Join(fields, ":")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// "!" and "*" in front of a hash lock the password
+func passwordStatus(hash string) string {
+	switch {
+	case hash == "":
+		return passwordEmpty
+	case strings.HasPrefix(hash, "!") || strings.HasPrefix(hash, "*"):
+		return passwordLocked
+	default:
+		return passwordSet
+	}
+}
+
+// algorithm of a crypt(3) hash, also of a locked one, "" if there is no hash
+func hashAlgorithm(hash string) string {
+	hash = strings.TrimLeft(hash, "!*")
+	if hash == "" {
+		return ""
+	}
+	for _, known := range hashAlgorithms {
+		if strings.HasPrefix(hash, known.prefix) {
+			return known.algorithm
+		}
+	}
+	if len(hash) == 13 {
+		return "des"
+	}
+	return "unknown"
+}
+
+func optionalNumber(field string) *int {
+	number, err := strconv.Atoi(strings.TrimSpace(field))
+	if err != nil {
+		return nil
+	}
+	return &number
+}
+
+func splitAccountList(field string) []string {
+	if strings.TrimSpace(field) == "" {
+		return []string{}
+	}
+	return strings.Split(field, ",")
+}
+
+// "PASS_MAX_DAYS	90", quotes around values are removed
+func parseLoginDefs(content string) map[string]interface{} {
+	settings := make(map[string]interface{})
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		value := ""
+		if len(fields) > 1 {
+			value = strings.Trim(strings.Join(fields[1:], " "), "\"")
+		}
+		settings[fields[0]] = value
+	}
+	return settings
+}
@@ -98,7 +98,7 @@ func saveAuditFileFromCommand(small SmallAudit) error {
 		return err //errors.New("can't save Artefact")
 	}
 
-	artefact, err := execCommand[0].Output()
+	artefact, err := runTrackedCommand(execCommand[0], false)
 	if err != nil {
 		return err //errors.New("exit status 1, empty bytes")
 	}
@@ -117,9 +117,7 @@ func saveAuditFileFromCommand(small SmallAudit) error {
 // can be called from Windows or Linux to save artefact, must be called with the first smallAudit
 func saveArtefact(audit SmallAudit) {
 	if audit.Filepath != "" {
-		s := strings.Split(audit.Filepath, "\\")
-		fileEnd := s[len(s)-1]
-		_, err := copyArtefact(audit.Filepath, "./output/artefacts/"+fileEnd)
+		_, err := copyArtefact(audit.Filepath, artefactPath(audit))
 
 		if err != nil {
 			if debugModeEnabled {
@@ -145,3 +143,13 @@ func saveArtefact(audit SmallAudit) {
 		}
 	}
 }
+
+// location of the artefact saveArtefact writes for the first smallAudit
+func artefactPath(audit SmallAudit) string {
+	if audit.Filepath != "" {
+		s := strings.Split(audit.Filepath, "\\")
+		fileEnd := s[len(s)-1]
+		return "./output/artefacts/" + fileEnd
+	}
+	return "./output/artefacts/" + audit.Name + ".txt"
+}
@@ -0,0 +1,422 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// audit rule with the parts that change its meaning normalised, keys are kept but never compared
+type AuditRule struct {
+	Type        string   `json:"type"`
+	List        string   `json:"list,omitempty"`
+	Action      string   `json:"action,omitempty"`
+	Arch        string   `json:"arch,omitempty"`
+	Syscalls    []string `json:"syscalls"`
+	Fields      []string `json:"fields"`
+	Path        string   `json:"path,omitempty"`
+	Permissions string   `json:"permissions,omitempty"`
+	Option      string   `json:"option,omitempty"`
+	Value       string   `json:"value,omitempty"`
+	Keys        []string `json:"keys"`
+	Text        string   `json:"text"`
+	File        string   `json:"file,omitempty"`
+	Line        int      `json:"line,omitempty"`
+}
+
+const (
+	auditRulesDirectory = "/etc/audit/rules.d"
+	auditRulesFile      = "/etc/audit/audit.rules"
+	auditctlListCommand = "auditctl -l"
+)
+
+// options of auditctl that configure the audit system instead of adding a rule
+var auditControlOptions = map[string]bool{"-b": true, "-e": true, "-f": true, "-r": true, "-D": true, "-i": true, "-c": true, "--backlog_wait_time": true, "--loginuid-immutable": true, "--reset-lost": true}
+
+var auditArchAliases = map[string]string{"x86_64": "b64", "aarch64": "b64", "ppc64": "b64", "ppc64le": "b64", "s390x": "b64", "i386": "b32", "i686": "b32", "arm": "b32"}
+
+var auditFieldRegex = regexp.MustCompile(`^([A-Za-z0-9_]+)(!=|>=|<=|&=|=|<|>|&)(.*)$`)
+
+// rules of /etc/audit/rules.d (or audit.rules) like augenrules merges them, "loaded" reads the running rules of "auditctl -l"
+func AuditRules(source string) ([]interface{}, error) {
+	rules, err := readAuditRules(source)
+	if err != nil {
+		return nil, err
+	}
+	return toJavaScriptValue(rules).([]interface{}), nil
+}
+
+// fails the check if a required rule is not covered, returns the required rules that are missing
+func AssertAuditRules(required interface{}, source string) ([]interface{}, error) {
+	var requiredTexts []string
+	content, _ := json.Marshal(required)
+	if err := json.Unmarshal(content, &requiredTexts); err != nil {
+		return nil, errors.New("audit: the required rules must be an array of strings")
+	}
+	rules, err := readAuditRules(source)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []string{}
+	for i, text := range requiredTexts {
+		requiredRule, err := parseAuditRule(text)
+		if err != nil {
+			return nil, errors.New("audit: required rule " + strconv.Itoa(i+1) + ": " + err.Error())
+		}
+		if requiredRule.Type == "" || !isAuditRuleCovered(requiredRule, rules) {
+			missing = append(missing, text)
+		}
+	}
+	if len(missing) == 0 {
+		setCheckStatus(resultPassed, "all required audit rules are set", nil)
+	} else {
+		setCheckStatus(resultFailed, "missing audit rules: "+strings.Join(missing, ", "), toJavaScriptValue(missing))
+	}
+	return toJavaScriptValue(missing).([]interface{}), nil
+}
+
+func readAuditRules(source string) ([]AuditRule, error) {
+	switch source {
+	case "", "persisted":
+		return readPersistedAuditRules()
+	case "loaded":
+		return readLoadedAuditRules()
+	}
+	return nil, errors.New("audit: unknown source " + source + ", use persisted or loaded")
+}
+
+// augenrules merges the *.rules files sorted by name into audit.rules
+func readPersistedAuditRules() ([]AuditRule, error) {
+	files, _ := filepath.Glob(filepath.Join(hostPath(auditRulesDirectory), "*.rules"))
+	sort.Strings(files)
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, filepath.Join(auditRulesDirectory, filepath.Base(file)))
+	}
+	if len(paths) == 0 {
+		paths = []string{auditRulesFile}
+	}
+
+	rules := []AuditRule{}
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(hostPath(path))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.New("audit: cannot read " + path)
+		}
+		saveFileArtefact(hostPath(path), content)
+		found, err := parseAuditRules(string(content), path)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, found...)
+	}
+	return rules, nil
+}
+
+// the output of the command is saved as artefact like the one of call()
+func readLoadedAuditRules() ([]AuditRule, error) {
+	previousOutput := output
+	defer func() { output = previousOutput }()
+	if err := Call(auditctlListCommand); err != nil {
+		return nil, errors.New("audit: cannot list the loaded rules: " + err.Error())
+	}
+	// auditctl prints "No rules" if there are none, no output means it did not run
+	switch strings.TrimSpace(output) {
+	case "":
+		return nil, errors.New("audit: auditctl -l returned no output")
+	case "No rules":
+		return []AuditRule{}, nil
+	}
+	return parseAuditRules(output, "")
+}
+
+func parseAuditRules(content string, path string) ([]AuditRule, error) {
+	rules := []AuditRule{}
+	for number, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseAuditRule(line)
+		if err != nil {
+			return nil, errors.New("audit: " + path + " line " + strconv.Itoa(number+1) + ": " + err.Error())
+		}
+		if rule.Type == "" {
+			continue
+		}
+		rule.File = path
+		rule.Line = number + 1
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// one line of auditctl syntax, deleting rules (-d, -W) has no type and is skipped
+func parseAuditRule(text string) (AuditRule, error) {
+	rule := AuditRule{Syscalls: []string{}, Fields: []string{}, Keys: []string{}, Text: text}
+	arguments := strings.Fields(text)
+	if len(arguments) == 0 {
+		return rule, errors.New("empty rule")
+	}
+	if auditControlOptions[arguments[0]] {
+		rule.Type = "control"
+		rule.Option = arguments[0]
+		rule.Value = strings.Join(arguments[1:], " ")
+		return rule, nil
+	}
+
+	for i := 0; i < len(arguments); i++ {
+		option := arguments[i]
+		if option == "-d" || option == "-W" {
+			return AuditRule{}, nil
+		}
+		if i+1 >= len(arguments) {
+			return rule, errors.New("missing value for " + option)
+		}
+		i++
+		value := arguments[i]
+		switch option {
+		case "-a", "-A":
+			rule.Type = "syscall"
+			if err := setAuditListAction(&rule, value); err != nil {
+				return rule, err
+			}
+		case "-w":
+			rule.Type = "watch"
+			rule.Path = value
+		case "-p":
+			rule.Permissions = value
+		case "-S":
+			rule.Syscalls = append(rule.Syscalls, strings.Split(value, ",")...)
+		case "-k":
+			rule.Keys = append(rule.Keys, value)
+		case "-F", "-C":
+			if err := addAuditField(&rule, value, option == "-C"); err != nil {
+				return rule, err
+			}
+		default:
+			return rule, errors.New("unknown option " + option)
+		}
+	}
+	if rule.Type == "" {
+		return rule, errors.New("rule has neither -a nor -w")
+	}
+	normaliseAuditRule(&rule)
+	return rule, nil
+}
+
+// "always,exit" and "exit,always" are the same
+func setAuditListAction(rule *AuditRule, value string) error {
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return errors.New("invalid list and action " + value)
+	}
+	for _, part := range parts {
+		switch part {
+		case "always", "never":
+			rule.Action = part
+		default:
+			rule.List = part
+		}
+	}
+	if rule.Action == "" || rule.List == "" {
+		return errors.New("invalid list and action " + value)
+	}
+	return nil
+}
+
+// unset ids are written as -1, 4294967295 or unset, "-C uid!=euid" is the same as "-C euid!=uid"
+func addAuditField(rule *AuditRule, value string, comparison bool) error {
+	match := auditFieldRegex.FindStringSubmatch(value)
+	if match == nil {
+		return errors.New("invalid field " + value)
+	}
+	name, operator, fieldValue := match[1], match[2], match[3]
+	switch {
+	case comparison:
+		if (operator == "=" || operator == "!=") && fieldValue < name {
+			name, fieldValue = fieldValue, name
+		}
+	case name == "key":
+		rule.Keys = append(rule.Keys, fieldValue)
+		return nil
+	case name == "arch":
+		rule.Arch = fieldValue
+		if alias, found := auditArchAliases[fieldValue]; found {
+			rule.Arch = alias
+		}
+		return nil
+	case strings.HasSuffix(name, "uid") || strings.HasSuffix(name, "gid"):
+		if fieldValue == "-1" || fieldValue == "4294967295" {
+			fieldValue = "unset"
+		}
+	case name == "perm":
+		fieldValue = sortedPermissions(fieldValue)
+	}
+	rule.Fields = append(rule.Fields, name+operator+fieldValue)
+	return nil
+}
+
+// a syscall rule that only sets path or dir and perm is written as watch by auditctl
+func normaliseAuditRule(rule *AuditRule) {
+	if rule.Type == "syscall" && rule.List == "exit" && rule.Action == "always" && len(rule.Syscalls) == 0 && rule.Arch == "" {
+		path, permissions, others := "", "", 0
+		for _, field := range rule.Fields {
+			switch {
+			case strings.HasPrefix(field, "path="), strings.HasPrefix(field, "dir="):
+				path = field[strings.Index(field, "=")+1:]
+			case strings.HasPrefix(field, "perm="):
+				permissions = strings.TrimPrefix(field, "perm=")
+			default:
+				others++
+			}
+		}
+		if path != "" && others == 0 {
+			rule.Type = "watch"
+			rule.List, rule.Action = "", ""
+			rule.Path = path
+			rule.Permissions = permissions
+			rule.Fields = []string{}
+		}
+	}
+	if rule.Type == "watch" {
+		if rule.Permissions == "" {
+			rule.Permissions = "rwxa"
+		}
+		rule.Permissions = sortedPermissions(rule.Permissions)
+		if rule.Path != "/" {
+			rule.Path = strings.TrimSuffix(rule.Path, "/")
+		}
+	}
+	if len(rule.Syscalls) == 0 && rule.Type == "syscall" && rule.List == "exit" {
+		rule.Syscalls = []string{"all"}
+	}
+	sort.Strings(rule.Syscalls)
+	rule.Syscalls = uniqueStrings(rule.Syscalls)
+	sort.Strings(rule.Fields)
+}
+
+// permissions in the order auditctl uses (r, w, x, a)
+func sortedPermissions(permissions string) string {
+	sorted := ""
+	for _, permission := range "rwxa" {
+		if strings.ContainsRune(permissions, permission) {
+			sorted += string(permission)
+		}
+	}
+	return sorted
+}
+
+func uniqueStrings(sorted []string) []string {
+	unique := []string{}
+	for i, value := range sorted {
+		if i == 0 || value != sorted[i-1] {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// a requirement can be covered by several rules together (e.g. syscalls split across rules),
+// a rule only counts if it has no filter the requirement does not have
+func isAuditRuleCovered(required AuditRule, rules []AuditRule) bool {
+	covered := make(map[string]bool)
+	matched := false
+	for _, rule := range rules {
+		if rule.Type != required.Type {
+			continue
+		}
+		switch rule.Type {
+		case "control":
+			if rule.Option == required.Option && rule.Value == required.Value {
+				return true
+			}
+		case "watch":
+			if rule.Path == required.Path || strings.HasPrefix(required.Path, strings.TrimSuffix(rule.Path, "/")+"/") {
+				matched = true
+				for _, permission := range rule.Permissions {
+					covered[string(permission)] = true
+				}
+			}
+		case "syscall":
+			if rule.List != required.List || rule.Action != required.Action || (rule.Arch != "" && rule.Arch != required.Arch) || !containsAllStrings(required.Fields, rule.Fields) {
+				continue
+			}
+			matched = true
+			for _, syscall := range rule.Syscalls {
+				covered[syscall] = true
+			}
+		}
+	}
+
+	if !matched {
+		return false
+	}
+	switch required.Type {
+	case "watch":
+		for _, permission := range required.Permissions {
+			if !covered[string(permission)] {
+				return false
+			}
+		}
+		return true
+	case "syscall":
+		if covered["all"] {
+			return true
+		}
+		for _, syscall := range required.Syscalls {
+			if !covered[syscall] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func containsAllStrings(values []string, subset []string) bool {
+	for _, wanted := range subset {
+		found := false
+		for _, value := range values {
+			if value == wanted {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,285 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+type BinaryPin struct {
+	Command string `json:"command"`
+	Path    string `json:"path"`
+	Sha256  string `json:"sha256"`
+	Package bool   `json:"package"`
+}
+
+type BinaryPins struct {
+	Pins []BinaryPin `json:"pins"`
+}
+
+type PinnedBinary struct {
+	Command      string `json:"Command"`
+	Path         string `json:"Path"`
+	ResolvedPath string `json:"Resolved Path"`
+	Sha256       string `json:"SHA-256"`
+	VerifiedBy   string `json:"Verified by,omitempty"`
+	ErrorMessage string `json:"Error-Message,omitempty"`
+}
+
+const binaryVerificationFailed = "binary verification failed: "
+
+var binaryPins map[string]BinaryPin
+var dpkgInfoDir string
+var rpmBinary string
+
+func init() {
+	binaryPins = make(map[string]BinaryPin)
+	dpkgInfoDir = "/var/lib/dpkg/info"
+	rpmBinary = "/usr/bin/rpm"
+}
+
+// reads the pin file given through -pin, verifies every binary and records it in the run metadata
+func loadBinaryPins(path string) error {
+	byteValue, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var pins BinaryPins
+	if !checkJsonFormat(byteValue, &pins) {
+		return errors.New("JSON format of pin file " + path + " incorrect")
+	}
+
+	for i, pin := range pins.Pins {
+		issue := "Issue at the " + getOrdinalNum(i+1) + " pin in " + path + "."
+		if pin.Command == "" {
+			return errors.New(issue + " You have to specify the command")
+		}
+		if !isSupportedCommand(pin.Command) {
+			return errors.New(issue + " " + pin.Command + " is not a supported command")
+		}
+		if !filepath.IsAbs(pin.Path) {
+			return errors.New(issue + " The path of " + pin.Command + " has to be absolute")
+		}
+		if pin.Sha256 == "" && !pin.Package {
+			return errors.New(issue + " You have to specify a sha256 or package verification for " + pin.Command)
+		}
+		binaryPins[strings.ToLower(pin.Command)] = pin
+
+		pinned, verifyErr := verifyBinaryPin(pin)
+		if verifyErr != nil {
+			pinned.ErrorMessage = verifyErr.Error()
+			WriteErrorLog(binaryVerificationFailed+verifyErr.Error(), "")
+		} else {
+			WriteLog(pin.Command+" pinned to "+pinned.ResolvedPath+" ("+pinned.VerifiedBy+")", "INFO")
+		}
+		runMetadata.PinnedBinaries = append(runMetadata.PinnedBinaries, pinned)
+	}
+
+	if debugModeEnabled {
+		WriteDebugLog("pin file "+path+" loaded", "INFO")
+	}
+	return nil
+}
+
+func isSupportedCommand(command string) bool {
+	for _, supportedCommand := range SupportedCommands {
+		if strings.EqualFold(command, supportedCommand) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the path to execute for a command, unpinned commands are resolved through $PATH
+func pinnedCommandPath(command string) (string, error) {
+	pin, ok := binaryPins[strings.ToLower(command)]
+	if !ok {
+		return command, nil
+	}
+	// verify again, the binary could have changed since the start of the audit
+	pinned, err := verifyBinaryPin(pin)
+	if err != nil {
+		return "", errors.New(binaryVerificationFailed + err.Error())
+	}
+	if runtime.GOOS == "windows" {
+		return "& '" + pinned.ResolvedPath + "'", nil
+	}
+	return "'" + pinned.ResolvedPath + "'", nil
+}
+
+func verifyBinaryPin(pin BinaryPin) (PinnedBinary, error) {
+	pinned := PinnedBinary{Command: pin.Command, Path: pin.Path}
+
+	resolvedPath, err := filepath.EvalSymlinks(pin.Path)
+	if err != nil {
+		return pinned, errors.New(pin.Command + ": " + err.Error())
+	}
+	pinned.ResolvedPath = resolvedPath
+
+	fileInfo, err := os.Stat(resolvedPath)
+	if err != nil {
+		return pinned, errors.New(pin.Command + ": " + err.Error())
+	}
+	if !fileInfo.Mode().IsRegular() {
+		return pinned, errors.New(pin.Command + ": " + resolvedPath + " is not a regular file")
+	}
+
+	pinned.Sha256, err = fileChecksum(resolvedPath, sha256.New())
+	if err != nil {
+		return pinned, errors.New(pin.Command + ": " + err.Error())
+	}
+
+	var verifiedBy []string
+	if pin.Sha256 != "" {
+		if !strings.EqualFold(pin.Sha256, pinned.Sha256) {
+			return pinned, errors.New(pin.Command + ": SHA-256 of " + resolvedPath + " does not match")
+		}
+		verifiedBy = append(verifiedBy, "SHA-256")
+	}
+	if pin.Package {
+		owner, packageErr := verifyPackageOwnedFile(pin.Path, resolvedPath)
+		if packageErr != nil {
+			return pinned, errors.New(pin.Command + ": " + packageErr.Error())
+		}
+		verifiedBy = append(verifiedBy, "package "+owner)
+	}
+	pinned.VerifiedBy = strings.Join(verifiedBy, ", ")
+	return pinned, nil
+}
+
+func fileChecksum(path string, hasher hash.Hash) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err = io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// checks the file against the checksums of the package manager that installed it
+func verifyPackageOwnedFile(path string, resolvedPath string) (string, error) {
+	if checkPathExists(dpkgInfoDir) {
+		return verifyDpkgOwnedFile(path, resolvedPath)
+	}
+	if checkPathExists(rpmBinary) {
+		return verifyRpmOwnedFile(resolvedPath)
+	}
+	return "", errors.New("no supported package database found")
+}
+
+// dpkg lists files in <package>.md5sums, merged /usr systems may list /bin instead of /usr/bin
+func verifyDpkgOwnedFile(path string, resolvedPath string) (string, error) {
+	candidates := packagePathCandidates(path, resolvedPath)
+
+	md5sumFiles, err := filepath.Glob(filepath.Join(dpkgInfoDir, "*.md5sums"))
+	if err != nil {
+		return "", err
+	}
+	for _, md5sumFile := range md5sumFiles {
+		expected, found := findDpkgChecksum(md5sumFile, candidates)
+		if !found {
+			continue
+		}
+		owner := strings.TrimSuffix(filepath.Base(md5sumFile), ".md5sums")
+		actual, err := fileChecksum(resolvedPath, md5.New())
+		if err != nil {
+			return "", err
+		}
+		if actual != expected {
+			return "", errors.New(resolvedPath + " does not match the checksum of package " + owner)
+		}
+		return owner, nil
+	}
+	return "", errors.New(path + " is not owned by any dpkg package")
+}
+
+func findDpkgChecksum(md5sumFile string, candidates []string) (string, bool) {
+	file, err := os.Open(md5sumFile)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		for _, candidate := range candidates {
+			if "/"+fields[1] == candidate {
+				return fields[0], true
+			}
+		}
+	}
+	return "", false
+}
+
+func packagePathCandidates(paths ...string) []string {
+	var candidates []string
+	for _, path := range paths {
+		candidates = append(candidates, path)
+		if strings.HasPrefix(path, "/usr/") {
+			candidates = append(candidates, strings.TrimPrefix(path, "/usr"))
+		} else {
+			candidates = append(candidates, "/usr"+path)
+		}
+	}
+	return candidates
+}
+
+// rpm -V prints a line with the digest flag "5" for modified files
+func verifyRpmOwnedFile(resolvedPath string) (string, error) {
+	owner, err := exec.Command(rpmBinary, "-qf", resolvedPath).Output()
+	if err != nil {
+		return "", errors.New(resolvedPath + " is not owned by any rpm package")
+	}
+
+	verifyOutput, _ := exec.Command(rpmBinary, "-Vf", resolvedPath).Output()
+	for _, line := range strings.Split(string(verifyOutput), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[len(fields)-1] != resolvedPath {
+			continue
+		}
+		if strings.Contains(fields[0], "5") || strings.Contains(line, "missing") {
+			return "", errors.New(resolvedPath + " does not match the checksum of package " + removeSuffix(string(owner)))
+		}
+	}
+	return removeSuffix(string(owner)), nil
+}
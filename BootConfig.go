@@ -0,0 +1,439 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type BootConfig struct {
+	Cmdline       string                     `json:"cmdline"`
+	Parameters    map[string]KernelParameter `json:"parameters"`
+	DefaultGrub   map[string]interface{}     `json:"defaultGrub"`
+	Grub          GrubConfig                 `json:"grub"`
+	LoaderEntries []BootEntry                `json:"loaderEntries"`
+}
+
+// a parameter is persisted if every boot entry sets it, /etc/default/grub only counts if there are no entries
+type KernelParameter struct {
+	Name           string `json:"name"`
+	Active         bool   `json:"active"`
+	ActiveValue    string `json:"activeValue"`
+	Persisted      bool   `json:"persisted"`
+	PersistedValue string `json:"persistedValue"`
+	DefaultGrub    bool   `json:"defaultGrub"`
+	Entries        int    `json:"entries"`
+	TotalEntries   int    `json:"totalEntries"`
+}
+
+type GrubConfig struct {
+	Files       []map[string]interface{} `json:"files"`
+	Superusers  []string                 `json:"superusers"`
+	Passwords   []GrubPassword           `json:"passwords"`
+	MenuEntries []BootEntry              `json:"menuEntries"`
+}
+
+// the hash of a password is never returned
+type GrubPassword struct {
+	User string `json:"user"`
+	Type string `json:"type"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+type BootEntry struct {
+	Title        string `json:"title"`
+	Kernel       string `json:"kernel"`
+	Options      string `json:"options"`
+	Unrestricted bool   `json:"unrestricted,omitempty"`
+	File         string `json:"file"`
+	Line         int    `json:"line,omitempty"`
+}
+
+const (
+	kernelCmdlineFile = "/proc/cmdline"
+	defaultGrubFile   = "/etc/default/grub"
+	defaultGrubDir    = "/etc/default/grub.d"
+)
+
+// grub 2 of RHEL and SUSE, of Debian and the copies on the EFI partition
+var grubConfigFiles = []string{"/boot/grub2/grub.cfg", "/boot/grub/grub.cfg", "/boot/efi/EFI/*/grub.cfg"}
+
+// the environment block of grub holds the kernelopts of the BLS entries on RHEL 8
+var grubEnvFiles = []string{"/boot/grub2/grubenv", "/boot/grub/grubenv"}
+
+// the third word of "password_pbkdf2 root grub.pbkdf2.sha512..." and "password root secret" is the hash or the password
+var grubPasswordRegex = regexp.MustCompile(`(?m)^(\s*password(?:_pbkdf2)?\s+(?:'[^']*'|"[^"]*"|\S+)\s+)('[^']*'|"[^"]*"|\S+)`)
+
+// entries of the boot loader specification used by systemd-boot and grub with blscfg
+var loaderEntryDirectories = []string{"/boot/loader/entries", "/efi/loader/entries", "/boot/efi/loader/entries"}
+
+// kernel command line of the running system and of the boot entries
+func BootConfiguration() (interface{}, error) {
+	config, err := readBootConfig()
+	if err != nil {
+		return nil, err
+	}
+	return toJavaScriptValue(config), nil
+}
+
+func readBootConfig() (BootConfig, error) {
+	config := BootConfig{Parameters: make(map[string]KernelParameter), DefaultGrub: make(map[string]interface{}), LoaderEntries: []BootEntry{}}
+	config.Grub = GrubConfig{Files: []map[string]interface{}{}, Superusers: []string{}, Passwords: []GrubPassword{}, MenuEntries: []BootEntry{}}
+
+	if content, err := ioutil.ReadFile(hostPath(kernelCmdlineFile)); err == nil {
+		config.Cmdline = strings.TrimSpace(string(content))
+	}
+	defaultGrub, err := readDefaultGrub()
+	if err != nil {
+		return config, err
+	}
+	config.DefaultGrub = defaultGrub
+
+	for _, pattern := range grubConfigFiles {
+		matches, _ := filepath.Glob(hostPath(pattern))
+		for _, match := range matches {
+			path := filepath.Join("/", strings.TrimPrefix(match, filepath.Clean(hostRoot)))
+			if err := readGrubConfig(path, &config.Grub); err != nil {
+				return config, err
+			}
+		}
+	}
+	entries, err := readLoaderEntries()
+	if err != nil {
+		return config, err
+	}
+	config.LoaderEntries = entries
+
+	config.Parameters = kernelParameters(config)
+	return config, nil
+}
+
+// /etc/default/grub and the *.cfg files of Debian in /etc/default/grub.d, the last value wins and
+// variables set before are expanded like sourcing the files does (e.g. "$GRUB_CMDLINE_LINUX apparmor=1")
+func readDefaultGrub() (map[string]interface{}, error) {
+	parsed, err := parseConfig(defaultGrubFile, configDialectShell, "")
+	if err != nil {
+		return nil, err
+	}
+	entries := parsed.Entries
+	files, _ := filepath.Glob(filepath.Join(hostPath(defaultGrubDir), "*.cfg"))
+	sort.Strings(files)
+	for _, file := range files {
+		path := filepath.Join(defaultGrubDir, filepath.Base(file))
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.New("boot: cannot read " + path)
+		}
+		saveFileArtefact(file, content)
+		fileEntries, err := parseConfigContent(string(content), configDialectShell, path)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fileEntries...)
+	}
+
+	values := make(map[string]interface{})
+	for _, entry := range entries {
+		values[entry.Key] = os.Expand(entry.Value, func(name string) string {
+			value, _ := values[name].(string)
+			return value
+		})
+	}
+	return values, nil
+}
+
+// menu entries, superusers and passwords of a grub.cfg, the file is only readable by root on most systems
+func readGrubConfig(path string, grub *GrubConfig) error {
+	fileStat, err := Stat(hostPath(path))
+	if err != nil {
+		return nil
+	}
+	grub.Files = append(grub.Files, fileStat)
+	content, err := ioutil.ReadFile(hostPath(path))
+	if err != nil {
+		WriteLog("boot: cannot read "+path+", menu entries and passwords are unknown", "WARN")
+		return nil
+	}
+	saveFileArtefact(hostPath(path), redactGrubPasswords(content))
+
+	// open blocks, blocks of functions and conditions have no line
+	var blocks []BootEntry
+	for number, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields, err := splitGrubLine(line)
+		if err != nil {
+			return errors.New("boot: " + path + " line " + strconv.Itoa(number+1) + ": " + err.Error())
+		}
+
+		switch fields[0] {
+		case "set":
+			if len(fields) > 1 && strings.HasPrefix(fields[1], "superusers=") {
+				grub.Superusers = strings.FieldsFunc(strings.TrimPrefix(fields[1], "superusers="), func(r rune) bool { return r == ' ' || r == ',' || r == ';' || r == '|' })
+			}
+		case "password_pbkdf2", "password":
+			if len(fields) > 1 {
+				passwordType := "pbkdf2"
+				if fields[0] == "password" {
+					passwordType = "plain"
+				}
+				grub.Passwords = append(grub.Passwords, GrubPassword{User: fields[1], Type: passwordType, File: path, Line: number + 1})
+			}
+		case "menuentry", "submenu":
+			entry := BootEntry{File: path, Line: number + 1}
+			if len(fields) > 1 {
+				entry.Title = fields[1]
+			}
+			for _, field := range fields {
+				if field == "--unrestricted" {
+					entry.Unrestricted = true
+				}
+			}
+			blocks = append(blocks, entry)
+		case "linux", "linux16", "linuxefi":
+			for i := len(blocks) - 1; i >= 0 && len(fields) > 1; i-- {
+				if blocks[i].Line == 0 {
+					continue
+				}
+				entry := blocks[i]
+				entry.Kernel = fields[1]
+				entry.Options = strings.Join(fields[2:], " ")
+				grub.MenuEntries = append(grub.MenuEntries, entry)
+				break
+			}
+		case "}":
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+		default:
+			if fields[len(fields)-1] == "{" {
+				blocks = append(blocks, BootEntry{})
+			}
+		}
+	}
+	return nil
+}
+
+// the artefact keeps the users of the passwords, hashes and plain passwords become "*"
+func redactGrubPasswords(content []byte) []byte {
+	return grubPasswordRegex.ReplaceAll(content, []byte("${1}*"))
+}
+
+// words of a grub.cfg line with the quotes removed, "{" is a word of its own
+func splitGrubLine(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inField := false
+	for i := 0; i < len(line); i++ {
+		character := line[i]
+		switch {
+		case character == '\'' || character == '"':
+			end := strings.IndexByte(line[i+1:], character)
+			if end < 0 {
+				return nil, errors.New("unterminated quote")
+			}
+			field.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inField = true
+		case character == ' ' || character == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		case character == '{' && !inField:
+			fields = append(fields, "{")
+		default:
+			field.WriteByte(character)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	if len(fields) == 0 {
+		fields = []string{""}
+	}
+	return fields, nil
+}
+
+// "options" lines are joined, $kernelopts is taken from the grub environment block
+func readLoaderEntries() ([]BootEntry, error) {
+	entries := []BootEntry{}
+	grubEnv := readGrubEnv()
+	for _, directory := range loaderEntryDirectories {
+		files, _ := filepath.Glob(filepath.Join(hostPath(directory), "*.conf"))
+		sort.Strings(files)
+		for _, file := range files {
+			path := filepath.Join(directory, filepath.Base(file))
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, errors.New("boot: cannot read " + path)
+			}
+			saveFileArtefact(file, content)
+			lines, err := parseConfigContent(string(content), configDialectSpace, path)
+			if err != nil {
+				return nil, err
+			}
+			entry := BootEntry{File: path}
+			var options []string
+			for _, line := range lines {
+				switch line.Key {
+				case "title":
+					entry.Title = line.Value
+				case "linux":
+					entry.Kernel = line.Value
+				case "options":
+					options = append(options, line.Value)
+				}
+			}
+			entry.Options = os.Expand(strings.Join(options, " "), func(name string) string {
+				if value, found := grubEnv[name]; found {
+					return value
+				}
+				return "$" + name
+			})
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func readGrubEnv() map[string]string {
+	values := make(map[string]string)
+	for _, path := range grubEnvFiles {
+		content, err := ioutil.ReadFile(hostPath(path))
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			keyValue := strings.SplitN(line, "=", 2)
+			if len(keyValue) == 2 && !strings.HasPrefix(line, "#") {
+				values[keyValue[0]] = keyValue[1]
+			}
+		}
+		break
+	}
+	return values
+}
+
+// parameters of the command line split at spaces outside of double quotes, the last value of a name wins
+func parseKernelCmdline(cmdline string) map[string]string {
+	parameters := make(map[string]string)
+	inQuotes := false
+	start := 0
+	for i := 0; i <= len(cmdline); i++ {
+		if i < len(cmdline) && cmdline[i] == '"' {
+			inQuotes = !inQuotes
+		}
+		if i < len(cmdline) && (cmdline[i] != ' ' || inQuotes) {
+			continue
+		}
+		parameter := cmdline[start:i]
+		start = i + 1
+		if parameter == "" {
+			continue
+		}
+		keyValue := strings.SplitN(parameter, "=", 2)
+		value := ""
+		if len(keyValue) == 2 {
+			value = strings.Trim(keyValue[1], "\"")
+		}
+		// like the kernel the quotes may also start before the name
+		parameters[strings.TrimPrefix(keyValue[0], "\"")] = value
+	}
+	return parameters
+}
+
+func kernelParameters(config BootConfig) map[string]KernelParameter {
+	parameters := make(map[string]KernelParameter)
+	get := func(name string) KernelParameter {
+		if parameter, found := parameters[name]; found {
+			return parameter
+		}
+		return KernelParameter{Name: name}
+	}
+
+	for name, value := range parseKernelCmdline(config.Cmdline) {
+		parameter := get(name)
+		parameter.Active = true
+		parameter.ActiveValue = value
+		parameters[name] = parameter
+	}
+
+	defaultCmdline, _ := config.DefaultGrub["GRUB_CMDLINE_LINUX"].(string)
+	if value, ok := config.DefaultGrub["GRUB_CMDLINE_LINUX_DEFAULT"].(string); ok {
+		defaultCmdline += " " + value
+	}
+	defaults := parseKernelCmdline(defaultCmdline)
+	for name := range defaults {
+		parameter := get(name)
+		parameter.DefaultGrub = true
+		parameters[name] = parameter
+	}
+
+	// the value of the first entry that sets the parameter, it is the default boot entry on most systems
+	entryValues := make(map[string]string)
+	var entries []BootEntry
+	for _, entry := range append(append([]BootEntry{}, config.Grub.MenuEntries...), config.LoaderEntries...) {
+		if !isMemtestEntry(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		for name, value := range parseKernelCmdline(entries[i].Options) {
+			parameter := get(name)
+			parameter.Entries++
+			parameters[name] = parameter
+			entryValues[name] = value
+		}
+	}
+
+	for name, parameter := range parameters {
+		parameter.TotalEntries = len(entries)
+		switch {
+		case len(entries) > 0 && parameter.Entries == len(entries):
+			parameter.Persisted = true
+			parameter.PersistedValue = entryValues[name]
+		case len(entries) == 0 && parameter.DefaultGrub:
+			parameter.Persisted = true
+			parameter.PersistedValue = defaults[name]
+		}
+		parameters[name] = parameter
+	}
+	return parameters
+}
+
+// memtest86+ is booted with "linux" or "linux16" like a kernel but has no kernel parameters
+func isMemtestEntry(entry BootEntry) bool {
+	return strings.HasPrefix(strings.ToLower(filepath.Base(entry.Kernel)), "memtest")
+}
@@ -0,0 +1,457 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+type CommandPolicy struct {
+	Command            string   `json:"command"`
+	AllowedArguments   []string `json:"allowedArguments"`
+	RequiredArguments  []string `json:"requiredArguments"`
+	ForbiddenArguments []string `json:"forbiddenArguments"`
+	Desc               string   `json:"description"`
+}
+
+type CommandPolicies struct {
+	Policies []CommandPolicy `json:"policies"`
+}
+
+const policyViolation = "policy violation: "
+
+var commandPolicies map[string]CommandPolicy
+
+// options of xargs that take the next argument as value
+var xargsValueOptions = []string{"-a", "-d", "-E", "-I", "-L", "-n", "-P", "-s", "--arg-file", "--delimiter", "--max-lines",
+	"--max-args", "--max-procs", "--max-chars", "--process-slot-var"}
+
+// actions of find that run a command up to ";" or "+"
+var findExecActions = []string{"-exec", "-execdir", "-ok", "-okdir"}
+
+// awk starts commands with system(), every "|" outside of strings and regular expressions is a pipe
+// to or from a command or a coprocess, the command can also be a variable (e.g. print "id" | c)
+var awkSystemRegex = regexp.MustCompile(`system\s*\(`)
+
+// characters that end the command, start another one or redirect it when they are not quoted
+const shellControlCharacters = ";&|<>()`"
+
+// commands that can change the system are restricted to their auditing arguments
+func init() {
+	commandPolicies = make(map[string]CommandPolicy)
+	addCommandPolicies([]CommandPolicy{
+		{
+			Command:          "useradd",
+			AllowedArguments: []string{"-D"},
+			Desc:             "only print the defaults",
+		},
+		{
+			Command:           "modprobe",
+			AllowedArguments:  []string{"-n", "-v", "[A-Za-z0-9_][A-Za-z0-9_-]*"},
+			RequiredArguments: []string{"-n", "-v"},
+			Desc:              "only dry-run module loading",
+		},
+		{
+			Command:            "rmmod",
+			ForbiddenArguments: []string{".*"},
+			Desc:               "never remove modules",
+		},
+	})
+}
+
+// later policies replace earlier ones for the same command
+func addCommandPolicies(policies []CommandPolicy) {
+	for _, policy := range policies {
+		commandPolicies[strings.ToLower(policy.Command)] = policy
+	}
+}
+
+// reads a policy file given through -add and allows its commands
+func loadCommandPolicyFile(path string) ([]string, error) {
+	byteValue, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies CommandPolicies
+	if !checkJsonFormat(byteValue, &policies) {
+		return nil, errors.New("JSON format of policy file " + path + " incorrect")
+	}
+
+	var policyCommands []string
+	for i, policy := range policies.Policies {
+		if policy.Command == "" {
+			return nil, errors.New("Issue at the " + getOrdinalNum(i+1) + " policy in " + path + ". You have to specify the command")
+		}
+		patterns := append(append(append([]string{}, policy.AllowedArguments...), policy.RequiredArguments...), policy.ForbiddenArguments...)
+		for _, pattern := range patterns {
+			if _, compileErr := regexp.Compile(anchorPattern(pattern)); compileErr != nil {
+				return nil, errors.New("invalid argument pattern \"" + pattern + "\" for " + policy.Command + " in " + path)
+			}
+		}
+		policyCommands = append(policyCommands, policy.Command)
+	}
+	addCommandPolicies(policies.Policies)
+
+	if debugModeEnabled {
+		WriteDebugLog("policy file "+path+" loaded", "INFO")
+	}
+	return policyCommands, nil
+}
+
+// checks arguments of an allowed command against its policy, names the argument that broke it
+func checkCommandPolicy(command string, arguments []string) error {
+	if err := checkShellCharacters(command, arguments); err != nil {
+		return err
+	}
+	if err := checkWrappedCommand(command, arguments); err != nil {
+		return err
+	}
+	if err := checkReadOnlyCommandPolicy(command, arguments); err != nil {
+		return err
+	}
+	policy, ok := commandPolicies[strings.ToLower(command)]
+	if !ok {
+		return nil
+	}
+
+	for _, argument := range arguments {
+		for _, pattern := range policy.ForbiddenArguments {
+			if matchesArgument(pattern, argument) {
+				return errors.New(policyViolation + "argument \"" + argument + "\" of " + command + " is forbidden")
+			}
+		}
+		if len(policy.AllowedArguments) == 0 {
+			continue
+		}
+		allowed := false
+		for _, pattern := range policy.AllowedArguments {
+			if matchesArgument(pattern, argument) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return errors.New(policyViolation + "argument \"" + argument + "\" of " + command + " is not allowed")
+		}
+	}
+
+	for _, pattern := range policy.RequiredArguments {
+		found := false
+		for _, argument := range arguments {
+			if matchesArgument(pattern, argument) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New(policyViolation + command + " requires the argument \"" + pattern + "\"")
+		}
+	}
+	return nil
+}
+
+// the arguments are joined and run by the shell, "ls /tmp; rmmod x" would run rmmod without any check
+func checkShellCharacters(command string, arguments []string) error {
+	line := strings.Join(arguments, " ")
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		character := line[i]
+		switch {
+		// PowerShell escapes with "`" and keeps "\" of paths
+		case character == '\\' && quote != '\'' && runtime.GOOS != "windows":
+			i++
+		case quote == '\'':
+			if character == '\'' {
+				quote = 0
+			}
+		case quote == '"':
+			if character == '"' {
+				quote = 0
+			} else if character == '`' || strings.HasPrefix(line[i:], "$(") {
+				return shellCharacterViolation(command, line[i:i+1])
+			}
+		case character == '\'' || character == '"':
+			quote = character
+		case strings.IndexByte(shellControlCharacters, character) >= 0:
+			return shellCharacterViolation(command, line[i:i+1])
+		}
+	}
+	if quote != 0 {
+		return errors.New(policyViolation + "unterminated quote in the arguments of " + command)
+	}
+	return nil
+}
+
+// words of the line split and unquoted like the shell does
+func shellWords(line string) []string {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		character := line[i]
+		switch {
+		case quote == '\'':
+			if character == '\'' {
+				quote = 0
+			} else {
+				word.WriteByte(character)
+			}
+		case quote == '"':
+			if character == '"' {
+				quote = 0
+				continue
+			}
+			if character == '\\' && i+1 < len(line) && strings.IndexByte("$`\"\\", line[i+1]) >= 0 {
+				i++
+			}
+			word.WriteByte(line[i])
+		case character == '\\' && i+1 < len(line) && runtime.GOOS != "windows":
+			i++
+			word.WriteByte(line[i])
+			inWord = true
+		case character == '\'' || character == '"':
+			quote = character
+			inWord = true
+		case character == ' ' || character == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(character)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+func shellCharacterViolation(command string, character string) error {
+	return errors.New(policyViolation + "\"" + character + "\" in the arguments of " + command + " is run by the shell")
+}
+
+// patterns have to match the whole argument
+func matchesArgument(pattern string, argument string) bool {
+	re, err := regexp.Compile(anchorPattern(pattern))
+	if err != nil {
+		return false
+	}
+	return re.MatchString(argument)
+}
+
+func anchorPattern(pattern string) string {
+	return "^(?:" + pattern + ")$"
+}
+
+// wrappers like xargs, find and awk run other commands, these have to be allowed and follow their own policy
+func checkWrappedCommand(command string, arguments []string) error {
+	switch strings.ToLower(command) {
+	case "xargs":
+		return checkXargsCommand(arguments)
+	case "find":
+		return checkFindCommand(arguments)
+	case "awk", "gawk", "mawk", "nawk":
+		return checkAwkCommand(command, arguments)
+	}
+	return nil
+}
+
+// the program is the first argument that is no option, a program file cannot be checked
+func checkAwkCommand(command string, arguments []string) error {
+	words := shellWords(strings.Join(arguments, " "))
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		switch {
+		case strings.HasPrefix(word, "-f") || strings.HasPrefix(word, "--file"):
+			return errors.New(policyViolation + command + " must not read its program from a file")
+		case word == "-F" || word == "-v":
+			i++
+		case word == "--":
+			if i+1 < len(words) && awkRunsCommand(words[i+1]) {
+				return errors.New(policyViolation + command + " must not run commands")
+			}
+			return nil
+		case strings.HasPrefix(word, "-") && word != "-":
+		default:
+			if awkRunsCommand(word) {
+				return errors.New(policyViolation + command + " must not run commands")
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// "/" starts a regular expression where an operand is expected and divides after one, like the lexer of awk decides,
+// an unterminated string or regular expression is refused as well
+func awkRunsCommand(program string) bool {
+	if awkSystemRegex.MatchString(program) {
+		return true
+	}
+	operand := false
+	for i := 0; i < len(program); i++ {
+		character := program[i]
+		switch {
+		case character == '"':
+			i = awkLiteralEnd(program, i, '"')
+			if i < 0 {
+				return true
+			}
+			operand = true
+		case character == '/' && !operand:
+			i = awkLiteralEnd(program, i, '/')
+			if i < 0 {
+				return true
+			}
+			operand = true
+		case character == '|':
+			if !strings.HasPrefix(program[i:], "||") {
+				return true
+			}
+			i++
+			operand = false
+		case character == '#':
+			return false
+		case strings.HasPrefix(program[i:], "++") || strings.HasPrefix(program[i:], "--"):
+			// "i++ / 2" still divides
+			i++
+		case character == '_' || character == ')' || character == ']' || character == '.' ||
+			(character >= 'a' && character <= 'z') || (character >= 'A' && character <= 'Z') || (character >= '0' && character <= '9'):
+			operand = true
+		case character == ' ' || character == '\t':
+		default:
+			operand = false
+		}
+	}
+	return false
+}
+
+// index of the quote or slash that closes the literal starting at start, "/" is no end inside of [...]
+func awkLiteralEnd(program string, start int, end byte) int {
+	inBracket := false
+	for i := start + 1; i < len(program); i++ {
+		switch character := program[i]; {
+		case character == '\\':
+			i++
+		case end == '/' && character == '[' && !inBracket:
+			inBracket = true
+			if strings.HasPrefix(program[i+1:], "^") {
+				i++
+			}
+			if strings.HasPrefix(program[i+1:], "]") {
+				i++
+			}
+		case inBracket && character == ']':
+			inBracket = false
+		case character == end && !inBracket:
+			return i
+		}
+	}
+	return -1
+}
+
+// "xargs -0 grep -l x" runs grep, the first argument that is no option is the command
+func checkXargsCommand(arguments []string) error {
+	for i := 0; i < len(arguments); i++ {
+		argument := unquoteArgument(arguments[i])
+		if argument == "--" {
+			return checkXargsWrappedCommand(arguments[i+1:])
+		}
+		if !strings.HasPrefix(argument, "-") || argument == "-" {
+			return checkXargsWrappedCommand(arguments[i:])
+		}
+		if containsArgument(xargsValueOptions, argument) {
+			i++
+		}
+	}
+	return nil
+}
+
+// the arguments xargs reads from stdin cannot be checked, so commands with a policy are refused
+func checkXargsWrappedCommand(commandLine []string) error {
+	if len(commandLine) == 0 {
+		return nil
+	}
+	command := unquoteArgument(commandLine[0])
+	if _, ok := commandPolicies[strings.ToLower(command)]; ok {
+		return errors.New(policyViolation + "xargs passes unchecked arguments to " + command)
+	}
+	return checkWrappedCommandLine("xargs", commandLine)
+}
+
+// "find / -name x -exec rmmod {} ;" runs rmmod for every file found
+func checkFindCommand(arguments []string) error {
+	for i := 0; i < len(arguments); i++ {
+		if !containsArgument(findExecActions, unquoteArgument(arguments[i])) {
+			continue
+		}
+		end := i + 1
+		for end < len(arguments) && !isFindExecEnd(arguments[end]) {
+			end++
+		}
+		if err := checkWrappedCommandLine("find", arguments[i+1:end]); err != nil {
+			return err
+		}
+		i = end
+	}
+	return nil
+}
+
+// the shell sees ";" escaped or quoted
+func isFindExecEnd(argument string) bool {
+	argument = unquoteArgument(strings.TrimPrefix(argument, "\\"))
+	return argument == ";" || argument == "+"
+}
+
+func checkWrappedCommandLine(wrapper string, commandLine []string) error {
+	if len(commandLine) == 0 {
+		return nil
+	}
+	command := unquoteArgument(commandLine[0])
+	if !isSupportedCommand(command) {
+		return errors.New(policyViolation + wrapper + " runs " + command + " which is not allowed")
+	}
+	return checkCommandPolicy(command, commandLine[1:])
+}
+
+// arguments are passed to the shell, which removes the quotes
+func unquoteArgument(argument string) string {
+	return strings.Trim(argument, "'\"")
+}
+
+func containsArgument(arguments []string, argument string) bool {
+	for _, existing := range arguments {
+		if existing == argument {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,358 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ConfigEntry struct {
+	Section string `json:"section"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+}
+
+// values has the last value of every key, sections are objects of their own in the ini dialect
+type ParsedConfig struct {
+	Values  map[string]interface{} `json:"values"`
+	Entries []ConfigEntry          `json:"entries"`
+	Files   []string               `json:"files"`
+}
+
+// a line of a config file with the number it starts at
+type configLine struct {
+	text   string
+	number int
+}
+
+const (
+	configDialectIni      = "ini"
+	configDialectKeyValue = "keyvalue"
+	configDialectSpace    = "space"
+	configDialectShell    = "shell"
+)
+
+// chrony and other "key value" files also use "!" and "%" for comments
+var configCommentPrefixes = map[string]string{configDialectIni: "#;", configDialectKeyValue: "#;", configDialectSpace: "#;!%", configDialectShell: "#"}
+
+var shellVariableRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// drop-ins of a file in /etc/systemd are also read from the same directories below these
+const systemdConfigDirectory = "/etc/systemd/"
+
+var configDropInRoots = []string{"/etc", "/run", "/usr/local/lib", "/usr/lib"}
+
+// the file and its drop-ins, files in /etc/systemd are merged like systemd does and other files only read
+// the drop-ins matching the pattern (e.g. "/etc/sssd/conf.d/*.conf"), a missing file has no values
+func ParseConfig(path string, dialect string, dropInPattern string) (interface{}, error) {
+	config, err := parseConfig(path, dialect, dropInPattern)
+	if err != nil {
+		return nil, err
+	}
+	return toJavaScriptValue(config), nil
+}
+
+func parseConfig(path string, dialect string, dropInPattern string) (ParsedConfig, error) {
+	config := ParsedConfig{Values: make(map[string]interface{}), Entries: []ConfigEntry{}, Files: []string{}}
+	if dialect == "" {
+		dialect = configDialectIni
+	}
+	if _, found := configCommentPrefixes[dialect]; !found {
+		return config, errors.New("config: unknown dialect " + dialect + ", use ini, keyvalue, space or shell")
+	}
+
+	dropIns := configDropIns(path, dropInPattern)
+	for _, file := range append([]string{path}, dropIns...) {
+		content, err := ioutil.ReadFile(hostPath(file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return config, errors.New("config: cannot read " + file)
+		}
+		saveFileArtefact(hostPath(file), content)
+		entries, err := parseConfigContent(string(content), dialect, file)
+		if err != nil {
+			return config, err
+		}
+		config.Entries = append(config.Entries, entries...)
+		config.Files = append(config.Files, file)
+	}
+
+	for _, entry := range config.Entries {
+		if dialect != configDialectIni {
+			config.Values[entry.Key] = entry.Value
+			continue
+		}
+		section, ok := config.Values[entry.Section].(map[string]interface{})
+		if !ok {
+			section = make(map[string]interface{})
+			config.Values[entry.Section] = section
+		}
+		section[entry.Key] = entry.Value
+	}
+	return config, nil
+}
+
+// other programs have their own drop-in directories (e.g. grub.d/*.cfg or conf.d/*.conf), only systemd uses <name>.d
+func configDropIns(path string, dropInPattern string) []string {
+	if dropInPattern != "" {
+		matches, _ := filepath.Glob(hostPath(dropInPattern))
+		var dropIns []string
+		for _, match := range matches {
+			dropIns = append(dropIns, filepath.Join(filepath.Dir(dropInPattern), filepath.Base(match)))
+		}
+		return dropIns
+	}
+	if strings.HasPrefix(path, systemdConfigDirectory) {
+		return systemdConfigDropIns(path)
+	}
+	return nil
+}
+
+// drop-ins of all directories sorted by file name, a file replaces the ones with the same name in later directories
+func systemdConfigDropIns(path string) []string {
+	var directories []string
+	for _, root := range configDropInRoots {
+		directories = append(directories, root+strings.TrimPrefix(path, "/etc")+".d")
+	}
+
+	dropInsByName := make(map[string]string)
+	for i := len(directories) - 1; i >= 0; i-- {
+		matches, _ := filepath.Glob(filepath.Join(hostPath(directories[i]), "*.conf"))
+		for _, match := range matches {
+			dropInsByName[filepath.Base(match)] = filepath.Join(directories[i], filepath.Base(match))
+		}
+	}
+	var names []string
+	for name := range dropInsByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var dropIns []string
+	for _, name := range names {
+		if !isMaskedFile(dropInsByName[name]) {
+			dropIns = append(dropIns, dropInsByName[name])
+		}
+	}
+	return dropIns
+}
+
+func parseConfigContent(content string, dialect string, path string) ([]ConfigEntry, error) {
+	var lines []configLine
+	if dialect == configDialectShell {
+		lines = joinShellLines(content)
+	} else {
+		lines = joinConfigLines(content, dialect)
+	}
+
+	entries := []ConfigEntry{}
+	section := ""
+	for _, line := range lines {
+		lineError := "config: " + path + " line " + strconv.Itoa(line.number) + ": "
+		if dialect == configDialectIni && strings.HasPrefix(line.text, "[") {
+			if !strings.HasSuffix(line.text, "]") {
+				return nil, errors.New(lineError + "unterminated section " + line.text)
+			}
+			section = strings.TrimSpace(line.text[1 : len(line.text)-1])
+			continue
+		}
+
+		var key, value string
+		switch dialect {
+		case configDialectSpace:
+			fields := strings.Fields(line.text)
+			key = fields[0]
+			value = strings.TrimSpace(strings.TrimPrefix(line.text, key))
+		case configDialectShell:
+			assignments, err := splitShellAssignments(strings.TrimPrefix(line.text, "export "))
+			if err != nil {
+				return nil, errors.New(lineError + err.Error())
+			}
+			for _, assignment := range assignments {
+				entries = append(entries, ConfigEntry{Section: section, Key: assignment[0], Value: assignment[1], File: path, Line: line.number})
+			}
+			continue
+		default:
+			keyValue := strings.SplitN(line.text, "=", 2)
+			if len(keyValue) != 2 {
+				return nil, errors.New(lineError + "missing = in " + line.text)
+			}
+			key = strings.TrimSpace(keyValue[0])
+			value = strings.TrimSpace(keyValue[1])
+		}
+		entries = append(entries, ConfigEntry{Section: section, Key: key, Value: value, File: path, Line: line.number})
+	}
+	return entries, nil
+}
+
+// comment lines are skipped, ini and keyvalue lines ending with "\" continue on the next line
+func joinConfigLines(content string, dialect string) []configLine {
+	var lines []configLine
+	continued := ""
+	start := 0
+	for number, text := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		text = strings.TrimSpace(text)
+		if continued == "" && (text == "" || strings.ContainsAny(text[:1], configCommentPrefixes[dialect])) {
+			continue
+		}
+		if continued == "" {
+			start = number + 1
+		}
+		if dialect != configDialectSpace && strings.HasSuffix(text, "\\") {
+			continued += strings.TrimSpace(strings.TrimSuffix(text, "\\")) + " "
+			continue
+		}
+		lines = append(lines, configLine{text: continued + text, number: start})
+		continued = ""
+	}
+	if continued != "" {
+		lines = append(lines, configLine{text: strings.TrimSpace(continued), number: start})
+	}
+	return lines
+}
+
+// like the shell a "\" at the end of a line joins it with the next one, also inside of quotes
+func joinShellLines(content string) []configLine {
+	var lines []configLine
+	continued := ""
+	start := 0
+	for number, text := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if continued == "" {
+			text = strings.TrimSpace(text)
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			start = number + 1
+		}
+		if strings.HasSuffix(text, "\\") && !strings.HasSuffix(text, "\\\\") {
+			continued += strings.TrimSuffix(text, "\\")
+			continue
+		}
+		lines = append(lines, configLine{text: strings.TrimSpace(continued + text), number: start})
+		continued = ""
+	}
+	if continued != "" {
+		lines = append(lines, configLine{text: strings.TrimSpace(continued), number: start})
+	}
+	return lines
+}
+
+// "A=1 B=2" sets both variables, other shell code (e.g. "[ -r file ] && . file") or a command
+// after the assignments (e.g. "LANG=C command") sets no variable
+func splitShellAssignments(text string) ([][2]string, error) {
+	var assignments [][2]string
+	for text != "" {
+		keyValue := strings.SplitN(text, "=", 2)
+		if len(keyValue) != 2 || !shellVariableRegex.MatchString(keyValue[0]) {
+			return nil, nil
+		}
+		value, rest, err := unquoteShellValue(keyValue[1])
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, [2]string{keyValue[0], value})
+		text = rest
+	}
+	return assignments, nil
+}
+
+// quotes are removed like the shell does, "\" escapes $ ` " and \ in double quotes and a "#" after a space starts a comment,
+// command substitutions are kept as written, the text after an unquoted space is returned as rest
+func unquoteShellValue(text string) (string, string, error) {
+	var value strings.Builder
+	for i := 0; i < len(text); i++ {
+		character := text[i]
+		switch {
+		case character == '\'':
+			end := strings.IndexByte(text[i+1:], '\'')
+			if end < 0 {
+				return "", "", errors.New("unterminated quote")
+			}
+			value.WriteString(text[i+1 : i+1+end])
+			i += end + 1
+		case character == '"':
+			i++
+			for ; i < len(text) && text[i] != '"'; i++ {
+				if text[i] == '\\' && i+1 < len(text) && strings.IndexByte("$`\"\\", text[i+1]) >= 0 {
+					i++
+				}
+				value.WriteByte(text[i])
+			}
+			if i >= len(text) {
+				return "", "", errors.New("unterminated quote")
+			}
+		case character == '`' || strings.HasPrefix(text[i:], "$("):
+			end := shellSubstitutionEnd(text, i)
+			if end < 0 {
+				return "", "", errors.New("unterminated command substitution")
+			}
+			value.WriteString(text[i : end+1])
+			i = end
+		case character == '\\' && i+1 < len(text):
+			i++
+			value.WriteByte(text[i])
+		case character == ' ' || character == '\t':
+			rest := strings.TrimSpace(text[i:])
+			if strings.HasPrefix(rest, "#") {
+				rest = ""
+			}
+			return value.String(), rest, nil
+		default:
+			value.WriteByte(character)
+		}
+	}
+	return value.String(), "", nil
+}
+
+// index of the closing ` or ) of the substitution starting at start
+func shellSubstitutionEnd(text string, start int) int {
+	if text[start] == '`' {
+		end := strings.IndexByte(text[start+1:], '`')
+		if end < 0 {
+			return -1
+		}
+		return start + 1 + end
+	}
+	depth := 0
+	for i := start + 1; i < len(text); i++ {
+		switch text[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -51,7 +51,7 @@ func printBanner() {
 
 func printHelpText() {
 	synopsisText := `
-	` + strings.ToLower(appName) + ` -input|--input [-h] [-p] [-v] [-s] [-debug] [-output|--output] [-add|--add]
+	` + strings.ToLower(appName) + ` -input|--input [-h] [-p] [-v] [-s] [-debug] [-readonly] [-output|--output] [-add|--add] [-pin|--pin] [-resume] [-dry-run]
 
 `
 	helpText := banner + "\n"
@@ -60,11 +60,15 @@ func printHelpText() {
 	helpText += strings.ToUpper("Description") + "\n"
 	helpText += "\t-input, --input= 'expects path to config file (.json)'\n"
 	helpText += "\t-output, --output= 'specify your output file (.zip)'\n"
-	helpText += "\t-add, --add= 'add a list of allowed commands'\n"
+	helpText += "\t-add, --add= 'add a list of allowed commands or policy files (.json)'\n"
+	helpText += "\t-pin, --pin= 'expects path to pin file for binaries (.json)'\n"
 	helpText += "\t-v \t'toggle verbose mode for console'\n"
 	helpText += "\t-s \t'skip sanity check'\n"
 	helpText += "\t-debug\t'activate debug mode for log files'\n"
 	helpText += "\t-p\t'set password to encrypt output zip folder'\n"
+	helpText += "\t-readonly\t'block shell() and writes of executed commands'\n"
+	helpText += "\t-resume\t'continue an interrupted audit'\n"
+	helpText += "\t-dry-run\t'show what would be executed without running it'\n"
 	helpText += "\t-h\t'help'\n\n"
 	helpText += strings.ToUpper("See also") + "\n\tComplete guide: https://github.com/Seculeet/secuteel\n\n"
 	helpText += strings.ToUpper("Reporting Bugs") + "\n\thttps://github.com/Seculeet/secuteel/issues\n\n"
@@ -120,3 +124,7 @@ func printCommandResult(auditResult bool) {
 	}
 	fmt.Println(printTxt)
 }
+
+func printCommandSkipped() {
+	fmt.Println("SKIPPED")
+}
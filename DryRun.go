@@ -0,0 +1,314 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/parser"
+)
+
+type PlannedCommand struct {
+	Command string
+	Binary  string
+	Argv    []string
+}
+
+type PlannedCall struct {
+	Function string
+	Source   string
+	Argument string
+	Commands []PlannedCommand
+	Artefact string
+	Issue    string
+}
+
+type AuditPlan struct {
+	Name  string
+	Calls []PlannedCall
+	Issue string
+}
+
+// JavaScript functions that run commands
+var plannedFunctions = []string{"call", "callCompare", "callContains", "shell", "regQuery", "auditRules", "assertAuditRules", "firewall"}
+
+// position of the source argument of helpers that only run a command for the source "loaded"
+var plannedSourceArguments = map[string]int{"auditRules": 0, "assertAuditRules": 1}
+
+// shows what every audit would execute, nothing is run
+func dryRun() {
+	var plans []AuditPlan
+	for _, library := range jsLibraries.Paths {
+		plans = append(plans, planLibrary(library))
+	}
+	for _, audit := range GetBigAudits() {
+		plans = append(plans, planAudit(audit))
+	}
+
+	PrintToConsole("Dry run of " + ConfigName + ", no command is executed\n")
+	issues := 0
+	for i, plan := range plans {
+		PrintToConsole(formatAuditPlan(plan, i+1, len(plans)))
+		if plan.Issue != "" {
+			issues++
+		}
+		for _, call := range plan.Calls {
+			if call.Issue != "" {
+				issues++
+			}
+		}
+	}
+	PrintToConsole(fmt.Sprint(issues) + " issue(s) found")
+	WriteLog("dry run finished with "+fmt.Sprint(issues)+" issue(s)", "INFO")
+}
+
+func planAudit(audit BigAudit) AuditPlan {
+	plan := AuditPlan{Name: audit.Name}
+
+	script, err := javaScriptOfAudit(audit)
+	if err != nil {
+		plan.Issue = err.Error()
+		return plan
+	}
+	return planScript(plan, audit, script)
+}
+
+// functions of a library run with the artefact settings of the calling audit
+func planLibrary(library string) AuditPlan {
+	plan := AuditPlan{Name: "jsLibrary " + library}
+
+	source, err := loadFromConfigDir(libraryModulePath(library))
+	if err != nil {
+		plan.Issue = "cannot read " + library
+		return plan
+	}
+	return planScript(plan, BigAudit{Name: library, DontSaveArtefact: true}, string(source))
+}
+
+func planScript(plan AuditPlan, audit BigAudit, script string) AuditPlan {
+	fileSet := &file.FileSet{}
+	program, err := parser.ParseFile(fileSet, audit.Name, script, 0)
+	if err != nil {
+		plan.Issue = "SyntaxError: " + err.Error()
+		return plan
+	}
+
+	for _, callExpression := range findCalls(program) {
+		call := planCall(audit, script, callExpression)
+		// helpers like auditRules() run no command for some arguments
+		if isPlannedHelper(call.Function) && len(call.Commands) == 0 && call.Issue == "" {
+			continue
+		}
+		plan.Calls = append(plan.Calls, call)
+	}
+	return plan
+}
+
+// walks the whole syntax tree, goja has no visitor for it
+func findCalls(node interface{}) []*ast.CallExpression {
+	var calls []*ast.CallExpression
+	var walk func(value reflect.Value)
+	walk = func(value reflect.Value) {
+		switch value.Kind() {
+		case reflect.Interface:
+			if !value.IsNil() {
+				walk(value.Elem())
+			}
+		case reflect.Ptr:
+			if value.IsNil() {
+				return
+			}
+			if callExpression, ok := value.Interface().(*ast.CallExpression); ok {
+				if identifier, ok := callExpression.Callee.(*ast.Identifier); ok && isPlannedFunction(identifier.Name.String()) {
+					calls = append(calls, callExpression)
+				}
+			}
+			walk(value.Elem())
+		case reflect.Struct:
+			for i := 0; i < value.NumField(); i++ {
+				field := value.Field(i)
+				if field.CanInterface() && field.Type() != reflect.TypeOf(&file.File{}) {
+					walk(field)
+				}
+			}
+		case reflect.Slice:
+			for i := 0; i < value.Len(); i++ {
+				walk(value.Index(i))
+			}
+		}
+	}
+	walk(reflect.ValueOf(node))
+	return calls
+}
+
+func isPlannedFunction(name string) bool {
+	for _, function := range plannedFunctions {
+		if name == function {
+			return true
+		}
+	}
+	return false
+}
+
+func isPlannedHelper(function string) bool {
+	_, hasSource := plannedSourceArguments[function]
+	return hasSource || function == "firewall"
+}
+
+func planCall(audit BigAudit, script string, callExpression *ast.CallExpression) PlannedCall {
+	call := PlannedCall{Function: callExpression.Callee.(*ast.Identifier).Name.String()}
+	if isPlannedHelper(call.Function) {
+		return planHelperCall(audit, script, callExpression, call)
+	}
+
+	if len(callExpression.ArgumentList) == 0 {
+		call.Issue = "no command given"
+		return call
+	}
+	argument := callExpression.ArgumentList[0]
+	call.Source = script[argument.Idx0()-1 : argument.Idx1()-1]
+	literal, ok := argument.(*ast.StringLiteral)
+	if !ok {
+		call.Issue = "command is not a string literal and cannot be planned"
+		return call
+	}
+	call.Argument = literal.Value.String()
+
+	switch call.Function {
+	case "shell":
+		if flags.readOnly {
+			call.Issue = readOnlyViolation + "shell() is blocked"
+		} else {
+			call.Issue = "shell() runs the command without the allowlist in " + GetSystem().Shell
+		}
+		if !audit.DontSaveArtefact {
+			call.Artefact = artefactPath(SmallAudit{Name: audit.Name}) + " (output)"
+		}
+		return call
+	case "regQuery":
+		return call
+	}
+
+	planCommand(audit, &call, call.Argument)
+	return call
+}
+
+// the commands a helper runs through call(), they are checked and saved like the ones of call()
+func planHelperCall(audit BigAudit, script string, callExpression *ast.CallExpression, call PlannedCall) PlannedCall {
+	commands := []string{iptablesSaveCommands["ip"], iptablesSaveCommands["ip6"], nftListCommand}
+	if position, hasSource := plannedSourceArguments[call.Function]; hasSource {
+		commands = nil
+		if position < len(callExpression.ArgumentList) {
+			argument := callExpression.ArgumentList[position]
+			call.Source = script[argument.Idx0()-1 : argument.Idx1()-1]
+			literal, ok := argument.(*ast.StringLiteral)
+			if !ok {
+				call.Issue = "source is not a string literal and cannot be planned"
+				return call
+			}
+			if literal.Value.String() == "loaded" {
+				commands = []string{auditctlListCommand}
+			}
+		}
+	}
+
+	for _, command := range commands {
+		planCommand(audit, &call, command)
+	}
+	return call
+}
+
+// adds the commands of a call() pipeline, the first issue and the artefact of the first command
+func planCommand(audit BigAudit, call *PlannedCall, command string) {
+	audits := separateInSmallAuditsButOnlyForCall(audit.Name, command)
+	for _, smallAudit := range audits {
+		argv := append([]string{smallAudit.Command}, smallAudit.Arguments...)
+		if smallAudit.Filepath != "" {
+			argv = append(argv, smallAudit.Filepath)
+		}
+		call.Commands = append(call.Commands, PlannedCommand{Command: smallAudit.Command, Binary: plannedBinary(smallAudit.Command), Argv: argv})
+	}
+
+	_, _, err := AuditWrapper(audits...)
+	if err != nil {
+		if call.Issue == "" {
+			call.Issue = err.Error()
+		}
+		return
+	}
+
+	if !audit.DontSaveArtefact && call.Artefact == "" {
+		if audits[0].Filepath != "" {
+			call.Artefact = artefactPath(audits[0]) + " (copy of " + audits[0].Filepath + ")"
+		} else {
+			call.Artefact = artefactPath(audits[0]) + " (output of " + audits[0].Command + ")"
+		}
+		if audit.BlackenContent != "" {
+			call.Artefact += ", blackened with " + audit.BlackenContent
+		}
+	}
+}
+
+// the binary a command resolves to, without running it
+func plannedBinary(command string) string {
+	if pin, ok := binaryPins[strings.ToLower(command)]; ok {
+		resolvedPath, err := filepath.EvalSymlinks(pin.Path)
+		if err != nil {
+			return pin.Path + " (pinned, not found)"
+		}
+		return resolvedPath + " (pinned)"
+	}
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return "resolved by " + GetSystem().Shell
+	}
+	return path
+}
+
+func formatAuditPlan(plan AuditPlan, position int, allAudits int) string {
+	text := "[" + fmt.Sprint(position) + "/" + fmt.Sprint(allAudits) + "] " + plan.Name + "\n"
+	if plan.Issue != "" {
+		text += "\tISSUE: " + plan.Issue + "\n"
+	}
+	if plan.Issue == "" && len(plan.Calls) == 0 {
+		text += "\tno commands\n"
+	}
+	for _, call := range plan.Calls {
+		text += "\t" + call.Function + "(" + call.Source + ")\n"
+		for _, command := range call.Commands {
+			text += "\t\t" + command.Binary + "\t" + fmt.Sprintf("%q", command.Argv) + "\n"
+		}
+		if call.Artefact != "" {
+			text += "\t\tartefact: " + call.Artefact + "\n"
+		}
+		if call.Issue != "" {
+			text += "\t\tISSUE: " + call.Issue + "\n"
+		}
+	}
+	return text
+}
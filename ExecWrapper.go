@@ -23,6 +23,8 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"os"
 	"os/exec"
 	"runtime"
 	"strings"
@@ -37,14 +39,30 @@ func init() {
 		"type", "echo", "reg", "findstr", "dir", "ls", "cat", "grep", "find", "useradd", "stat", "mount", "systemctl",
 		"egrep", "test", "call", "Select-String", "%", "modprobe", "df", "rpm", "zypper", "crontab", "stat", "sysctl",
 		"journalctl", "apparmor_status", "timedatectl", "ss", "lsof", "iw", "ip", "lsmod", "firewall-cmd", "nmcli",
-		"iptables", "ip6tables", "nft", "auditctl", "sshd", "useradd", "rmmod", "awk", "xargs", "subscription-manager",
-		"dnf", "sestatus", "ps", "authselect"}
+		"iptables", "ip6tables", "iptables-save", "ip6tables-save", "nft", "auditctl", "sshd", "useradd", "rmmod", "awk",
+		"xargs", "subscription-manager", "dnf", "sestatus", "ps", "authselect"}
 
 }
 
-// add new commands via -add
+// add new commands via -add, policy files (.json) add their commands with argument rules
 func getAdditionalCommands() {
-	additionalCommands := flags.addedCommands
+	var additionalCommands []string
+	for _, command := range flags.addedCommands {
+		if !inputHasJsonEnding(command) {
+			additionalCommands = append(additionalCommands, command)
+			continue
+		}
+		policyCommands, err := loadCommandPolicyFile(convertInputToPath(command))
+		if err != nil {
+			fmt.Println(err)
+			WriteErrorLog(err.Error(), "")
+			if debugModeEnabled {
+				WriteDebugLog(err.Error(), "ERROR")
+			}
+			os.Exit(0)
+		}
+		additionalCommands = append(additionalCommands, policyCommands...)
+	}
 	SupportedCommands = appendUnique(SupportedCommands, additionalCommands)
 }
 
@@ -77,12 +95,17 @@ func WrapperForAll(command string, args ...string) *exec.Cmd {
 		commandInSteps += " | " + command + " " + strings.Join(args, " ")
 	}
 
+	var execCmd *exec.Cmd
 	if runtime.GOOS == "windows" {
 		cmd := []string{GetSystem().Argument, commandInSteps}
-		return exec.Command(GetSystem().Shell, cmd...)
+		execCmd = exec.Command(GetSystem().Shell, cmd...)
 	} else {
-		return exec.Command(GetSystem().Shell, GetSystem().Argument, commandInSteps)
+		execCmd = exec.Command(GetSystem().Shell, GetSystem().Argument, commandInSteps)
 	}
+	if flags.readOnly {
+		execCmd.Env = readOnlyEnvironment()
+	}
+	return execCmd
 }
 
 // gets fail position and execute errors
@@ -100,7 +123,15 @@ func AuditWrapper(audit ...SmallAudit) ([]*exec.Cmd, int, error) {
 				if v.Filepath != "" {
 					v.Arguments = append(v.Arguments, v.Filepath)
 				}
-				foundCommand := []*exec.Cmd{WrapperForAll(com, v.Arguments...)}
+				policyErr := checkCommandPolicy(com, v.Arguments)
+				if policyErr != nil {
+					return finished, i, policyErr
+				}
+				commandPath, pinErr := pinnedCommandPath(com)
+				if pinErr != nil {
+					return finished, i, pinErr
+				}
+				foundCommand := []*exec.Cmd{WrapperForAll(commandPath, v.Arguments...)}
 				finished = append(finished, foundCommand...)
 				break
 			}
@@ -50,6 +50,9 @@ var sanityErr error
 var debugModeEnabled bool
 var pw string
 
+// goja appends the Go function an error came from
+var nativeFunctionSuffix = regexp.MustCompile(` at \S+ \(native\)`)
+
 // defines allow compare types
 func init() {
 	expectedTypes = []string{"==", "!=", ">=", ">", "<=", "<", "nil", "contains", "containsReg"}
@@ -112,19 +115,33 @@ func main() {
 
 	printBanner()
 
-	FirstAuditEntry = false
-	FirstErrorEntry = false
-	FirstResultEntry = false
+	runMetadata = RunMetadata{}
+	binaryPins = make(map[string]BinaryPin)
+	sharedState = make(map[string]interface{})
+	hostFacts = gatherFacts()
+	runMetadata.Facts = hostFacts
+
+	// a resumed audit continues the logs, results and artefacts of the interrupted one
+	// a dry run keeps the output of the last audit
+	if flags.resume || flags.dryRun {
+		FirstAuditEntry = true
+		FirstErrorEntry = true
+		FirstResultEntry = true
+	} else {
+		FirstAuditEntry = false
+		FirstErrorEntry = false
+		FirstResultEntry = false
 
-	removeOutputErr := os.RemoveAll("./output/artefacts")
+		removeOutputErr := os.RemoveAll("./output/artefacts")
 
-	if removeOutputErr != nil {
-		WriteErrorLog(removeOutputErr.Error(), "")
-		WriteDebugLog(removeOutputErr.Error(), "ERROR")
-	}
+		if removeOutputErr != nil {
+			WriteErrorLog(removeOutputErr.Error(), "")
+			WriteDebugLog(removeOutputErr.Error(), "ERROR")
+		}
 
-	if debugModeEnabled {
-		WriteDebugLog("./output folder successfully deleted", "INFO")
+		if debugModeEnabled {
+			WriteDebugLog("./output folder successfully deleted", "INFO")
+		}
 	}
 
 	if flags.encryptZip {
@@ -176,6 +193,17 @@ func main() {
 
 	ReadConfig()
 	getAdditionalCommands()
+	if flags.pin != "" {
+		pinErr := loadBinaryPins(convertInputToPath(convertInputToJson(flags.pin)))
+		if pinErr != nil {
+			fmt.Println(pinErr)
+			WriteErrorLog(pinErr.Error(), "")
+			if debugModeEnabled {
+				WriteDebugLog(pinErr.Error(), "ERROR")
+			}
+			os.Exit(0)
+		}
+	}
 	createCommandVM()
 
 	if !flags.skipSanity {
@@ -212,9 +240,61 @@ func main() {
 		os.Exit(0)
 	}
 
+	if flags.dryRun {
+		dryRun()
+		os.Exit(0)
+	}
+
+	if flags.readOnly {
+		checkZipLocation()
+		readOnlyErr := enableReadOnlyMode()
+		if readOnlyErr != nil {
+			fmt.Println(readOnlyErr)
+			WriteErrorLog(readOnlyErr.Error(), "")
+			if debugModeEnabled {
+				WriteDebugLog(readOnlyErr.Error(), "ERROR")
+			}
+			os.Exit(0)
+		}
+	}
+
+	// libraries can run commands when they are loaded, read-only mode already applies to them
+	librariesErr := loadJsLibraries()
+	if librariesErr != nil {
+		fmt.Println(librariesErr)
+		WriteErrorLog(librariesErr.Error(), "")
+		if debugModeEnabled {
+			WriteDebugLog(librariesErr.Error(), "ERROR")
+		}
+		os.Exit(0)
+	}
+
+	startAudit := 0
+	if flags.resume {
+		var resumeErr error
+		startAudit, resumeErr = prepareResume()
+		if resumeErr != nil {
+			fmt.Println(resumeErr)
+			WriteErrorLog(resumeErr.Error(), "")
+			if debugModeEnabled {
+				WriteDebugLog(resumeErr.Error(), "ERROR")
+			}
+			os.Exit(0)
+		}
+	}
+
 	allAuditLength := len(GetBigAudits())
+	interruptedAudit := -1
+	handleInterrupts()
 
 	for i, v := range GetBigAudits() {
+		if i < startAudit {
+			continue
+		}
+		if isInterrupted() {
+			interruptedAudit = i
+			break
+		}
 		bigAudit = v
 
 		if flags.verbose {
@@ -224,8 +304,15 @@ func main() {
 		}
 
 		dontSaveArtefact = bigAudit.DontSaveArtefact
+		prepareCheckRuntime(bigAudit)
 		executeErr := runCommand()
 
+		// results of an interrupted audit step are incomplete, it runs again on -resume
+		if isInterrupted() {
+			interruptedAudit = i
+			break
+		}
+
 		// typeExpected = "" gets defaulted to the standard compare
 		if bigAudit.TypeExpected == "" {
 			bigAudit.TypeExpected = "=="
@@ -240,6 +327,8 @@ func main() {
 				if len(errStringSplit) > 1 {
 					errString = removeSuffix(errStringSplit[1])
 					WriteResultJSON(v, false, false, output, errString, bigAudit.TypeExpected)
+				} else if isReportableError(errString) {
+					WriteResultJSON(v, false, false, output, errString, bigAudit.TypeExpected)
 				} else {
 					WriteResultJSON(v, false, false, output, "command not executed", bigAudit.TypeExpected)
 				}
@@ -250,6 +339,8 @@ func main() {
 
 			}
 			auditResult = false
+		} else if checkResult.Status != "" {
+			writeCheckResult(v)
 		} else {
 			if debugModeEnabled {
 				WriteDebugLog(bigAudit.Name+" command was executed", "INFO")
@@ -276,13 +367,27 @@ func main() {
 			}
 		}
 		if flags.verbose {
-			printCommandResult(auditResult)
+			if checkResult.Status == resultSkipped {
+				printCommandSkipped()
+			} else {
+				printCommandResult(auditResult)
+			}
 		}
 
 	}
+	stopHandlingInterrupts()
 
-	//create zip for output
-	checkZipLocation()
+	if interruptedAudit >= 0 {
+		finishInterruptedAudit(interruptedAudit, GetBigAudits()[interruptedAudit])
+	} else {
+		deleteFile(checkpointPath)
+	}
+	WriteRunMetadata()
+
+	//create zip for output, read-only mode already created it
+	if !flags.readOnly {
+		checkZipLocation()
+	}
 	err := ZipFiles(zipLocation, GetAllFilesInOutput())
 	if err != nil {
 		WriteErrorLog(err.Error(), "")
@@ -473,26 +578,9 @@ func compareOutput(audit BigAudit) (bool, error) {
 // run command in JavaScript
 func runCommand() error {
 
-	cmd := bigAudit.Command
-
-	cmd = strings.ReplaceAll(cmd, "\\", "\\\\")
-	cmd = strings.ReplaceAll(cmd, "`", "\\'")
-	cmd = removeWhitespacePrefix(cmd)
-
-	if len(cmd) == 0 {
-		return errors.New("cannot execute command")
-	}
-
-	commandType := strings.Fields(cmd)[0]
-
-	for _, v := range SupportedCommands {
-		if strings.EqualFold(v, commandType) {
-			cmd = "call('" + cmd + "')"
-			if debugModeEnabled {
-				WriteDebugLog(bigAudit.Name+".Command surrounded with "+cmd, "INFO")
-			}
-			break
-		}
+	cmd, err := javaScriptOfAudit(bigAudit)
+	if err != nil {
+		return err
 	}
 
 	output = ""
@@ -518,6 +606,42 @@ func runCommand() error {
 	return nil
 }
 
+// commands that start with a supported command are surrounded with call()
+func javaScriptOfAudit(audit BigAudit) (string, error) {
+	cmd := audit.Command
+
+	cmd = strings.ReplaceAll(cmd, "\\", "\\\\")
+	cmd = strings.ReplaceAll(cmd, "`", "\\'")
+	cmd = removeWhitespacePrefix(cmd)
+
+	if len(cmd) == 0 {
+		return "", errors.New("cannot execute command")
+	}
+
+	commandType := strings.Fields(cmd)[0]
+
+	for _, v := range SupportedCommands {
+		if strings.EqualFold(v, commandType) {
+			cmd = "call('" + cmd + "')"
+			if debugModeEnabled {
+				WriteDebugLog(audit.Name+".Command surrounded with "+cmd, "INFO")
+			}
+			break
+		}
+	}
+	return cmd, nil
+}
+
+// errors that explain themselves are written to the result instead of "command not executed"
+func isReportableError(errString string) bool {
+	for _, prefix := range []string{policyViolation, readOnlyViolation, binaryVerificationFailed} {
+		if strings.HasPrefix(errString, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // function returned error or JS Syntax error
 func betterGojaError(err error) string {
 	errString := err.Error()
@@ -525,14 +649,9 @@ func betterGojaError(err error) string {
 		return "SyntaxError: JavaScript"
 	}
 
+	errString = nativeFunctionSuffix.ReplaceAllString(errString, "")
 	if strings.Contains(errString, "GoError:") {
 		errString = strings.ReplaceAll(errString, "GoError:", "")
-		errString = strings.ReplaceAll(errString, " at main.Call (native)", "")
-		errString = strings.ReplaceAll(errString, " at main.CallCompare (native)", "")
-		errString = strings.ReplaceAll(errString, " at main.PrintToConsole (native)", "")
-		errString = strings.ReplaceAll(errString, " at main.CallContains (native)", "")
-		errString = strings.ReplaceAll(errString, " at main.RegQuery (native)", "")
-		errString = strings.ReplaceAll(errString, " at main.Shell (native)", "")
 		errString = removeWhitespacePrefix(errString)
 	}
 	return errString
@@ -546,18 +665,22 @@ func Shell(cmd string) error {
 	var err error
 	var errOut []byte
 
+	if flags.readOnly {
+		return errors.New(readOnlyViolation + "shell() is blocked")
+	}
+
 	if strings.EqualFold(runtime.GOOS, "windows") {
 		cmdSlice := strings.Fields(cmd)
 		helperSlice := []string{GetSystem().Argument}
 		helperSlice = append(helperSlice, cmdSlice...)
 
-		out, err = exec.Command(GetSystem().Shell, helperSlice...).Output()
+		out, err = runTrackedCommand(exec.Command(GetSystem().Shell, helperSlice...), false)
 	} else {
-		out, err = exec.Command(GetSystem().Shell, GetSystem().Argument, cmd).Output()
+		out, err = runTrackedCommand(exec.Command(GetSystem().Shell, GetSystem().Argument, cmd), false)
 	}
 
 	execCmd := exec.Command(GetSystem().Shell, GetSystem().Argument, cmd)
-	errOut, _ = execCmd.CombinedOutput()
+	errOut, _ = runTrackedCommand(execCmd, true)
 	errOut = []byte(removeSuffix(string(errOut)))
 
 	if err != nil {
@@ -617,7 +740,7 @@ func Call(cmd string) error {
 	}
 	for i, v := range wrappedAudits {
 		v.Stderr = &stderr
-		out, _ = v.Output()
+		out, _ = runTrackedCommand(v, false)
 
 		if stderr.String() != "" {
 			pipelineError := audits[i].Command + " failed"
@@ -626,6 +749,10 @@ func Call(cmd string) error {
 			if debugModeEnabled {
 				WriteDebugLog(audits[i].Command+" command cant be executed: "+pipelineError, "ERROR")
 			}
+			violationErr := checkReadOnlyViolation(audits[i].Command, stderr.String())
+			if violationErr != nil {
+				return violationErr
+			}
 			return errors.New(pipelineError)
 		}
 
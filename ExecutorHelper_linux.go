@@ -30,6 +30,9 @@ import (
 // register only linux commands
 func createCommandVM() {
 	VmCommand = goja.New()
+	enableRequire(VmCommand)
+	registerResultAPI(VmCommand)
+	exposeFacts(VmCommand)
 
 	err := VmCommand.Set("call", Call)
 	if err != nil {
@@ -60,4 +63,116 @@ func createCommandVM() {
 		//TODO write to error log
 		fmt.Println(err)
 	}
+	err = VmCommand.Set("readFile", ReadFile)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("readLines", ReadLines)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("stat", Stat)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("exists", Exists)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("listDir", ListDir)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("glob", Glob)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("sshdConfig", SshdConfig)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("pamStack", PamStack)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("sudoers", Sudoers)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("sysctlRuntime", SysctlRuntime)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("sysctlPersisted", SysctlPersisted)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("mounts", Mounts)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("fstab", Fstab)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("users", Users)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("groups", Groups)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("loginDefs", LoginDefs)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("packages", Packages)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("systemdUnit", SystemdUnit)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("listeningSockets", ListeningSockets)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("assertListeners", AssertListeners)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("scheduledJobs", ScheduledJobs)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("scheduledJobFiles", ScheduledJobFiles)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("auditRules", AuditRules)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("assertAuditRules", AssertAuditRules)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("firewall", Firewall)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("parseConfig", ParseConfig)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("bootConfig", BootConfiguration)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("macStatus", MacStatusInfo)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
 }
@@ -105,6 +105,9 @@ func RegQuery(registryPath string, value string) error {
 // registers Windows commands
 func createCommandVM() {
 	VmCommand = goja.New()
+	enableRequire(VmCommand)
+	registerResultAPI(VmCommand)
+	exposeFacts(VmCommand)
 
 	err := VmCommand.Set("call", Call)
 	if err != nil {
@@ -135,4 +138,28 @@ func createCommandVM() {
 	if err != nil {
 		WriteErrorLog(err.Error(), "")
 	}
+	err = VmCommand.Set("readFile", ReadFile)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("readLines", ReadLines)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("stat", Stat)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("exists", Exists)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("listDir", ListDir)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+	err = VmCommand.Set("glob", Glob)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
 }
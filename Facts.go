@@ -0,0 +1,214 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+type OsFacts struct {
+	Id              string   `json:"id"`
+	IdLike          []string `json:"idLike"`
+	Name            string   `json:"name"`
+	Version         string   `json:"version"`
+	VersionId       string   `json:"versionId"`
+	VersionCodename string   `json:"versionCodename"`
+	PrettyName      string   `json:"prettyName"`
+}
+
+type KernelFacts struct {
+	Name    string `json:"name"`
+	Release string `json:"release"`
+	Version string `json:"version"`
+	Machine string `json:"machine"`
+}
+
+type DmiFacts struct {
+	Vendor      string `json:"vendor"`
+	Product     string `json:"product"`
+	Version     string `json:"version"`
+	BoardVendor string `json:"boardVendor"`
+	BiosVendor  string `json:"biosVendor"`
+}
+
+type VirtualizationFacts struct {
+	Vm        string `json:"vm"`
+	Container string `json:"container"`
+}
+
+type InterfaceFacts struct {
+	Name      string   `json:"name"`
+	Mac       string   `json:"mac"`
+	Mtu       int      `json:"mtu"`
+	Up        bool     `json:"up"`
+	Loopback  bool     `json:"loopback"`
+	Addresses []string `json:"addresses"`
+}
+
+// the keys are the same in JavaScript and result.json
+type Facts struct {
+	Hostname       string              `json:"hostname"`
+	Architecture   string              `json:"architecture"`
+	Root           bool                `json:"root"`
+	Os             OsFacts             `json:"os"`
+	Kernel         KernelFacts         `json:"kernel"`
+	Dmi            DmiFacts            `json:"dmi"`
+	Virtualization VirtualizationFacts `json:"virtualization"`
+	Interfaces     []InterfaceFacts    `json:"interfaces"`
+}
+
+var hostFacts *Facts
+
+// files of the host are read below hostRoot, tests point it to a fixture
+var hostRoot string
+
+func init() {
+	hostRoot = "/"
+}
+
+// relative paths are not changed
+func hostPath(path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(hostRoot, path)
+}
+
+// collected once at the start, checks read them from facts instead of calling commands
+func gatherFacts() *Facts {
+	facts := &Facts{
+		Architecture: runtime.GOARCH,
+		Root:         hasAdminPermissions(),
+		Interfaces:   gatherInterfaces(),
+		Os:           OsFacts{IdLike: []string{}},
+	}
+	facts.Hostname, _ = os.Hostname()
+	gatherPlatformFacts(facts)
+
+	if debugModeEnabled {
+		WriteDebugLog("facts gathered for "+facts.Hostname, "INFO")
+	}
+	return facts
+}
+
+// every runtime gets its own copy, a check cannot change the facts of the next one
+func exposeFacts(vm *goja.Runtime) {
+	if hostFacts == nil {
+		return
+	}
+	err := vm.Set("facts", toJavaScriptValue(hostFacts))
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+}
+
+// plain objects with the json names of the fields, every call returns a fresh copy
+func toJavaScriptValue(value interface{}) interface{} {
+	valueAsByteArr, _ := json.Marshal(value)
+	var javaScriptValue interface{}
+	json.Unmarshal(valueAsByteArr, &javaScriptValue)
+	return javaScriptValue
+}
+
+func gatherInterfaces() []InterfaceFacts {
+	interfaceFacts := make([]InterfaceFacts, 0)
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		WriteErrorLog("cannot read network interfaces: "+err.Error(), "")
+		return interfaceFacts
+	}
+	for _, networkInterface := range interfaces {
+		facts := InterfaceFacts{
+			Name:      networkInterface.Name,
+			Mac:       networkInterface.HardwareAddr.String(),
+			Mtu:       networkInterface.MTU,
+			Up:        networkInterface.Flags&net.FlagUp != 0,
+			Loopback:  networkInterface.Flags&net.FlagLoopback != 0,
+			Addresses: []string{},
+		}
+		addresses, _ := networkInterface.Addrs()
+		for _, address := range addresses {
+			facts.Addresses = append(facts.Addresses, address.String())
+		}
+		interfaceFacts = append(interfaceFacts, facts)
+	}
+	return interfaceFacts
+}
+
+// KEY="value" lines like in /etc/os-release
+func parseOsRelease(path string) (OsFacts, bool) {
+	osFacts := OsFacts{IdLike: []string{}}
+	file, err := os.Open(path)
+	if err != nil {
+		return osFacts, false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		separator := strings.Index(line, "=")
+		if line == "" || strings.HasPrefix(line, "#") || separator < 0 {
+			continue
+		}
+		value := strings.Trim(line[separator+1:], `"'`)
+		switch line[:separator] {
+		case "ID":
+			osFacts.Id = value
+		case "ID_LIKE":
+			osFacts.IdLike = strings.Fields(value)
+		case "NAME":
+			osFacts.Name = value
+		case "VERSION":
+			osFacts.Version = value
+		case "VERSION_ID":
+			osFacts.VersionId = value
+		case "VERSION_CODENAME":
+			osFacts.VersionCodename = value
+		case "PRETTY_NAME":
+			osFacts.PrettyName = value
+		}
+	}
+	return osFacts, true
+}
+
+// first line of a file without trailing whitespace, empty if it cannot be read
+func readFirstLine(path string) string {
+	return strings.TrimSpace(strings.SplitN(readFileOrEmpty(path), "\n", 2)[0])
+}
+
+func readFileOrEmpty(path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(content)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// vendors in the DMI data of virtual machines, like systemd-detect-virt
+var dmiVirtualMachines = [][]string{
+	{"KVM", "kvm"},
+	{"OpenStack", "kvm"},
+	{"KubeVirt", "kvm"},
+	{"Amazon EC2", "amazon"},
+	{"QEMU", "qemu"},
+	{"VMware", "vmware"},
+	{"VMW", "vmware"},
+	{"innotek GmbH", "oracle"},
+	{"VirtualBox", "oracle"},
+	{"Oracle Corporation", "oracle"},
+	{"Xen", "xen"},
+	{"Bochs", "bochs"},
+	{"Parallels", "parallels"},
+	{"BHYVE", "bhyve"},
+	{"Hyper-V", "microsoft"},
+	{"Google", "google"},
+}
+
+func gatherPlatformFacts(facts *Facts) {
+	osFacts, found := parseOsRelease(hostPath("/etc/os-release"))
+	if !found {
+		osFacts, _ = parseOsRelease(hostPath("/usr/lib/os-release"))
+	}
+	facts.Os = osFacts
+
+	facts.Kernel = KernelFacts{
+		Name:    readFirstLine(hostPath("/proc/sys/kernel/ostype")),
+		Release: readFirstLine(hostPath("/proc/sys/kernel/osrelease")),
+		Version: readFirstLine(hostPath("/proc/sys/kernel/version")),
+	}
+	var uname unix.Utsname
+	if unix.Uname(&uname) == nil {
+		facts.Kernel.Machine = unix.ByteSliceToString(uname.Machine[:])
+	}
+
+	dmiDir := hostPath("/sys/class/dmi/id")
+	facts.Dmi = DmiFacts{
+		Vendor:      readFirstLine(dmiDir + "/sys_vendor"),
+		Product:     readFirstLine(dmiDir + "/product_name"),
+		Version:     readFirstLine(dmiDir + "/product_version"),
+		BoardVendor: readFirstLine(dmiDir + "/board_vendor"),
+		BiosVendor:  readFirstLine(dmiDir + "/bios_vendor"),
+	}
+
+	facts.Virtualization = VirtualizationFacts{
+		Vm:        detectVirtualMachine(facts.Dmi),
+		Container: detectContainer(facts.Kernel.Release),
+	}
+}
+
+// the same order of checks as systemd-detect-virt --container
+func detectContainer(kernelRelease string) string {
+	if checkPathExists(hostPath("/proc/vz")) && !checkPathExists(hostPath("/proc/bc")) {
+		return "openvz"
+	}
+	if strings.Contains(strings.ToLower(kernelRelease), "microsoft") {
+		return "wsl"
+	}
+	if container := readFirstLine(hostPath("/run/systemd/container")); container != "" {
+		return container
+	}
+	if checkPathExists(hostPath("/run/.containerenv")) {
+		return "podman"
+	}
+	if checkPathExists(hostPath("/.dockerenv")) {
+		return "docker"
+	}
+	// only readable as root
+	environ := readFileOrEmpty(hostPath("/proc/1/environ"))
+	for _, variable := range strings.Split(environ, "\x00") {
+		if strings.HasPrefix(variable, "container=") && variable != "container=" {
+			return strings.TrimPrefix(variable, "container=")
+		}
+	}
+	cgroup := readFileOrEmpty(hostPath("/proc/1/cgroup"))
+	for _, container := range []string{"docker", "lxc", "kubepods"} {
+		if strings.Contains(cgroup, "/"+container) {
+			return container
+		}
+	}
+	return "none"
+}
+
+// DMI vendor first, then the Xen interfaces and the hypervisor flag of the CPU
+func detectVirtualMachine(dmi DmiFacts) string {
+	for _, value := range []string{dmi.Vendor, dmi.Product, dmi.BoardVendor, dmi.BiosVendor} {
+		for _, vm := range dmiVirtualMachines {
+			if strings.HasPrefix(value, vm[0]) {
+				return vm[1]
+			}
+		}
+	}
+	if dmi.Vendor == "Microsoft Corporation" && strings.HasPrefix(dmi.Product, "Virtual Machine") {
+		return "microsoft"
+	}
+	if checkPathExists(hostPath("/proc/xen")) || readFirstLine(hostPath("/sys/hypervisor/type")) == "xen" {
+		return "xen"
+	}
+	for _, line := range strings.Split(readFileOrEmpty(hostPath("/proc/cpuinfo")), "\n") {
+		if strings.HasPrefix(line, "flags") {
+			if strings.Contains(line+" ", " hypervisor ") {
+				return "other"
+			}
+			break
+		}
+	}
+	return "none"
+}
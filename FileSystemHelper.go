@@ -0,0 +1,161 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// file content as string, the file is saved as artefact
+func ReadFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	saveFileArtefact(path, content)
+	return string(content), nil
+}
+
+// file content split in lines, the file is saved as artefact
+func ReadLines(path string) ([]string, error) {
+	content, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.TrimSuffix(content, "\n")
+	if content == "" {
+		return []string{}, nil
+	}
+	return strings.Split(content, "\n"), nil
+}
+
+// mode, owner, size and modification time of a file, symlinks are followed
+func Stat(path string) (map[string]interface{}, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	linkInfo, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := fileInfoToObject(path, fileInfo)
+	result["isSymlink"] = linkInfo.Mode()&os.ModeSymlink != 0
+	addFileOwner(result, fileInfo)
+	return result, nil
+}
+
+func Exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// entries of a directory sorted by name
+func ListDir(path string) ([]map[string]interface{}, error) {
+	fileInfos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]map[string]interface{}, 0)
+	for _, fileInfo := range fileInfos {
+		entries = append(entries, fileInfoToObject(filepath.Join(path, fileInfo.Name()), fileInfo))
+	}
+	return entries, nil
+}
+
+func Glob(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, errors.New("invalid pattern " + pattern)
+	}
+	if matches == nil {
+		return []string{}, nil
+	}
+	return matches, nil
+}
+
+func fileInfoToObject(path string, fileInfo os.FileInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"path":  path,
+		"name":  fileInfo.Name(),
+		"isDir": fileInfo.IsDir(),
+		"size":  fileInfo.Size(),
+		"mode":  fileModeToOctal(fileInfo.Mode()),
+		"mtime": fileInfo.ModTime().UTC().Format(time.RFC3339),
+	}
+}
+
+// permission bits including setuid, setgid and sticky like "4755"
+func fileModeToOctal(mode os.FileMode) string {
+	octal := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		octal |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		octal |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		octal |= 01000
+	}
+	return fmt.Sprintf("%04o", octal)
+}
+
+// files read by JavaScript are saved like the files of call()
+func saveFileArtefact(path string, content []byte) {
+	if dontSaveArtefact || bigAudit.Name == "" {
+		return
+	}
+	if bigAudit.BlackenContent != "" {
+		content = []byte(replaceRegex(bigAudit.BlackenContent, string(content)))
+	}
+
+	createFolderIfNotExist("./output/", "output")
+	createFolderIfNotExist("./output/artefacts/", "artefacts")
+	createFolderIfNotExist("./output/artefacts/"+bigAudit.Name+"/", bigAudit.Name)
+
+	err := fileWriter(string(content), "artefacts/"+bigAudit.Name+"/"+fileArtefactName(path), false)
+	if err != nil {
+		WriteErrorLog("cannot save artefact for: "+path, bigAudit.Name)
+		if debugModeEnabled {
+			WriteDebugLog(bigAudit.Name+" cannot save artefact "+err.Error(), "ERROR")
+		}
+		return
+	}
+	WriteLog("artefact "+bigAudit.Name+" successfully saved", "INFO")
+}
+
+// /etc/ssh/sshd_config is saved as etc_ssh_sshd_config
+func fileArtefactName(path string) string {
+	path = filepath.ToSlash(filepath.Clean(path))
+	path = strings.TrimPrefix(path, filepath.VolumeName(path))
+	path = strings.TrimLeft(path, "/")
+	return strings.NewReplacer("/", "_", ":", "_").Replace(path)
+}
@@ -0,0 +1,726 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// one model for iptables, nftables and firewalld, backends that are not in use have no tables
+type FirewallRuleset struct {
+	Backends    []string        `json:"backends"`
+	Tables      []FirewallTable `json:"tables"`
+	DefaultZone string          `json:"defaultZone"`
+	Errors      []string        `json:"errors"`
+}
+
+type FirewallTable struct {
+	Backend string          `json:"backend"`
+	Family  string          `json:"family"`
+	Name    string          `json:"name"`
+	Chains  []FirewallChain `json:"chains"`
+}
+
+// base chains have a hook (e.g. "input") and a policy, zones of firewalld also have interfaces and sources
+type FirewallChain struct {
+	Name       string         `json:"name"`
+	Type       string         `json:"type"`
+	Hook       string         `json:"hook"`
+	Policy     string         `json:"policy"`
+	Default    bool           `json:"default,omitempty"`
+	Interfaces []string       `json:"interfaces,omitempty"`
+	Sources    []string       `json:"sources,omitempty"`
+	Rules      []FirewallRule `json:"rules"`
+}
+
+// negated matches start with "!", port ranges are written as "1000-2000"
+type FirewallRule struct {
+	Action           string   `json:"action"`
+	Target           string   `json:"target"`
+	Protocol         string   `json:"protocol"`
+	Source           string   `json:"source"`
+	Destination      string   `json:"destination"`
+	InInterface      string   `json:"inInterface"`
+	OutInterface     string   `json:"outInterface"`
+	DestinationPorts string   `json:"destinationPorts"`
+	SourcePorts      string   `json:"sourcePorts"`
+	States           []string `json:"states"`
+	Service          string   `json:"service,omitempty"`
+	Comment          string   `json:"comment,omitempty"`
+	Text             string   `json:"text"`
+}
+
+type firewalldZone struct {
+	Target      string              `xml:"target,attr"`
+	Interfaces  []firewalldName     `xml:"interface"`
+	Sources     []firewalldAddress  `xml:"source"`
+	Services    []firewalldName     `xml:"service"`
+	Ports       []firewalldPort     `xml:"port"`
+	Protocols   []firewalldProtocol `xml:"protocol"`
+	SourcePorts []firewalldPort     `xml:"source-port"`
+	RichRules   []firewalldRichRule `xml:"rule"`
+}
+
+type firewalldName struct {
+	Name string `xml:"name,attr"`
+}
+
+type firewalldAddress struct {
+	Address string `xml:"address,attr"`
+	Ipset   string `xml:"ipset,attr"`
+	Mac     string `xml:"mac,attr"`
+	Invert  string `xml:"invert,attr"`
+}
+
+type firewalldPort struct {
+	Port     string `xml:"port,attr"`
+	Protocol string `xml:"protocol,attr"`
+}
+
+type firewalldProtocol struct {
+	Value string `xml:"value,attr"`
+}
+
+type firewalldRichRule struct {
+	Source      *firewalldAddress  `xml:"source"`
+	Destination *firewalldAddress  `xml:"destination"`
+	Service     *firewalldName     `xml:"service"`
+	Port        *firewalldPort     `xml:"port"`
+	SourcePort  *firewalldPort     `xml:"source-port"`
+	Protocol    *firewalldProtocol `xml:"protocol"`
+	Accept      *struct{}          `xml:"accept"`
+	Reject      *struct{}          `xml:"reject"`
+	Drop        *struct{}          `xml:"drop"`
+	Log         *struct{}          `xml:"log"`
+}
+
+type firewalldService struct {
+	Ports []firewalldPort `xml:"port"`
+}
+
+// a zone or service in /etc replaces the one with the same name of the package
+var firewalldZoneDirectories = []string{"/etc/firewalld/zones", "/usr/lib/firewalld/zones"}
+var firewalldServiceDirectories = []string{"/etc/firewalld/services", "/usr/lib/firewalld/services"}
+
+const firewalldConfFile = "/etc/firewalld/firewalld.conf"
+
+var iptablesHooks = map[string]string{"INPUT": "input", "FORWARD": "forward", "OUTPUT": "output", "PREROUTING": "prerouting", "POSTROUTING": "postrouting"}
+
+// verdicts of nftables, other statements like counter do not change the action
+var nftVerdicts = []string{"accept", "drop", "reject", "return", "jump", "goto", "queue", "masquerade", "snat", "dnat", "redirect"}
+
+// commands that list the running rules, also planned by -dry-run
+var iptablesSaveCommands = map[string]string{"ip": "iptables-save", "ip6": "ip6tables-save"}
+
+const nftListCommand = "nft -j list ruleset"
+
+// running rules of iptables-save, ip6tables-save and "nft -j list ruleset" and the zones of firewalld
+func Firewall() (interface{}, error) {
+	ruleset := FirewallRuleset{Backends: []string{}, Tables: []FirewallTable{}, Errors: []string{}}
+
+	for _, family := range []string{"ip", "ip6"} {
+		content, err := callFirewallCommand(iptablesSaveCommands[family])
+		if err != nil {
+			ruleset.Errors = append(ruleset.Errors, err.Error())
+			continue
+		}
+		tables, err := parseIptablesSave(content, family)
+		if err != nil {
+			ruleset.Errors = append(ruleset.Errors, err.Error())
+			continue
+		}
+		addFirewallTables(&ruleset, "iptables", tables)
+	}
+
+	content, err := callFirewallCommand(nftListCommand)
+	if err == nil {
+		var tables []FirewallTable
+		tables, err = parseNftJson(content)
+		addFirewallTables(&ruleset, "nftables", tables)
+	}
+	if err != nil {
+		ruleset.Errors = append(ruleset.Errors, err.Error())
+	}
+
+	// the package installs the zones, they only filter while the daemon runs
+	if !isFirewalldRunning() {
+		return toJavaScriptValue(ruleset), nil
+	}
+	table, defaultZone, err := readFirewalldZones()
+	if err != nil {
+		return nil, err
+	}
+	if len(table.Chains) > 0 {
+		ruleset.DefaultZone = defaultZone
+		addFirewallTables(&ruleset, "firewalld", []FirewallTable{table})
+	}
+	return toJavaScriptValue(ruleset), nil
+}
+
+// the unit starts firewalld with --nopid, so the process is looked up instead of a pid file
+func isFirewalldRunning() bool {
+	for _, pid := range processIds() {
+		if processCommand(pid) == "firewalld" {
+			return true
+		}
+	}
+	return false
+}
+
+// runs the command like call(), output keeps the value of the check
+// iptables-save warns about legacy or nft tables on stderr but still prints the rules
+func callFirewallCommand(command string) (string, error) {
+	previousOutput := output
+	defer func() { output = previousOutput }()
+	output = ""
+	if err := Call(command); err != nil {
+		if output == "" {
+			return "", errors.New("firewall: " + err.Error())
+		}
+		WriteLog("firewall: "+command+" printed warnings, the rules are read anyway", "WARN")
+	}
+	return output, nil
+}
+
+func addFirewallTables(ruleset *FirewallRuleset, backend string, tables []FirewallTable) {
+	if len(tables) == 0 {
+		return
+	}
+	ruleset.Tables = append(ruleset.Tables, tables...)
+	for _, existing := range ruleset.Backends {
+		if existing == backend {
+			return
+		}
+	}
+	ruleset.Backends = append(ruleset.Backends, backend)
+}
+
+// "*filter" starts a table, ":INPUT DROP [0:0]" declares a chain and "-A INPUT ..." adds a rule
+func parseIptablesSave(content string, family string) ([]FirewallTable, error) {
+	var tables []FirewallTable
+	var table *FirewallTable
+	for number, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || line == "COMMIT" {
+			continue
+		}
+		lineError := "firewall: iptables-save line " + strconv.Itoa(number+1) + ": "
+		if strings.HasPrefix(line, "*") {
+			tables = append(tables, FirewallTable{Backend: "iptables", Family: family, Name: line[1:], Chains: []FirewallChain{}})
+			table = &tables[len(tables)-1]
+			continue
+		}
+		if table == nil {
+			return nil, errors.New(lineError + "no table before " + line)
+		}
+		if strings.HasPrefix(line, ":") {
+			fields := strings.Fields(line[1:])
+			if len(fields) == 0 {
+				return nil, errors.New(lineError + "missing chain name")
+			}
+			chain := FirewallChain{Name: fields[0], Type: table.Name, Hook: iptablesHooks[fields[0]], Rules: []FirewallRule{}}
+			if len(fields) > 1 && fields[1] != "-" {
+				chain.Policy = strings.ToLower(fields[1])
+			}
+			table.Chains = append(table.Chains, chain)
+			continue
+		}
+
+		arguments, err := splitIptablesLine(line)
+		if err != nil {
+			return nil, errors.New(lineError + err.Error())
+		}
+		if len(arguments) < 2 || (arguments[0] != "-A" && arguments[0] != "-I") {
+			return nil, errors.New(lineError + "unknown command " + arguments[0])
+		}
+		chainIndex := -1
+		for i, chain := range table.Chains {
+			if chain.Name == arguments[1] {
+				chainIndex = i
+			}
+		}
+		if chainIndex < 0 {
+			return nil, errors.New(lineError + "unknown chain " + arguments[1])
+		}
+		rule := parseIptablesRule(arguments[2:], table.Chains)
+		rule.Text = line
+		table.Chains[chainIndex].Rules = append(table.Chains[chainIndex].Rules, rule)
+	}
+	return tables, nil
+}
+
+// arguments split at spaces, "--comment "a b"" stays one argument
+func splitIptablesLine(line string) ([]string, error) {
+	var arguments []string
+	rest := line
+	for rest != "" {
+		var argument string
+		if strings.HasPrefix(rest, "\"") {
+			end := strings.Index(rest[1:], "\"")
+			if end < 0 {
+				return nil, errors.New("unterminated quote")
+			}
+			argument = rest[1 : end+1]
+			rest = rest[end+2:]
+		} else {
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			argument = rest[:end]
+			rest = rest[end:]
+		}
+		arguments = append(arguments, argument)
+		rest = strings.TrimLeft(rest, " \t")
+	}
+	return arguments, nil
+}
+
+// options the model does not know (e.g. --limit) are only kept in the text of the rule
+func parseIptablesRule(arguments []string, chains []FirewallChain) FirewallRule {
+	rule := FirewallRule{States: []string{}}
+	negated := ""
+	for i := 0; i < len(arguments); i++ {
+		option := arguments[i]
+		if option == "!" {
+			negated = "!"
+			continue
+		}
+		value := ""
+		if i+1 < len(arguments) {
+			value = arguments[i+1]
+		}
+		switch option {
+		case "-p", "--protocol":
+			rule.Protocol = negated + value
+		case "-s", "--source":
+			rule.Source = negated + value
+		case "-d", "--destination":
+			rule.Destination = negated + value
+		case "-i", "--in-interface":
+			rule.InInterface = negated + value
+		case "-o", "--out-interface":
+			rule.OutInterface = negated + value
+		case "--dport", "--dports", "--destination-port", "--destination-ports":
+			rule.DestinationPorts = negated + strings.ReplaceAll(value, ":", "-")
+		case "--sport", "--sports", "--source-port", "--source-ports":
+			rule.SourcePorts = negated + strings.ReplaceAll(value, ":", "-")
+		case "--state", "--ctstate":
+			for _, state := range strings.Split(strings.ToLower(value), ",") {
+				rule.States = append(rule.States, negated+state)
+			}
+		case "--comment":
+			rule.Comment = value
+		case "-j", "--jump", "-g", "--goto":
+			rule.Action = strings.ToLower(value)
+			for _, chain := range chains {
+				if chain.Name == value {
+					rule.Action = "jump"
+					if option == "-g" || option == "--goto" {
+						rule.Action = "goto"
+					}
+					rule.Target = value
+				}
+			}
+		default:
+			// options the model does not have, flags like --syn have no value
+			if value != "" && value != "!" && !strings.HasPrefix(value, "-") {
+				i++
+			}
+			negated = ""
+			continue
+		}
+		negated = ""
+		i++
+	}
+	return rule
+}
+
+// objects of "nft -j list ruleset" in the order nft lists them, tables come before their chains and rules
+func parseNftJson(content string) ([]FirewallTable, error) {
+	var ruleset struct {
+		Nftables []map[string]json.RawMessage `json:"nftables"`
+	}
+	if err := json.Unmarshal([]byte(content), &ruleset); err != nil {
+		return nil, errors.New("firewall: nft returned no valid JSON: " + err.Error())
+	}
+
+	var tables []FirewallTable
+	findTable := func(family string, name string) *FirewallTable {
+		for i := range tables {
+			if tables[i].Family == family && tables[i].Name == name {
+				return &tables[i]
+			}
+		}
+		return nil
+	}
+	for _, object := range ruleset.Nftables {
+		switch {
+		case object["table"] != nil:
+			var table struct {
+				Family string `json:"family"`
+				Name   string `json:"name"`
+			}
+			if err := json.Unmarshal(object["table"], &table); err != nil {
+				return nil, errors.New("firewall: invalid nft table: " + err.Error())
+			}
+			tables = append(tables, FirewallTable{Backend: "nftables", Family: table.Family, Name: table.Name, Chains: []FirewallChain{}})
+		case object["chain"] != nil:
+			var chain struct {
+				Family string `json:"family"`
+				Table  string `json:"table"`
+				Name   string `json:"name"`
+				Type   string `json:"type"`
+				Hook   string `json:"hook"`
+				Policy string `json:"policy"`
+			}
+			if err := json.Unmarshal(object["chain"], &chain); err != nil {
+				return nil, errors.New("firewall: invalid nft chain: " + err.Error())
+			}
+			table := findTable(chain.Family, chain.Table)
+			if table == nil {
+				return nil, errors.New("firewall: nft chain " + chain.Name + " of unknown table " + chain.Table)
+			}
+			table.Chains = append(table.Chains, FirewallChain{Name: chain.Name, Type: chain.Type, Hook: chain.Hook, Policy: chain.Policy, Rules: []FirewallRule{}})
+		case object["rule"] != nil:
+			var rule struct {
+				Family     string                   `json:"family"`
+				Table      string                   `json:"table"`
+				Chain      string                   `json:"chain"`
+				Comment    string                   `json:"comment"`
+				Expression []map[string]interface{} `json:"expr"`
+			}
+			if err := json.Unmarshal(object["rule"], &rule); err != nil {
+				return nil, errors.New("firewall: invalid nft rule: " + err.Error())
+			}
+			table := findTable(rule.Family, rule.Table)
+			if table == nil {
+				return nil, errors.New("firewall: nft rule of unknown table " + rule.Table)
+			}
+			for i := range table.Chains {
+				if table.Chains[i].Name == rule.Chain {
+					firewallRule := parseNftRule(rule.Expression)
+					firewallRule.Comment = rule.Comment
+					table.Chains[i].Rules = append(table.Chains[i].Rules, firewallRule)
+				}
+			}
+		}
+	}
+	return tables, nil
+}
+
+// the statements of a rule, the text is the JSON of the expression
+func parseNftRule(expression []map[string]interface{}) FirewallRule {
+	rule := FirewallRule{States: []string{}}
+	text, _ := json.Marshal(expression)
+	rule.Text = string(text)
+	logged := false
+	for _, statement := range expression {
+		if match, ok := statement["match"].(map[string]interface{}); ok {
+			applyNftMatch(&rule, match)
+			continue
+		}
+		if _, ok := statement["log"]; ok {
+			logged = true
+		}
+		for _, verdict := range nftVerdicts {
+			value, ok := statement[verdict]
+			if !ok {
+				continue
+			}
+			rule.Action = verdict
+			if target, ok := value.(map[string]interface{}); ok && (verdict == "jump" || verdict == "goto") {
+				rule.Target, _ = target["target"].(string)
+			}
+		}
+	}
+	if rule.Action == "" && logged {
+		rule.Action = "log"
+	}
+	return rule
+}
+
+func applyNftMatch(rule *FirewallRule, match map[string]interface{}) {
+	value := nftValue(match["right"])
+	if operator, _ := match["op"].(string); operator == "!=" {
+		value = "!" + value
+	}
+	left, _ := match["left"].(map[string]interface{})
+	if meta, ok := left["meta"].(map[string]interface{}); ok {
+		switch meta["key"] {
+		case "iifname", "iif":
+			rule.InInterface = value
+		case "oifname", "oif":
+			rule.OutInterface = value
+		case "l4proto":
+			rule.Protocol = value
+		}
+	}
+	if payload, ok := left["payload"].(map[string]interface{}); ok {
+		switch payload["field"] {
+		case "saddr":
+			rule.Source = value
+		case "daddr":
+			rule.Destination = value
+		case "dport":
+			rule.Protocol, _ = payload["protocol"].(string)
+			rule.DestinationPorts = value
+		case "sport":
+			rule.Protocol, _ = payload["protocol"].(string)
+			rule.SourcePorts = value
+		case "protocol", "nexthdr":
+			rule.Protocol = value
+		}
+	}
+	if ct, ok := left["ct"].(map[string]interface{}); ok && ct["key"] == "state" {
+		negated := strings.HasPrefix(value, "!")
+		for _, state := range strings.Split(strings.TrimPrefix(value, "!"), ",") {
+			if negated {
+				state = "!" + state
+			}
+			rule.States = append(rule.States, state)
+		}
+	}
+}
+
+// sets are joined with ",", ranges with "-" and prefixes are written as address/length
+func nftValue(value interface{}) string {
+	switch typed := value.(type) {
+	case string:
+		return typed
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	case []interface{}:
+		var values []string
+		for _, item := range typed {
+			values = append(values, nftValue(item))
+		}
+		return strings.Join(values, ",")
+	case map[string]interface{}:
+		if set, ok := typed["set"]; ok {
+			return nftValue(set)
+		}
+		if bounds, ok := typed["range"].([]interface{}); ok && len(bounds) == 2 {
+			return nftValue(bounds[0]) + "-" + nftValue(bounds[1])
+		}
+		if prefix, ok := typed["prefix"].(map[string]interface{}); ok {
+			return nftValue(prefix["addr"]) + "/" + nftValue(prefix["len"])
+		}
+	}
+	text, _ := json.Marshal(value)
+	return string(text)
+}
+
+// every zone is an input chain with the target as policy, firewalld always accepts loopback and established traffic
+func readFirewalldZones() (FirewallTable, string, error) {
+	table := FirewallTable{Backend: "firewalld", Family: "inet", Name: "firewalld", Chains: []FirewallChain{}}
+	defaultZone := firewalldDefaultZone()
+
+	for _, name := range firewalldFiles(firewalldZoneDirectories) {
+		path := firewalldFile(firewalldZoneDirectories, name)
+		content, err := ioutil.ReadFile(hostPath(path))
+		if err != nil {
+			return table, defaultZone, errors.New("firewall: cannot read " + path)
+		}
+		saveFileArtefact(hostPath(path), content)
+		var zone firewalldZone
+		if err := xml.Unmarshal(content, &zone); err != nil {
+			return table, defaultZone, errors.New("firewall: " + path + ": " + err.Error())
+		}
+
+		chain := FirewallChain{Name: strings.TrimSuffix(name, ".xml"), Type: "filter", Hook: "input", Policy: firewalldPolicy(zone.Target), Interfaces: []string{}, Sources: []string{}}
+		chain.Default = chain.Name == defaultZone
+		for _, zoneInterface := range zone.Interfaces {
+			chain.Interfaces = append(chain.Interfaces, zoneInterface.Name)
+		}
+		for _, source := range zone.Sources {
+			chain.Sources = append(chain.Sources, firewalldAddressText(source))
+		}
+		chain.Rules = []FirewallRule{
+			{Action: "accept", InInterface: "lo", States: []string{}, Text: "implicit: loopback"},
+			{Action: "accept", States: []string{"established", "related"}, Text: "implicit: established"},
+		}
+		for _, service := range zone.Services {
+			chain.Rules = append(chain.Rules, firewalldServiceRules(service.Name, FirewallRule{Action: "accept"})...)
+		}
+		for _, port := range zone.Ports {
+			chain.Rules = append(chain.Rules, FirewallRule{Action: "accept", Protocol: port.Protocol, DestinationPorts: port.Port, States: []string{}, Text: "port " + port.Port + "/" + port.Protocol})
+		}
+		for _, port := range zone.SourcePorts {
+			chain.Rules = append(chain.Rules, FirewallRule{Action: "accept", Protocol: port.Protocol, SourcePorts: port.Port, States: []string{}, Text: "source-port " + port.Port + "/" + port.Protocol})
+		}
+		for _, protocol := range zone.Protocols {
+			chain.Rules = append(chain.Rules, FirewallRule{Action: "accept", Protocol: protocol.Value, States: []string{}, Text: "protocol " + protocol.Value})
+		}
+		for _, richRule := range zone.RichRules {
+			chain.Rules = append(chain.Rules, firewalldRichRuleToRules(richRule)...)
+		}
+		table.Chains = append(table.Chains, chain)
+	}
+	return table, defaultZone, nil
+}
+
+// DefaultZone of firewalld.conf, firewalld uses public without it
+func firewalldDefaultZone() string {
+	content, err := ioutil.ReadFile(hostPath(firewalldConfFile))
+	if err != nil {
+		return "public"
+	}
+	defaultZone := "public"
+	for _, line := range strings.Split(string(content), "\n") {
+		keyValue := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(keyValue) == 2 && keyValue[0] == "DefaultZone" && keyValue[1] != "" {
+			defaultZone = keyValue[1]
+		}
+	}
+	return defaultZone
+}
+
+// names of the xml files of all directories sorted
+func firewalldFiles(directories []string) []string {
+	found := make(map[string]bool)
+	for _, directory := range directories {
+		matches, _ := filepath.Glob(filepath.Join(hostPath(directory), "*.xml"))
+		for _, match := range matches {
+			found[filepath.Base(match)] = true
+		}
+	}
+	var names []string
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// path of the file in the first directory that has it
+func firewalldFile(directories []string, name string) string {
+	for _, directory := range directories {
+		path := filepath.Join(directory, name)
+		if _, err := os.Stat(hostPath(path)); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// the target "default" rejects like %%REJECT%%
+func firewalldPolicy(target string) string {
+	switch target {
+	case "", "default", "%%REJECT%%", "REJECT":
+		return "reject"
+	}
+	return strings.ToLower(target)
+}
+
+func firewalldAddressText(address firewalldAddress) string {
+	text := address.Address
+	if address.Ipset != "" {
+		text = "ipset:" + address.Ipset
+	}
+	if address.Mac != "" {
+		text = address.Mac
+	}
+	if strings.EqualFold(address.Invert, "true") || strings.EqualFold(address.Invert, "yes") {
+		text = "!" + text
+	}
+	return text
+}
+
+// one rule per port of the service, a service without a definition keeps only its name
+func firewalldServiceRules(name string, template FirewallRule) []FirewallRule {
+	template.Service = name
+	template.States = []string{}
+	template.Text = "service " + name
+	path := firewalldFile(firewalldServiceDirectories, name+".xml")
+	if path == "" {
+		return []FirewallRule{template}
+	}
+	content, err := ioutil.ReadFile(hostPath(path))
+	var service firewalldService
+	if err != nil || xml.Unmarshal(content, &service) != nil || len(service.Ports) == 0 {
+		return []FirewallRule{template}
+	}
+	var rules []FirewallRule
+	for _, port := range service.Ports {
+		rule := template
+		rule.Protocol = port.Protocol
+		rule.DestinationPorts = port.Port
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func firewalldRichRuleToRules(richRule firewalldRichRule) []FirewallRule {
+	rule := FirewallRule{States: []string{}, Text: "rule"}
+	switch {
+	case richRule.Accept != nil:
+		rule.Action = "accept"
+	case richRule.Reject != nil:
+		rule.Action = "reject"
+	case richRule.Drop != nil:
+		rule.Action = "drop"
+	case richRule.Log != nil:
+		rule.Action = "log"
+	}
+	if richRule.Source != nil {
+		rule.Source = firewalldAddressText(*richRule.Source)
+		rule.Text += " source " + rule.Source
+	}
+	if richRule.Destination != nil {
+		rule.Destination = firewalldAddressText(*richRule.Destination)
+		rule.Text += " destination " + rule.Destination
+	}
+	if richRule.Protocol != nil {
+		rule.Protocol = richRule.Protocol.Value
+		rule.Text += " protocol " + rule.Protocol
+	}
+	if richRule.SourcePort != nil {
+		rule.Protocol = richRule.SourcePort.Protocol
+		rule.SourcePorts = richRule.SourcePort.Port
+		rule.Text += " source-port " + rule.SourcePorts + "/" + rule.Protocol
+	}
+	if richRule.Port != nil {
+		rule.Protocol = richRule.Port.Protocol
+		rule.DestinationPorts = richRule.Port.Port
+		rule.Text += " port " + rule.DestinationPorts + "/" + rule.Protocol
+	}
+	if rule.Action != "" {
+		rule.Text += " " + rule.Action
+	}
+	if richRule.Service != nil {
+		rules := firewalldServiceRules(richRule.Service.Name, rule)
+		for i := range rules {
+			rules[i].Text = strings.Replace(rule.Text, "rule", "rule service "+richRule.Service.Name, 1)
+		}
+		return rules
+	}
+	return []FirewallRule{rule}
+}
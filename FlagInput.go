@@ -30,12 +30,16 @@ import (
 type Flags struct {
 	input         string
 	output        string
+	pin           string
 	addedCommands []string
 	verbose       bool
 	debug         bool
 	skipSanity    bool
 	help          bool
 	encryptZip    bool
+	readOnly      bool
+	resume        bool
+	dryRun        bool
 }
 
 var flags Flags
@@ -49,11 +53,15 @@ func initFlags() error {
 	input := flag.String("input", "", "specify config file")
 	output := flag.String("output", "", "specify output file")
 	add := flag.String("add", "", "add specific commands")
+	pin := flag.String("pin", "", "specify pin file for binaries")
+	resume := flag.Bool("resume", false, "resume interrupted audit")
 	verbose := flag.Bool("v", false, "toggle verbose mode")
 	debug := flag.Bool("debug", false, "toggle debug mode")
 	skipSanity := flag.Bool("s", false, "skip sanity check")
 	help := flag.Bool("h", false, "help")
 	encryptZip := flag.Bool("p", false, "encrypt Zip")
+	readOnly := flag.Bool("readonly", false, "block writes of executed commands")
+	dryRun := flag.Bool("dry-run", false, "show what would be executed")
 	flag.Parse()
 
 	var commands []string
@@ -71,5 +79,9 @@ func initFlags() error {
 	flags.verbose, flags.skipSanity, flags.help = *verbose, *skipSanity, *help
 	flags.debug = *debug
 	flags.encryptZip = *encryptZip
+	flags.readOnly = *readOnly
+	flags.pin = *pin
+	flags.resume = *resume
+	flags.dryRun = *dryRun
 	return nil
 }
@@ -0,0 +1,194 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+type Checkpoint struct {
+	Config    string `json:"config"`
+	NextAudit int    `json:"nextAudit"`
+	AuditName string `json:"auditName"`
+}
+
+const checkpointPath = "./output/checkpoint.json"
+
+var interrupted bool
+var runningCommand *exec.Cmd
+var interruptLock sync.Mutex
+var interruptSignals chan os.Signal
+
+// Ctrl-C and SIGTERM stop the audit after the current command was killed
+func handleInterrupts() {
+	interruptLock.Lock()
+	interrupted = false
+	interruptLock.Unlock()
+
+	interruptSignals = make(chan os.Signal, 1)
+	signal.Notify(interruptSignals, os.Interrupt, syscall.SIGTERM)
+	go func(signals chan os.Signal) {
+		receivedSignal, ok := <-signals
+		if ok {
+			interruptAudit(receivedSignal.String())
+		}
+	}(interruptSignals)
+}
+
+// a second signal after the audit loop ends the tool immediately
+func stopHandlingInterrupts() {
+	signal.Stop(interruptSignals)
+	close(interruptSignals)
+}
+
+func interruptAudit(reason string) {
+	interruptLock.Lock()
+	defer interruptLock.Unlock()
+
+	interrupted = true
+	if VmCommand != nil {
+		VmCommand.Interrupt(reason)
+	}
+	if runningCommand != nil && runningCommand.Process != nil {
+		killCommand(runningCommand)
+	}
+}
+
+func isInterrupted() bool {
+	interruptLock.Lock()
+	defer interruptLock.Unlock()
+	return interrupted
+}
+
+// runs a command that gets killed if the audit is interrupted, it is started under the lock
+// so an interrupt either comes before it or finds its process
+func runTrackedCommand(cmd *exec.Cmd, combinedOutput bool) ([]byte, error) {
+	var out bytes.Buffer
+	if cmd.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	cmd.Stdout = &out
+	if combinedOutput {
+		if cmd.Stderr != nil {
+			return nil, errors.New("exec: Stderr already set")
+		}
+		cmd.Stderr = &out
+	}
+
+	interruptLock.Lock()
+	if interrupted {
+		interruptLock.Unlock()
+		return nil, errors.New("audit interrupted")
+	}
+	prepareCommandForInterrupt(cmd)
+	if err := cmd.Start(); err != nil {
+		interruptLock.Unlock()
+		return nil, err
+	}
+	runningCommand = cmd
+	interruptLock.Unlock()
+
+	err := cmd.Wait()
+
+	interruptLock.Lock()
+	runningCommand = nil
+	interruptLock.Unlock()
+	return out.Bytes(), err
+}
+
+// keeps the collected results and saves where to continue with -resume
+func finishInterruptedAudit(position int, audit BigAudit) {
+	WriteLog(audit.Name+" interrupted, continue with -resume", "WARN")
+	if debugModeEnabled {
+		WriteDebugLog(audit.Name+" interrupted", "WARN")
+	}
+	runMetadata.Interrupted = true
+	runMetadata.InterruptedAt = audit.Name
+
+	checkpoint := Checkpoint{Config: ConfigName, NextAudit: position, AuditName: audit.Name}
+	checkpointAsByteArr, _ := json.MarshalIndent(checkpoint, "", "\t")
+	err := fileWriter(string(checkpointAsByteArr), "checkpoint.json", false)
+	if err != nil {
+		WriteErrorLog("cannot save checkpoint: "+err.Error(), "")
+	}
+	PrintToConsole("\nAudit interrupted at " + audit.Name + ", continue with -resume")
+}
+
+// returns the position of the first audit that has not run and restores the results
+func prepareResume() (int, error) {
+	byteValue, err := ioutil.ReadFile(checkpointPath)
+	if err != nil {
+		return 0, errors.New("no checkpoint to resume from: " + err.Error())
+	}
+
+	var checkpoint Checkpoint
+	if !checkJsonFormat(byteValue, &checkpoint) {
+		return 0, errors.New("checkpoint format incorrect")
+	}
+
+	bigAudits := GetBigAudits()
+	if checkpoint.Config != ConfigName || checkpoint.NextAudit < 0 || checkpoint.NextAudit >= len(bigAudits) ||
+		bigAudits[checkpoint.NextAudit].Name != checkpoint.AuditName {
+		return 0, errors.New("checkpoint does not match the config " + ConfigName)
+	}
+
+	removeRunMetadata()
+	// the interrupted audit may have saved parts of its artefact and some of its file artefacts
+	deleteFile("./output/artefacts/" + checkpoint.AuditName + ".txt")
+	removeErr := os.RemoveAll("./output/artefacts/" + checkpoint.AuditName)
+	if removeErr != nil {
+		WriteErrorLog(removeErr.Error(), "")
+	}
+
+	runMetadata.ResumedAt = checkpoint.AuditName
+	WriteLog("resuming at "+checkpoint.AuditName, "INFO")
+	if debugModeEnabled {
+		WriteDebugLog("resuming at "+checkpoint.AuditName+" ("+getOrdinalNum(checkpoint.NextAudit+1)+" audit)", "INFO")
+	}
+	return checkpoint.NextAudit, nil
+}
+
+// the results have to end with the audit list again before new results are appended
+func removeRunMetadata() {
+	if !checkPathExists("./output/result.json") {
+		return
+	}
+	fileText := getResultJSONContent()
+	metadataPosition := strings.Index(fileText, "\n\t],\n\t\"Run Metadata\": ")
+	if metadataPosition >= 0 {
+		fileText = fileText[:metadataPosition] + "\n\t]\n}"
+	}
+	if strings.HasSuffix(fileText, "[\n\t]\n}") {
+		deleteFile("./output/result.json")
+		return
+	}
+	fileWriter(fileText, "result.json", false)
+}
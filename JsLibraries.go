@@ -0,0 +1,125 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/require"
+)
+
+// keeps the compiled libraries for every runtime of this run
+var jsRegistry *require.Registry
+
+// compiles the jsLibraries of the config once and makes require() available
+func loadJsLibraries() error {
+	jsRegistry = require.NewRegistry(require.WithLoader(loadFromConfigDir))
+	jsRegistry.Enable(VmCommand)
+
+	if err := preloadJsLibraries(VmCommand); err != nil {
+		return err
+	}
+	for _, library := range jsLibraries.Paths {
+		WriteLog("JavaScript library "+library+" loaded", "INFO")
+		if debugModeEnabled {
+			WriteDebugLog("JavaScript library "+library+" loaded", "INFO")
+		}
+	}
+	return nil
+}
+
+// runs the libraries in a runtime, a check sees the globals they set without calling require() itself
+func preloadJsLibraries(vm *goja.Runtime) error {
+	for _, library := range jsLibraries.Paths {
+		_, err := vm.RunString("require(" + quoteJavaScript(libraryModulePath(library)) + ")")
+		if err != nil {
+			return errors.New("JavaScript library " + library + ": " + betterGojaError(err))
+		}
+	}
+	return nil
+}
+
+// require() of a new runtime uses the libraries compiled by loadJsLibraries
+func enableRequire(vm *goja.Runtime) {
+	if jsRegistry != nil {
+		jsRegistry.Enable(vm)
+	}
+}
+
+// require() only reads files inside the directory of the config
+func loadFromConfigDir(modulePath string) ([]byte, error) {
+	path, err := configDirPath(modulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	fileInfo, err := os.Stat(path)
+	if err != nil || fileInfo.IsDir() {
+		return nil, require.ModuleFileDoesNotExistError
+	}
+	return ioutil.ReadFile(path)
+}
+
+func configDirPath(modulePath string) (string, error) {
+	configDir, err := filepath.Abs(filepath.Dir(ConfigName))
+	if err != nil {
+		return "", err
+	}
+	configDir, err = filepath.EvalSymlinks(configDir)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.FromSlash(modulePath)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(configDir, path)
+	}
+	// symlinks must not lead out of the config directory either
+	if resolvedPath, resolveErr := filepath.EvalSymlinks(path); resolveErr == nil {
+		path = resolvedPath
+	}
+	if path != configDir && !strings.HasPrefix(path, configDir+string(filepath.Separator)) {
+		return "", errors.New(modulePath + " is outside of the config directory")
+	}
+	return path, nil
+}
+
+// library paths in the config are relative to the config directory like in require()
+func libraryModulePath(library string) string {
+	if filepath.IsAbs(library) {
+		return filepath.ToSlash(library)
+	}
+	library = filepath.ToSlash(library)
+	if strings.HasPrefix(library, "./") || strings.HasPrefix(library, "../") {
+		return library
+	}
+	return "./" + library
+}
+
+func quoteJavaScript(text string) string {
+	return "'" + strings.NewReplacer("\\", "\\\\", "'", "\\'").Replace(text) + "'"
+}
@@ -0,0 +1,54 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+// values checks with "sharedState": true pass to later checks
+var sharedState map[string]interface{}
+
+func init() {
+	sharedState = make(map[string]interface{})
+}
+
+// every check runs in a new runtime so variables of one check cannot change the next one
+func prepareCheckRuntime(audit BigAudit) {
+	// the interrupt handler must not see a half created runtime
+	interruptLock.Lock()
+	defer interruptLock.Unlock()
+
+	createCommandVM()
+	// the libraries were checked at the start, they only fail here if they depend on earlier checks
+	if jsRegistry != nil {
+		if err := preloadJsLibraries(VmCommand); err != nil {
+			WriteErrorLog(err.Error(), audit.Name)
+		}
+	}
+	if !audit.SharedState {
+		return
+	}
+	err := VmCommand.Set("sharedState", sharedState)
+	if err != nil {
+		WriteErrorLog(err.Error(), audit.Name)
+	}
+	if debugModeEnabled {
+		WriteDebugLog(audit.Name+" uses sharedState", "INFO")
+	}
+}
@@ -0,0 +1,299 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ListeningSocket struct {
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	Pid      int    `json:"pid"`
+	Pids     []int  `json:"pids"`
+	Command  string `json:"command"`
+	Uid      int    `json:"uid"`
+	User     string `json:"user"`
+	Inode    uint64 `json:"inode"`
+}
+
+// entry of the allowlist, empty fields and port 0 match every socket
+type ListenerRule struct {
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	Command  string `json:"command"`
+	User     string `json:"user"`
+}
+
+var listeningProtocols = []string{"tcp", "tcp6", "udp", "udp6"}
+
+const (
+	tcpStateListen = "0A"
+	udpStateClose  = "07"
+)
+
+// the kernel writes the addresses in /proc/net in host byte order
+var bigEndianArchitectures = []string{"s390x", "ppc64", "mips", "mips64", "sparc64"}
+
+// listening TCP sockets and bound UDP sockets with the processes owning them, like "ss -tulpn"
+func ListeningSockets() ([]interface{}, error) {
+	sockets, err := readListeningSockets()
+	if err != nil {
+		return nil, err
+	}
+	return toJavaScriptValue(sockets).([]interface{}), nil
+}
+
+// fails the check if a socket is not in the allowlist, sockets on loopback addresses are only compared with {loopback: true}
+func AssertListeners(allowlist interface{}, options map[string]interface{}) ([]interface{}, error) {
+	var rules []ListenerRule
+	content, _ := json.Marshal(allowlist)
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return nil, errors.New("listeners: the allowlist must be an array of objects")
+	}
+	sockets, err := readListeningSockets()
+	if err != nil {
+		return nil, err
+	}
+	includeLoopback, _ := options["loopback"].(bool)
+
+	unexpected := unexpectedListeners(sockets, rules, includeLoopback)
+	if len(unexpected) == 0 {
+		setCheckStatus(resultPassed, "all listeners are allowed", nil)
+		return []interface{}{}, nil
+	}
+	var descriptions []string
+	for _, socket := range unexpected {
+		descriptions = append(descriptions, describeListener(socket))
+	}
+	details := toJavaScriptValue(unexpected).([]interface{})
+	setCheckStatus(resultFailed, "unexpected listeners: "+strings.Join(descriptions, ", "), details)
+	return details, nil
+}
+
+func readListeningSockets() ([]ListeningSocket, error) {
+	sockets := []ListeningSocket{}
+	for _, protocol := range listeningProtocols {
+		found, err := parseProcNet("/proc/net/"+protocol, protocol)
+		if err != nil {
+			return nil, err
+		}
+		sockets = append(sockets, found...)
+	}
+
+	processes := socketProcesses()
+	for i := range sockets {
+		sockets[i].Pids = processes[sockets[i].Inode]
+		if len(sockets[i].Pids) == 0 {
+			sockets[i].Pids = []int{}
+			continue
+		}
+		sockets[i].Pid = sockets[i].Pids[0]
+		sockets[i].Command = processCommand(sockets[i].Pid)
+	}
+	return sockets, nil
+}
+
+// a missing file means the protocol is not available (e.g. IPv6 is disabled)
+func parseProcNet(path string, protocol string) ([]ListeningSocket, error) {
+	content, err := ioutil.ReadFile(hostPath(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New("listeners: cannot read " + path)
+	}
+
+	var sockets []ListeningSocket
+	for number, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if number == 0 || len(fields) < 10 {
+			continue
+		}
+		state := fields[3]
+		if strings.HasPrefix(protocol, "tcp") && state != tcpStateListen {
+			continue
+		}
+		if strings.HasPrefix(protocol, "udp") && (state != udpStateClose || !strings.HasSuffix(fields[2], ":0000")) {
+			continue
+		}
+		address, port, err := parseProcNetAddress(fields[1])
+		if err != nil {
+			return nil, errors.New("listeners: " + path + " line " + strconv.Itoa(number+1) + ": " + err.Error())
+		}
+		uid, _ := strconv.Atoi(fields[7])
+		inode, _ := strconv.ParseUint(fields[9], 10, 64)
+		socket := ListeningSocket{Protocol: protocol, Address: address, Port: port, Uid: uid, Inode: inode}
+		if owner, err := user.LookupId(fields[7]); err == nil {
+			socket.User = owner.Username
+		}
+		sockets = append(sockets, socket)
+	}
+	return sockets, nil
+}
+
+// "0100007F:0016" is 127.0.0.1 port 22, the address is made of 32 bit words in host byte order
+func parseProcNetAddress(field string) (string, int, error) {
+	parts := strings.Split(field, ":")
+	if len(parts) != 2 {
+		return "", 0, errors.New("invalid address " + field)
+	}
+	raw, err := hex.DecodeString(parts[0])
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", 0, errors.New("invalid address " + field)
+	}
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return "", 0, errors.New("invalid port " + field)
+	}
+
+	address := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		word := binary.BigEndian.Uint32(raw[i : i+4])
+		if !isBigEndianHost() {
+			word = binary.LittleEndian.Uint32(raw[i : i+4])
+		}
+		binary.BigEndian.PutUint32(address[i:i+4], word)
+	}
+	return address.String(), int(port), nil
+}
+
+func isBigEndianHost() bool {
+	for _, architecture := range bigEndianArchitectures {
+		if runtime.GOARCH == architecture {
+			return true
+		}
+	}
+	return false
+}
+
+// socket inodes with the pids that have them open, processes of other users are only visible as root
+func socketProcesses() map[uint64][]int {
+	processes := make(map[uint64][]int)
+	for _, pid := range processIds() {
+		links, _ := filepath.Glob(filepath.Join(hostPath("/proc"), strconv.Itoa(pid), "fd", "*"))
+		for _, link := range links {
+			target, err := os.Readlink(link)
+			if err != nil || !strings.HasPrefix(target, "socket:[") {
+				continue
+			}
+			inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]"), 10, 64)
+			if err == nil && !containsPid(processes[inode], pid) {
+				processes[inode] = append(processes[inode], pid)
+			}
+		}
+	}
+	for inode := range processes {
+		sort.Ints(processes[inode])
+	}
+	return processes
+}
+
+func containsPid(pids []int, pid int) bool {
+	for _, existing := range pids {
+		if existing == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// pids of the running processes in ascending order
+func processIds() []int {
+	var pids []int
+	entries, _ := ioutil.ReadDir(hostPath("/proc"))
+	for _, entry := range entries {
+		if pid, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	return pids
+}
+
+func processCommand(pid int) string {
+	content, err := ioutil.ReadFile(hostPath("/proc/" + strconv.Itoa(pid) + "/comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+func unexpectedListeners(sockets []ListeningSocket, rules []ListenerRule, includeLoopback bool) []ListeningSocket {
+	unexpected := []ListeningSocket{}
+	for _, socket := range sockets {
+		if !includeLoopback && net.ParseIP(socket.Address).IsLoopback() {
+			continue
+		}
+		allowed := false
+		for _, rule := range rules {
+			if matchListenerRule(rule, socket) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			unexpected = append(unexpected, socket)
+		}
+	}
+	return unexpected
+}
+
+// "tcp" also matches "tcp6", "*" matches every address
+func matchListenerRule(rule ListenerRule, socket ListeningSocket) bool {
+	if rule.Protocol != "" && rule.Protocol != socket.Protocol && rule.Protocol+"6" != socket.Protocol {
+		return false
+	}
+	if rule.Address != "" && rule.Address != "*" && !net.ParseIP(rule.Address).Equal(net.ParseIP(socket.Address)) {
+		return false
+	}
+	if rule.Port != 0 && rule.Port != socket.Port {
+		return false
+	}
+	if rule.Command != "" && rule.Command != socket.Command {
+		return false
+	}
+	return rule.User == "" || rule.User == socket.User
+}
+
+// "tcp 0.0.0.0:23 (telnetd)"
+func describeListener(socket ListeningSocket) string {
+	description := socket.Protocol + " " + net.JoinHostPort(socket.Address, strconv.Itoa(socket.Port))
+	if socket.Command != "" {
+		description += " (" + socket.Command + ")"
+	}
+	return description
+}
@@ -0,0 +1,251 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type MacStatus struct {
+	Lsm      []string       `json:"lsm"`
+	SELinux  SELinuxStatus  `json:"selinux"`
+	AppArmor AppArmorStatus `json:"apparmor"`
+}
+
+// mode is the running one, configuredMode the one of /etc/selinux/config used at the next boot
+type SELinuxStatus struct {
+	Enabled             bool         `json:"enabled"`
+	Mode                string       `json:"mode"`
+	ConfiguredMode      string       `json:"configuredMode"`
+	PolicyType          string       `json:"policyType"`
+	PolicyInstalled     bool         `json:"policyInstalled"`
+	PolicyVersion       int          `json:"policyVersion"`
+	Mls                 bool         `json:"mls"`
+	UnconfinedProcesses []MacProcess `json:"unconfinedProcesses"`
+}
+
+type AppArmorStatus struct {
+	Enabled             bool              `json:"enabled"`
+	Profiles            []AppArmorProfile `json:"profiles"`
+	ProfileCounts       map[string]int    `json:"profileCounts"`
+	ProcessCounts       map[string]int    `json:"processCounts"`
+	PolicyFiles         []string          `json:"policyFiles"`
+	DisabledProfiles    []string          `json:"disabledProfiles"`
+	UnconfinedProcesses []MacProcess      `json:"unconfinedProcesses"`
+}
+
+type AppArmorProfile struct {
+	Name string `json:"name"`
+	Mode string `json:"mode"`
+}
+
+type MacProcess struct {
+	Pid        int    `json:"pid"`
+	Command    string `json:"command"`
+	Executable string `json:"executable"`
+	Context    string `json:"context"`
+}
+
+const (
+	lsmFile                = "/sys/kernel/security/lsm"
+	selinuxMountDirectory  = "/sys/fs/selinux"
+	selinuxConfigFile      = "/etc/selinux/config"
+	selinuxPolicyDirectory = "/etc/selinux"
+	apparmorEnabledFile    = "/sys/module/apparmor/parameters/enabled"
+	apparmorProfilesFile   = "/sys/kernel/security/apparmor/profiles"
+	apparmorPolicyDir      = "/etc/apparmor.d"
+)
+
+// daemons that run without a SELinux domain of their own
+var selinuxUnconfinedTypes = []string{"unconfined_service_t", "initrc_t"}
+
+// directories of /etc/apparmor.d that hold no profiles
+var apparmorIgnoredDirectories = []string{"abstractions", "tunables", "local", "disable", "force-complain", "cache", "abi"}
+
+// state of SELinux and AppArmor read from sysfs, their config and the contexts of the running processes
+func MacStatusInfo() (interface{}, error) {
+	return toJavaScriptValue(readMacStatus()), nil
+}
+
+func readMacStatus() MacStatus {
+	status := MacStatus{Lsm: []string{}}
+	if content, err := ioutil.ReadFile(hostPath(lsmFile)); err == nil {
+		status.Lsm = strings.Split(strings.TrimSpace(string(content)), ",")
+	}
+	status.SELinux = readSELinuxStatus()
+	status.AppArmor = readAppArmorStatus()
+
+	for _, pid := range processIds() {
+		content, err := ioutil.ReadFile(hostPath("/proc/" + strconv.Itoa(pid) + "/attr/current"))
+		if err != nil {
+			continue
+		}
+		context := strings.TrimSpace(strings.TrimRight(string(content), "\x00"))
+		if context == "" {
+			continue
+		}
+		process := MacProcess{Pid: pid, Context: context}
+		switch {
+		case status.SELinux.Enabled:
+			addSELinuxProcess(&status.SELinux, process)
+		case status.AppArmor.Enabled:
+			addAppArmorProcess(&status.AppArmor, process)
+		}
+	}
+	return status
+}
+
+// SELinux is disabled if selinuxfs is not mounted
+func readSELinuxStatus() SELinuxStatus {
+	status := SELinuxStatus{Mode: "disabled", UnconfinedProcesses: []MacProcess{}}
+	if content, err := ioutil.ReadFile(hostPath(selinuxMountDirectory + "/enforce")); err == nil {
+		status.Enabled = true
+		status.Mode = "permissive"
+		if strings.TrimSpace(string(content)) == "1" {
+			status.Mode = "enforcing"
+		}
+	}
+	if content, err := ioutil.ReadFile(hostPath(selinuxMountDirectory + "/policyvers")); err == nil {
+		status.PolicyVersion, _ = strconv.Atoi(strings.TrimSpace(string(content)))
+	}
+	if content, err := ioutil.ReadFile(hostPath(selinuxMountDirectory + "/mls")); err == nil {
+		status.Mls = strings.TrimSpace(string(content)) == "1"
+	}
+
+	if content, err := ioutil.ReadFile(hostPath(selinuxConfigFile)); err == nil {
+		saveFileArtefact(hostPath(selinuxConfigFile), content)
+		entries, _ := parseConfigContent(string(content), configDialectShell, selinuxConfigFile)
+		for _, entry := range entries {
+			switch entry.Key {
+			case "SELINUX":
+				status.ConfiguredMode = strings.ToLower(entry.Value)
+			case "SELINUXTYPE":
+				status.PolicyType = entry.Value
+			}
+		}
+	}
+	if status.PolicyType != "" {
+		status.PolicyInstalled = checkPathExists(hostPath(filepath.Join(selinuxPolicyDirectory, status.PolicyType, "policy")))
+	}
+	return status
+}
+
+// "system_u:system_r:unconfined_service_t:s0" is unconfined
+func addSELinuxProcess(status *SELinuxStatus, process MacProcess) {
+	parts := strings.Split(process.Context, ":")
+	if len(parts) < 3 {
+		return
+	}
+	for _, unconfinedType := range selinuxUnconfinedTypes {
+		if parts[2] == unconfinedType {
+			process.Command = processCommand(process.Pid)
+			process.Executable, _ = os.Readlink(hostPath("/proc/" + strconv.Itoa(process.Pid) + "/exe"))
+			status.UnconfinedProcesses = append(status.UnconfinedProcesses, process)
+		}
+	}
+}
+
+// the loaded profiles are only readable by root, profiles and the counts stay empty without it
+func readAppArmorStatus() AppArmorStatus {
+	status := AppArmorStatus{Profiles: []AppArmorProfile{}, ProfileCounts: make(map[string]int), ProcessCounts: make(map[string]int), PolicyFiles: []string{}, DisabledProfiles: []string{}, UnconfinedProcesses: []MacProcess{}}
+	if content, err := ioutil.ReadFile(hostPath(apparmorEnabledFile)); err == nil {
+		status.Enabled = strings.TrimSpace(string(content)) == "Y"
+	}
+
+	content, err := ioutil.ReadFile(hostPath(apparmorProfilesFile))
+	if err != nil && status.Enabled {
+		WriteLog("apparmor: cannot read "+apparmorProfilesFile+", the loaded profiles are unknown", "WARN")
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		name, mode := splitAppArmorLabel(strings.TrimSpace(line))
+		if name == "" {
+			continue
+		}
+		status.Profiles = append(status.Profiles, AppArmorProfile{Name: name, Mode: mode})
+		status.ProfileCounts[mode]++
+	}
+
+	status.PolicyFiles = apparmorPolicyFiles()
+	disabled, _ := ioutil.ReadDir(hostPath(filepath.Join(apparmorPolicyDir, "disable")))
+	for _, entry := range disabled {
+		status.DisabledProfiles = append(status.DisabledProfiles, entry.Name())
+	}
+	return status
+}
+
+// "/usr/sbin/cupsd (enforce)" is the profile and its mode, "unconfined" has no mode
+func splitAppArmorLabel(label string) (string, string) {
+	if label == "" || label == "unconfined" {
+		return label, "unconfined"
+	}
+	if strings.HasSuffix(label, ")") {
+		if start := strings.LastIndex(label, " ("); start >= 0 {
+			return label[:start], label[start+2 : len(label)-1]
+		}
+	}
+	return label, ""
+}
+
+// files of /etc/apparmor.d with profiles, the directories of includes and settings are left out
+func apparmorPolicyFiles() []string {
+	files := []string{}
+	entries, _ := ioutil.ReadDir(hostPath(apparmorPolicyDir))
+	for _, entry := range entries {
+		ignored := strings.HasPrefix(entry.Name(), ".") || strings.HasSuffix(entry.Name(), "~") || strings.HasSuffix(entry.Name(), ".dpkg-dist") || strings.HasSuffix(entry.Name(), ".rpmnew")
+		for _, directory := range apparmorIgnoredDirectories {
+			if entry.Name() == directory {
+				ignored = true
+			}
+		}
+		if !ignored && !entry.IsDir() {
+			files = append(files, filepath.Join(apparmorPolicyDir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// an unconfined process counts like apparmor_status if a profile for its executable is loaded
+func addAppArmorProcess(status *AppArmorStatus, process MacProcess) {
+	_, mode := splitAppArmorLabel(process.Context)
+	status.ProcessCounts[mode]++
+	if mode != "unconfined" {
+		return
+	}
+	executable, err := os.Readlink(hostPath("/proc/" + strconv.Itoa(process.Pid) + "/exe"))
+	if err != nil {
+		return
+	}
+	for _, profile := range status.Profiles {
+		if profile.Name == executable {
+			process.Command = processCommand(process.Pid)
+			process.Executable = executable
+			status.UnconfinedProcesses = append(status.UnconfinedProcesses, process)
+			return
+		}
+	}
+}
@@ -0,0 +1,226 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+type MountEntry struct {
+	Id           int      `json:"id"`
+	ParentId     int      `json:"parentId"`
+	MajorMinor   string   `json:"majorMinor"`
+	Root         string   `json:"root"`
+	Device       string   `json:"device"`
+	Mountpoint   string   `json:"mountpoint"`
+	Fstype       string   `json:"fstype"`
+	Options      []string `json:"options"`
+	SuperOptions []string `json:"superOptions"`
+}
+
+// a line of /etc/fstab or a .mount unit of systemd
+type FstabEntry struct {
+	Device     string   `json:"device"`
+	Mountpoint string   `json:"mountpoint"`
+	Fstype     string   `json:"fstype"`
+	Options    []string `json:"options"`
+	Dump       int      `json:"dump"`
+	Pass       int      `json:"pass"`
+	Enabled    bool     `json:"enabled"`
+	Unit       string   `json:"unit,omitempty"`
+	File       string   `json:"file"`
+	Line       int      `json:"line,omitempty"`
+}
+
+const mountInfoFile = "/proc/self/mountinfo"
+const fstabFile = "/etc/fstab"
+
+// mounts of the running system in mount order, the last mount of a mountpoint is the visible one
+func Mounts() ([]interface{}, error) {
+	mounts, err := parseMountInfo(mountInfoFile)
+	if err != nil {
+		return nil, err
+	}
+	return toJavaScriptValue(mounts).([]interface{}), nil
+}
+
+// mounts that are set up at boot from /etc/fstab and .mount units
+func Fstab() ([]interface{}, error) {
+	entries, err := parseFstab(fstabFile)
+	if err != nil {
+		return nil, err
+	}
+	unitEntries, err := mountUnits()
+	if err != nil {
+		return nil, err
+	}
+	return toJavaScriptValue(append(entries, unitEntries...)).([]interface{}), nil
+}
+
+// "36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue"
+func parseMountInfo(path string) ([]MountEntry, error) {
+	content, err := ioutil.ReadFile(hostPath(path))
+	if err != nil {
+		return nil, errors.New("mounts: cannot read " + path)
+	}
+
+	mounts := []MountEntry{}
+	for i, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		separator := -1
+		for position := 6; position < len(fields); position++ {
+			if fields[position] == "-" {
+				separator = position
+				break
+			}
+		}
+		if separator < 0 || separator+2 >= len(fields) {
+			return nil, errors.New("mounts: " + path + " line " + fmt.Sprint(i+1) + " is invalid")
+		}
+		mount := MountEntry{
+			MajorMinor:   fields[2],
+			Root:         unescapeMountField(fields[3]),
+			Mountpoint:   unescapeMountField(fields[4]),
+			Options:      splitMountOptions(fields[5]),
+			Fstype:       fields[separator+1],
+			Device:       unescapeMountField(fields[separator+2]),
+			SuperOptions: []string{},
+		}
+		mount.Id, _ = strconv.Atoi(fields[0])
+		mount.ParentId, _ = strconv.Atoi(fields[1])
+		if separator+3 < len(fields) {
+			mount.SuperOptions = splitMountOptions(fields[separator+3])
+		}
+		mounts = append(mounts, mount)
+	}
+	return mounts, nil
+}
+
+// "UUID=... /tmp ext4 defaults,nodev 0 2", entries with noauto are not enabled
+func parseFstab(path string) ([]FstabEntry, error) {
+	content, err := ioutil.ReadFile(hostPath(path))
+	if err != nil {
+		return nil, errors.New("fstab: cannot read " + path)
+	}
+	saveFileArtefact(hostPath(path), content)
+
+	entries := []FstabEntry{}
+	for i, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, errors.New("fstab: " + path + " line " + fmt.Sprint(i+1) + " needs device, mountpoint and fstype")
+		}
+		entry := FstabEntry{
+			Device:     unescapeMountField(fields[0]),
+			Mountpoint: unescapeMountField(fields[1]),
+			Fstype:     fields[2],
+			Options:    []string{"defaults"},
+			File:       path,
+			Line:       i + 1,
+		}
+		if len(fields) > 3 {
+			entry.Options = splitMountOptions(fields[3])
+		}
+		if len(fields) > 4 {
+			entry.Dump, _ = strconv.Atoi(fields[4])
+		}
+		if len(fields) > 5 {
+			entry.Pass, _ = strconv.Atoi(fields[5])
+		}
+		entry.Enabled = !hasMountOption(entry.Options, "noauto")
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// .mount units like tmp.mount, masked units are left out
+func mountUnits() ([]FstabEntry, error) {
+	entries := []FstabEntry{}
+	for _, name := range listSystemdUnits(".mount") {
+		unit, found, err := loadSystemdUnit(name)
+		if err != nil {
+			return nil, err
+		}
+		if !found || unit.Masked {
+			continue
+		}
+		entry := FstabEntry{
+			Device:     systemdUnitValue(unit, "Mount", "What"),
+			Mountpoint: systemdUnitValue(unit, "Mount", "Where"),
+			Fstype:     systemdUnitValue(unit, "Mount", "Type"),
+			Options:    []string{},
+			Enabled:    isSystemdUnitEnabled(name),
+			Unit:       name,
+			File:       unit.Path,
+		}
+		if options := systemdUnitValue(unit, "Mount", "Options"); options != "" {
+			entry.Options = splitMountOptions(options)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func splitMountOptions(options string) []string {
+	if options == "" {
+		return []string{}
+	}
+	return strings.Split(options, ",")
+}
+
+func hasMountOption(options []string, option string) bool {
+	for _, existing := range options {
+		if existing == option {
+			return true
+		}
+	}
+	return false
+}
+
+// spaces, tabs and backslashes are written as octal like "\040"
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, "\\") {
+		return field
+	}
+	var unescaped []byte
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			if value, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				unescaped = append(unescaped, byte(value))
+				i += 3
+				continue
+			}
+		}
+		unescaped = append(unescaped, field[i])
+	}
+	return string(unescaped)
+}
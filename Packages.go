@@ -0,0 +1,144 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+type InstalledPackage struct {
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	Architecture string `json:"architecture"`
+	State        string `json:"state"`
+	Manager      string `json:"manager"`
+}
+
+const dpkgStatusFile = "/var/lib/dpkg/status"
+
+// the first database that exists is read, /var/lib/rpm is often a link to /usr/lib/sysimage/rpm
+var rpmDatabases = []struct {
+	path   string
+	reader func(string) ([]RpmHeader, error)
+}{
+	{"/usr/lib/sysimage/rpm/rpmdb.sqlite", readRpmSqlite},
+	{"/var/lib/rpm/rpmdb.sqlite", readRpmSqlite},
+	{"/usr/lib/sysimage/rpm/Packages.db", readRpmNdb},
+	{"/var/lib/rpm/Packages.db", readRpmNdb},
+}
+
+// the Berkeley DB format of older distributions is not supported
+var rpmBerkeleyDatabases = []string{"/var/lib/rpm/Packages", "/usr/lib/sysimage/rpm/Packages"}
+
+// packages are only read once per run
+var installedPackages []InstalledPackage
+
+// installed packages of dpkg and rpm, read from their databases without calling the tools
+func Packages() ([]interface{}, error) {
+	packages, err := readInstalledPackages()
+	if err != nil {
+		return nil, err
+	}
+	return toJavaScriptValue(packages).([]interface{}), nil
+}
+
+func readInstalledPackages() ([]InstalledPackage, error) {
+	if installedPackages != nil {
+		return installedPackages, nil
+	}
+
+	packages := []InstalledPackage{}
+	if checkPathExists(hostPath(dpkgStatusFile)) {
+		dpkgPackages, err := readDpkgStatus(dpkgStatusFile)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, dpkgPackages...)
+	}
+	rpmPackages, err := readRpmPackages()
+	if err != nil {
+		return nil, err
+	}
+	packages = append(packages, rpmPackages...)
+
+	WriteLog("package inventory read with "+fmt.Sprint(len(packages))+" packages", "INFO")
+	installedPackages = packages
+	return packages, nil
+}
+
+func readRpmPackages() ([]InstalledPackage, error) {
+	packages := []InstalledPackage{}
+	for _, database := range rpmDatabases {
+		if !checkPathExists(hostPath(database.path)) {
+			continue
+		}
+		headers, err := database.reader(hostPath(database.path))
+		if err != nil {
+			return nil, err
+		}
+		for _, header := range headers {
+			packages = append(packages, InstalledPackage{Name: header.Name, Version: rpmFullVersion(header), Architecture: header.Arch, State: "installed", Manager: "rpm"})
+		}
+		return packages, nil
+	}
+	for _, path := range rpmBerkeleyDatabases {
+		if checkPathExists(hostPath(path)) {
+			return nil, errors.New("rpm: the Berkeley DB database " + path + " is not supported")
+		}
+	}
+	return packages, nil
+}
+
+// paragraphs of "Field: value" lines, the state is the last word of Status
+func readDpkgStatus(path string) ([]InstalledPackage, error) {
+	content, err := ioutil.ReadFile(hostPath(path))
+	if err != nil {
+		return nil, errors.New("dpkg: cannot read " + path)
+	}
+
+	packages := []InstalledPackage{}
+	for _, paragraph := range strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n\n") {
+		fields := make(map[string]string)
+		for _, line := range strings.Split(paragraph, "\n") {
+			// continuation lines of Description and Conffiles start with a space
+			if line == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+				continue
+			}
+			keyValue := strings.SplitN(line, ":", 2)
+			if len(keyValue) == 2 {
+				fields[keyValue[0]] = strings.TrimSpace(keyValue[1])
+			}
+		}
+		if fields["Package"] == "" {
+			continue
+		}
+		status := strings.Fields(fields["Status"])
+		if len(status) != 3 {
+			return nil, errors.New("dpkg: " + path + " has an invalid status for " + fields["Package"])
+		}
+		packages = append(packages, InstalledPackage{Name: fields["Package"], Version: fields["Version"], Architecture: fields["Architecture"], State: status[2], Manager: "dpkg"})
+	}
+	return packages, nil
+}
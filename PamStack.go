@@ -0,0 +1,317 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type PamEntry struct {
+	Type      string                 `json:"type"`
+	Control   string                 `json:"control"`
+	Actions   map[string]string      `json:"actions"`
+	Module    string                 `json:"module"`
+	Name      string                 `json:"name"`
+	Arguments []string               `json:"arguments"`
+	Options   map[string]interface{} `json:"options"`
+	Optional  bool                   `json:"optional"`
+	Substack  string                 `json:"substack,omitempty"`
+	Service   string                 `json:"service"`
+	File      string                 `json:"file"`
+	Line      int                    `json:"line"`
+}
+
+const pamDirectory = "/etc/pam.d"
+const pamConfFile = "/etc/pam.conf"
+const pamMaxIncludeDepth = 16
+
+var pamTypes = []string{"auth", "account", "password", "session"}
+
+// the simple control values written as actions, see pam.conf(5)
+var pamControlActions = map[string]map[string]string{
+	"required":   {"success": "ok", "new_authtok_reqd": "ok", "ignore": "ignore", "default": "bad"},
+	"requisite":  {"success": "ok", "new_authtok_reqd": "ok", "ignore": "ignore", "default": "die"},
+	"sufficient": {"success": "done", "new_authtok_reqd": "done", "default": "ignore"},
+	"optional":   {"success": "ok", "new_authtok_reqd": "ok", "default": "ignore"},
+}
+
+// modules of a service per type in the order PAM runs them, include and substack are resolved
+func PamStack(service string) (map[string]interface{}, error) {
+	stack, err := pamStack(service)
+	if err != nil {
+		return nil, err
+	}
+	return toJavaScriptValue(stack).(map[string]interface{}), nil
+}
+
+func pamStack(service string) (map[string][]PamEntry, error) {
+	stack := make(map[string][]PamEntry)
+	for _, pamType := range pamTypes {
+		stack[pamType] = []PamEntry{}
+	}
+
+	entries, err := readPamService(service, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		stack[entry.Type] = append(stack[entry.Type], entry)
+	}
+	return stack, nil
+}
+
+// like PAM the service "other" is used if the service has no file
+func readPamService(service string, pamType string, depth int) ([]PamEntry, error) {
+	if depth > pamMaxIncludeDepth {
+		return nil, errors.New("pam: too many nested includes in " + service)
+	}
+	if _, err := os.Stat(hostPath(pamDirectory)); err != nil {
+		return readPamConf(service, pamType)
+	}
+
+	path := service
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(pamDirectory, service)
+	}
+	content, err := ioutil.ReadFile(hostPath(path))
+	if os.IsNotExist(err) && depth == 0 && service != "other" {
+		return readPamService("other", pamType, depth)
+	}
+	if err != nil {
+		return nil, errors.New("pam: cannot read " + path)
+	}
+	saveFileArtefact(hostPath(path), content)
+
+	var entries []PamEntry
+	for _, line := range joinPamLines(string(content)) {
+		fields := splitPamLine(line.text)
+		if len(fields) == 0 {
+			continue
+		}
+		// Debian includes every type of a file with "@include common-auth"
+		if fields[0] == "@include" {
+			if len(fields) < 2 {
+				return nil, errors.New("pam: " + path + " line " + fmt.Sprint(line.number) + ": @include without a file")
+			}
+			included, err := readPamService(fields[1], pamType, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, included...)
+			continue
+		}
+
+		entry, err := parsePamEntry(fields)
+		if err != nil {
+			return nil, errors.New("pam: " + path + " line " + fmt.Sprint(line.number) + ": " + err.Error())
+		}
+		if pamType != "" && entry.Type != pamType {
+			continue
+		}
+		entry.Service, entry.File, entry.Line = filepath.Base(path), path, line.number
+
+		switch entry.Control {
+		case "include", "substack":
+			included, err := readPamService(entry.Module, entry.Type, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			// jumps and done of a substack end at the end of the substack
+			if entry.Control == "substack" {
+				for i := range included {
+					if included[i].Substack == "" {
+						included[i].Substack = filepath.Base(entry.Module)
+					}
+				}
+			}
+			entries = append(entries, included...)
+		default:
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// lines of /etc/pam.conf start with the service, it is only read without /etc/pam.d
+func readPamConf(service string, pamType string) ([]PamEntry, error) {
+	content, err := ioutil.ReadFile(hostPath(pamConfFile))
+	if err != nil {
+		return nil, errors.New("pam: neither " + pamDirectory + " nor " + pamConfFile + " found")
+	}
+	saveFileArtefact(hostPath(pamConfFile), content)
+
+	var entries []PamEntry
+	for _, line := range joinPamLines(string(content)) {
+		fields := splitPamLine(line.text)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], service) {
+			continue
+		}
+		entry, err := parsePamEntry(fields[1:])
+		if err != nil {
+			return nil, errors.New("pam: " + pamConfFile + " line " + fmt.Sprint(line.number) + ": " + err.Error())
+		}
+		if pamType != "" && entry.Type != pamType {
+			continue
+		}
+		entry.Service, entry.File, entry.Line = service, pamConfFile, line.number
+		if entry.Control == "include" || entry.Control == "substack" {
+			included, err := readPamConf(entry.Module, entry.Type)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, included...)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// type, control, module and arguments, a type starting with "-" is skipped by PAM if the module is missing
+func parsePamEntry(fields []string) (PamEntry, error) {
+	if len(fields) < 3 {
+		return PamEntry{}, errors.New("expected type, control and module")
+	}
+	entry := PamEntry{Type: strings.ToLower(fields[0]), Module: fields[2], Arguments: []string{}, Options: map[string]interface{}{}}
+	if strings.HasPrefix(entry.Type, "-") {
+		entry.Type = strings.TrimPrefix(entry.Type, "-")
+		entry.Optional = true
+	}
+	if !isPamType(entry.Type) {
+		return PamEntry{}, errors.New("unknown type " + fields[0])
+	}
+
+	control := fields[1]
+	if strings.HasPrefix(control, "[") {
+		entry.Control = control
+		entry.Actions = make(map[string]string)
+		for _, action := range strings.Fields(strings.Trim(control, "[]")) {
+			keyValue := strings.SplitN(action, "=", 2)
+			if len(keyValue) != 2 {
+				return PamEntry{}, errors.New("invalid control " + control)
+			}
+			entry.Actions[strings.ToLower(keyValue[0])] = strings.ToLower(keyValue[1])
+		}
+	} else {
+		entry.Control = strings.ToLower(control)
+		actions, ok := pamControlActions[entry.Control]
+		if !ok && entry.Control != "include" && entry.Control != "substack" {
+			return PamEntry{}, errors.New("unknown control " + control)
+		}
+		entry.Actions = actions
+	}
+
+	name := filepath.Base(entry.Module)
+	entry.Name = strings.TrimSuffix(name, ".so")
+	for _, argument := range fields[3:] {
+		// arguments with spaces are written in brackets, "\]" is a literal bracket
+		if strings.HasPrefix(argument, "[") && strings.HasSuffix(argument, "]") {
+			argument = strings.ReplaceAll(argument[1:len(argument)-1], "\\]", "]")
+		}
+		entry.Arguments = append(entry.Arguments, argument)
+		keyValue := strings.SplitN(argument, "=", 2)
+		if len(keyValue) == 2 {
+			entry.Options[keyValue[0]] = keyValue[1]
+		} else {
+			entry.Options[argument] = true
+		}
+	}
+	return entry, nil
+}
+
+func isPamType(pamType string) bool {
+	for _, knownType := range pamTypes {
+		if pamType == knownType {
+			return true
+		}
+	}
+	return false
+}
+
+type pamLine struct {
+	text   string
+	number int
+}
+
+// lines ending with "\" are continued, "#" starts a comment
+func joinPamLines(content string) []pamLine {
+	var lines []pamLine
+	current := ""
+	start := 0
+	for i, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if current == "" {
+			start = i + 1
+		}
+		if commentStart := strings.Index(line, "#"); commentStart >= 0 {
+			line = line[:commentStart]
+		}
+		if strings.HasSuffix(line, "\\") {
+			current += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		lines = append(lines, pamLine{text: current + line, number: start})
+		current = ""
+	}
+	if current != "" {
+		lines = append(lines, pamLine{text: current, number: start})
+	}
+	return lines
+}
+
+// fields are separated by whitespace, a field in brackets can contain spaces
+func splitPamLine(line string) []string {
+	var fields []string
+	field := ""
+	inBrackets := false
+	for i := 0; i < len(line); i++ {
+		character := line[i]
+		switch {
+		case inBrackets && character == '\\' && i+1 < len(line) && line[i+1] == ']':
+			field += "\\]"
+			i++
+		case inBrackets:
+			field += string(character)
+			if character == ']' {
+				inBrackets = false
+			}
+		case character == '[' && field == "":
+			field += "["
+			inBrackets = true
+		case character == ' ' || character == '\t':
+			if field != "" {
+				fields = append(fields, field)
+				field = ""
+			}
+		default:
+			field += string(character)
+		}
+	}
+	if field != "" {
+		fields = append(fields, field)
+	}
+	return fields
+}
@@ -0,0 +1,163 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const readOnlyViolation = "read-only violation: "
+
+// stderr messages of commands that were stopped from writing, EROFS always comes from a write
+const (
+	readOnlyFileSystemMessage = "Read-only file system"
+	permissionDeniedMessage   = "Permission denied"
+)
+
+// absolute paths in messages like "touch: cannot touch '/etc/x': Permission denied"
+var deniedPathRegex = regexp.MustCompile(`'(/[^']+)'|(/[^\s:'"]+)`)
+
+// directories and files that stay writable in read-only mode
+var readOnlyWritablePaths []string
+
+// Landlock only restricts the file system, these subcommands change the system over D-Bus or netlink
+var readOnlyCommandPolicies = map[string]CommandPolicy{
+	"systemctl": {
+		Command: "systemctl",
+		ForbiddenArguments: []string{"start", "stop", "reload", "restart", "try-restart", "reload-or-restart", "try-reload-or-restart",
+			"condrestart", "force-reload", "isolate", "kill", "clean", "freeze", "thaw", "set-property", "bind", "mount-image",
+			"reset-failed", "enable", "disable", "reenable", "preset", "preset-all", "mask", "unmask", "link", "revert", "add-wants",
+			"add-requires", "edit", "set-default", "set-environment", "unset-environment", "import-environment", "daemon-reload",
+			"daemon-reexec", "log-level", "log-target", "service-log-level", "service-log-target", "default", "rescue", "emergency",
+			"halt", "poweroff", "reboot", "kexec", "soft-reboot", "exit", "switch-root", "suspend", "hibernate", "hybrid-sleep",
+			"suspend-then-hibernate", "cancel"},
+		Desc: "only query units",
+	},
+	"iptables":  readOnlyIptablesPolicy("iptables"),
+	"ip6tables": readOnlyIptablesPolicy("ip6tables"),
+	"nft": {
+		Command: "nft",
+		ForbiddenArguments: []string{"add", "create", "insert", "replace", "delete", "destroy", "flush", "reset", "rename", "import",
+			"-f", "--file(=.*)?", "-i", "--interactive"},
+		Desc: "only list the ruleset",
+	},
+	"auditctl": {
+		Command:            "auditctl",
+		ForbiddenArguments: []string{"-[DaAdwWefbrRmt].*", "--(reset-lost|backlog_wait_time|reset_backlog_wait_time_actual|loginuid-immutable|signal).*"},
+		Desc:               "only list rules and status",
+	},
+}
+
+func readOnlyIptablesPolicy(command string) CommandPolicy {
+	return CommandPolicy{
+		Command: command,
+		ForbiddenArguments: []string{"-[A-Za-z]*[ADIRFZNXPE][A-Za-z]*",
+			"--(append|delete|insert|replace|flush|zero|new-chain|delete-chain|policy|rename-chain)(=.*)?"},
+		Desc: "only list rules",
+	}
+}
+
+// blocks writes of all executed commands, only the output folder and the zip stay writable
+func enableReadOnlyMode() error {
+	createFolderIfNotExist("./output/", "output")
+	outputPath, err := filepath.Abs("./output")
+	if err != nil {
+		return err
+	}
+
+	// the zip has to exist before writes are blocked
+	zipFile, err := os.OpenFile(zipLocation, os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	zipFile.Close()
+	zipPath, err := filepath.Abs(zipLocation)
+	if err != nil {
+		return err
+	}
+
+	readOnlyWritablePaths = []string{outputPath, zipPath, os.DevNull}
+	err = restrictFileSystemWrites([]string{outputPath}, []string{zipPath, os.DevNull})
+	if err != nil {
+		return errors.New("read-only mode cannot be enabled: " + err.Error())
+	}
+	WriteLog("read-only mode enabled, writable: "+outputPath+", "+zipPath, "INFO")
+	if debugModeEnabled {
+		WriteDebugLog("read-only mode enabled", "INFO")
+	}
+	return nil
+}
+
+// turns a failed command into a violation if Landlock or a read-only mount stopped it from writing,
+// a read that fails with "Permission denied" is no violation
+func checkReadOnlyViolation(command string, stderr string) error {
+	if !flags.readOnly {
+		return nil
+	}
+	for _, line := range strings.Split(stderr, "\n") {
+		if strings.Contains(line, readOnlyFileSystemMessage) {
+			return errors.New(readOnlyViolation + command + ": " + removeSuffix(line))
+		}
+		if !strings.Contains(line, permissionDeniedMessage) {
+			continue
+		}
+		for _, match := range deniedPathRegex.FindAllStringSubmatch(line, -1) {
+			path := match[1] + match[2]
+			if !isReadOnlyWritablePath(path) && isWriteDeniedByLandlock(path) {
+				return errors.New(readOnlyViolation + command + ": " + removeSuffix(line))
+			}
+		}
+	}
+	return nil
+}
+
+func isReadOnlyWritablePath(path string) bool {
+	for _, writablePath := range readOnlyWritablePaths {
+		if path == writablePath || strings.HasPrefix(path, writablePath+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// subcommands that change the system are refused in read-only mode
+func checkReadOnlyCommandPolicy(command string, arguments []string) error {
+	if !flags.readOnly {
+		return nil
+	}
+	policy, ok := readOnlyCommandPolicies[strings.ToLower(command)]
+	if !ok {
+		return nil
+	}
+	for _, argument := range arguments {
+		for _, pattern := range policy.ForbiddenArguments {
+			if matchesArgument(pattern, unquoteArgument(argument)) {
+				return errors.New(readOnlyViolation + "argument \"" + argument + "\" of " + command + " is forbidden")
+			}
+		}
+	}
+	return nil
+}
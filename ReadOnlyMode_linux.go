@@ -0,0 +1,141 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Landlock syscalls and access rights of the first ABI version
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1
+	landlockRulePathBeneath      = 1
+
+	landlockAccessFsWriteFile  = 1 << 1
+	landlockAccessFsRemoveDir  = 1 << 4
+	landlockAccessFsRemoveFile = 1 << 5
+	landlockAccessFsMakeChar   = 1 << 6
+	landlockAccessFsMakeDir    = 1 << 7
+	landlockAccessFsMakeReg    = 1 << 8
+	landlockAccessFsMakeSock   = 1 << 9
+	landlockAccessFsMakeFifo   = 1 << 10
+	landlockAccessFsMakeBlock  = 1 << 11
+	landlockAccessFsMakeSym    = 1 << 12
+
+	landlockAccessFsWrite = landlockAccessFsWriteFile | landlockAccessFsRemoveDir | landlockAccessFsRemoveFile |
+		landlockAccessFsMakeChar | landlockAccessFsMakeDir | landlockAccessFsMakeReg | landlockAccessFsMakeSock |
+		landlockAccessFsMakeFifo | landlockAccessFsMakeBlock | landlockAccessFsMakeSym
+)
+
+type landlockRulesetAttr struct {
+	handledAccessFs uint64
+}
+
+type landlockPathBeneathAttr struct {
+	allowedAccess uint64
+	parentFd      int32
+}
+
+// minimal environment for wrapped commands
+func readOnlyEnvironment() []string {
+	return []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin", "LANG=C", "LC_ALL=C"}
+}
+
+// returns the Landlock ABI version of the kernel
+func landlockABIVersion() (int, error) {
+	version, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		return 0, errors.New("Landlock is not supported by this kernel: " + errno.Error())
+	}
+	return int(version), nil
+}
+
+// restricts the current thread and every command started from it through Landlock,
+// the calling goroutine stays locked to its thread
+func restrictFileSystemWrites(writableDirs []string, writableFiles []string) error {
+	if _, err := landlockABIVersion(); err != nil {
+		return err
+	}
+
+	rulesetAttr := landlockRulesetAttr{handledAccessFs: landlockAccessFsWrite}
+	rulesetFd, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&rulesetAttr)), unsafe.Sizeof(rulesetAttr), 0)
+	if errno != 0 {
+		return errors.New("cannot create Landlock ruleset: " + errno.Error())
+	}
+	defer syscall.Close(int(rulesetFd))
+
+	for _, dir := range writableDirs {
+		if err := addLandlockRule(int(rulesetFd), dir, landlockAccessFsWrite); err != nil {
+			return err
+		}
+	}
+	for _, file := range writableFiles {
+		if err := addLandlockRule(int(rulesetFd), file, landlockAccessFsWriteFile); err != nil {
+			return err
+		}
+	}
+
+	runtime.LockOSThread()
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return errors.New("cannot set no_new_privs: " + err.Error())
+	}
+	_, _, errno = syscall.Syscall(sysLandlockRestrictSelf, rulesetFd, 0, 0)
+	if errno != 0 {
+		return errors.New("cannot enforce Landlock ruleset: " + errno.Error())
+	}
+	return nil
+}
+
+func addLandlockRule(rulesetFd int, path string, access uint64) error {
+	file, err := os.OpenFile(path, unix.O_PATH|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	pathBeneath := landlockPathBeneathAttr{allowedAccess: access, parentFd: int32(file.Fd())}
+	_, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(rulesetFd), landlockRulePathBeneath, uintptr(unsafe.Pointer(&pathBeneath)), 0, 0, 0)
+	if errno != 0 {
+		return errors.New("cannot allow writes to " + path + ": " + errno.Error())
+	}
+	return nil
+}
+
+// Landlock does not change the checks of access(2), a path that passes them was denied by the ruleset,
+// for a path that does not exist the directory it would be created in is checked
+func isWriteDeniedByLandlock(path string) bool {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		path = filepath.Dir(path)
+	}
+	return unix.Access(path, unix.W_OK) == nil
+}
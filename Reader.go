@@ -51,6 +51,7 @@ type BigAudit struct {
 	Name             string `json:"name"`
 	Command          string `json:"command"`
 	DontSaveArtefact bool   `json:"dontSaveArtefact"`
+	SharedState      bool   `json:"sharedState"`
 	BlackenContent   string `json:"blackenContent"`
 	TypeExpected     string `json:"typeExpected"`
 	Expected         string `json:"expected"`
@@ -61,7 +62,12 @@ type BigAudits struct {
 	BigAuditArray []BigAudit `json:"commands"`
 }
 
+type JsLibraries struct {
+	Paths []string `json:"jsLibraries"`
+}
+
 var commands BigAudits
+var jsLibraries JsLibraries
 var system System
 var ConfigName string
 
@@ -98,8 +104,9 @@ func ReadConfig() {
 
 	commands = BigAudits{}
 	system = System{}
+	jsLibraries = JsLibraries{}
 
-	if checkJsonFormat(byteValue, &commands) && checkJsonFormat(byteValue, &system) {
+	if checkJsonFormat(byteValue, &commands) && checkJsonFormat(byteValue, &system) && checkJsonFormat(byteValue, &jsLibraries) {
 		WriteLog("JSON format correct", "INFO")
 		if debugModeEnabled {
 			WriteDebugLog("JSON format correct", "INFO")
@@ -0,0 +1,153 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	resultPassed  = "passed"
+	resultFailed  = "failed"
+	resultSkipped = "skipped"
+)
+
+type Evidence struct {
+	Name string `json:"Name"`
+	Text string `json:"Text"`
+}
+
+// outcome a script decided through the result object
+type CheckResult struct {
+	Status   string
+	Message  string
+	Details  interface{}
+	Evidence []Evidence
+}
+
+var checkResult CheckResult
+
+// adds result.pass(), result.fail(), result.skip() and result.evidence() to a runtime
+func registerResultAPI(vm *goja.Runtime) {
+	checkResult = CheckResult{}
+
+	result := vm.NewObject()
+	setResultFunction(result, "pass", func(call goja.FunctionCall) goja.Value {
+		setCheckStatus(resultPassed, optionalString(call, 0), nil)
+		return goja.Undefined()
+	})
+	setResultFunction(result, "fail", func(call goja.FunctionCall) goja.Value {
+		setCheckStatus(resultFailed, optionalString(call, 0), exportDetails(call.Argument(1)))
+		return goja.Undefined()
+	})
+	setResultFunction(result, "skip", func(call goja.FunctionCall) goja.Value {
+		setCheckStatus(resultSkipped, optionalString(call, 0), nil)
+		return goja.Undefined()
+	})
+	setResultFunction(result, "evidence", func(call goja.FunctionCall) goja.Value {
+		addEvidence(optionalString(call, 0), optionalString(call, 1))
+		return goja.Undefined()
+	})
+
+	err := vm.Set("result", result)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+}
+
+func setResultFunction(result *goja.Object, name string, function func(goja.FunctionCall) goja.Value) {
+	err := result.Set(name, function)
+	if err != nil {
+		WriteErrorLog(err.Error(), "")
+	}
+}
+
+// a failed check stays failed, otherwise the last call decides
+func setCheckStatus(status string, message string, details interface{}) {
+	if checkResult.Status == resultFailed {
+		if debugModeEnabled {
+			WriteDebugLog(bigAudit.Name+" already failed, result."+status+" ignored", "INFO")
+		}
+		return
+	}
+	checkResult.Status = status
+	checkResult.Message = message
+	checkResult.Details = details
+}
+
+// evidence is censored like the artefacts of the check
+func addEvidence(name string, text string) {
+	if bigAudit.BlackenContent != "" {
+		text = replaceRegex(bigAudit.BlackenContent, text)
+	}
+	for i, evidence := range checkResult.Evidence {
+		if evidence.Name == name {
+			checkResult.Evidence[i].Text = text
+			return
+		}
+	}
+	checkResult.Evidence = append(checkResult.Evidence, Evidence{Name: name, Text: text})
+}
+
+func optionalString(call goja.FunctionCall, position int) string {
+	argument := call.Argument(position)
+	if goja.IsUndefined(argument) || goja.IsNull(argument) {
+		return ""
+	}
+	return argument.String()
+}
+
+// details are written to result.json, values JSON cannot hold are saved as text
+func exportDetails(details goja.Value) interface{} {
+	if goja.IsUndefined(details) || goja.IsNull(details) {
+		return nil
+	}
+	exported := details.Export()
+	if _, err := json.Marshal(exported); err != nil {
+		return details.String()
+	}
+	return exported
+}
+
+// writes the outcome the script decided, expected is not compared
+func writeCheckResult(audit BigAudit) {
+	WriteScriptResultJSON(audit, checkResult)
+
+	logText := audit.Name + " " + checkResult.Status + " by script"
+	if checkResult.Message != "" {
+		logText += ": " + checkResult.Message
+	}
+	switch checkResult.Status {
+	case resultPassed:
+		WriteLog(logText, "INFO")
+	case resultFailed:
+		WriteLog(logText, "FAIL")
+	default:
+		WriteLog(logText, "WARN")
+	}
+	if debugModeEnabled {
+		WriteDebugLog(logText, "INFO")
+	}
+	auditResult = checkResult.Status == resultPassed
+}
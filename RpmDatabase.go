@@ -0,0 +1,205 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// the tags of a package header that the inventory needs
+type RpmHeader struct {
+	Name    string
+	Epoch   int
+	Version string
+	Release string
+	Arch    string
+}
+
+const (
+	rpmTagName    = 1000
+	rpmTagVersion = 1001
+	rpmTagRelease = 1002
+	rpmTagEpoch   = 1003
+	rpmTagArch    = 1022
+)
+
+const (
+	rpmTypeInt32  = 4
+	rpmTypeString = 6
+)
+
+const rpmHeaderEntrySize = 16
+
+const (
+	ndbHeaderMagic     = 'R' | 'p'<<8 | 'm'<<16 | 'P'<<24
+	ndbSlotMagic       = 'S' | 'l'<<8 | 'o'<<16 | 't'<<24
+	ndbBlobMagic       = 'B' | 'l'<<8 | 'b'<<16 | 'S'<<24
+	ndbHeaderSize      = 32
+	ndbPageSize        = 4096
+	ndbSlotSize        = 16
+	ndbBlobHeaderSize  = 16
+	ndbBlockSize       = 16
+	ndbMaximumSlotPage = 2048
+)
+
+// headers of the packages in rpmdb.sqlite, the blob column holds the header
+func readRpmSqlite(path string) ([]RpmHeader, error) {
+	database, err := openSqliteDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := readSqliteTable(database, "Packages")
+	if err != nil {
+		return nil, err
+	}
+
+	var headers []RpmHeader
+	for _, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		blob, ok := row[1].([]byte)
+		if !ok {
+			return nil, errors.New("rpm: " + path + " has a package without header")
+		}
+		header, err := parseRpmHeader(blob)
+		if err != nil {
+			return nil, errors.New("rpm: " + path + ": " + err.Error())
+		}
+		headers = append(headers, header)
+	}
+	return headers, nil
+}
+
+// Packages.db of rpm's ndb backend: a header, slot pages pointing to blocks and a blob per package
+func readRpmNdb(path string) ([]RpmHeader, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("rpm: cannot read " + path)
+	}
+	if len(content) < ndbHeaderSize || binary.LittleEndian.Uint32(content[0:4]) != ndbHeaderMagic || binary.LittleEndian.Uint32(content[4:8]) != 0 {
+		return nil, errors.New("rpm: " + path + " is not an ndb database")
+	}
+	slotPages := int(binary.LittleEndian.Uint32(content[12:16]))
+	if slotPages == 0 || slotPages > ndbMaximumSlotPage || slotPages*ndbPageSize > len(content) {
+		return nil, errors.New("rpm: " + path + " has an invalid number of slot pages")
+	}
+
+	var headers []RpmHeader
+	// the header takes the place of the first two slots
+	for offset := ndbHeaderSize; offset < slotPages*ndbPageSize; offset += ndbSlotSize {
+		slot := content[offset : offset+ndbSlotSize]
+		if binary.LittleEndian.Uint32(slot[0:4]) != ndbSlotMagic {
+			return nil, errors.New("rpm: " + path + " has a broken slot at " + fmt.Sprint(offset))
+		}
+		packageIndex := binary.LittleEndian.Uint32(slot[4:8])
+		if packageIndex == 0 {
+			continue
+		}
+
+		blobStart := int(binary.LittleEndian.Uint32(slot[8:12])) * ndbBlockSize
+		if blobStart+ndbBlobHeaderSize > len(content) {
+			return nil, errors.New("rpm: " + path + " has a slot pointing outside of the file")
+		}
+		blobHeader := content[blobStart : blobStart+ndbBlobHeaderSize]
+		if binary.LittleEndian.Uint32(blobHeader[0:4]) != ndbBlobMagic || binary.LittleEndian.Uint32(blobHeader[4:8]) != packageIndex {
+			return nil, errors.New("rpm: " + path + " has no blob for package " + fmt.Sprint(packageIndex))
+		}
+		blobLength := int(binary.LittleEndian.Uint32(blobHeader[12:16]))
+		if blobStart+ndbBlobHeaderSize+blobLength > len(content) {
+			return nil, errors.New("rpm: " + path + " has a truncated blob for package " + fmt.Sprint(packageIndex))
+		}
+
+		header, err := parseRpmHeader(content[blobStart+ndbBlobHeaderSize : blobStart+ndbBlobHeaderSize+blobLength])
+		if err != nil {
+			return nil, errors.New("rpm: " + path + ": " + err.Error())
+		}
+		headers = append(headers, header)
+	}
+	return headers, nil
+}
+
+// an index of tags followed by the data they point to, all numbers are big-endian
+func parseRpmHeader(blob []byte) (RpmHeader, error) {
+	var header RpmHeader
+	if len(blob) < 8 {
+		return header, errors.New("package header is too short")
+	}
+	indexCount := int(binary.BigEndian.Uint32(blob[0:4]))
+	dataLength := int(binary.BigEndian.Uint32(blob[4:8]))
+	dataStart := 8 + indexCount*rpmHeaderEntrySize
+	if indexCount < 0 || dataLength < 0 || dataStart < 8 || dataStart+dataLength > len(blob) {
+		return header, errors.New("package header has an invalid size")
+	}
+	data := blob[dataStart : dataStart+dataLength]
+
+	for i := 0; i < indexCount; i++ {
+		entry := blob[8+i*rpmHeaderEntrySize : 8+(i+1)*rpmHeaderEntrySize]
+		tag := binary.BigEndian.Uint32(entry[0:4])
+		tagType := binary.BigEndian.Uint32(entry[4:8])
+		offset := int(binary.BigEndian.Uint32(entry[8:12]))
+		if offset < 0 || offset >= len(data) {
+			continue
+		}
+
+		switch {
+		case tagType == rpmTypeString && tag == rpmTagName:
+			header.Name = rpmHeaderString(data[offset:])
+		case tagType == rpmTypeString && tag == rpmTagVersion:
+			header.Version = rpmHeaderString(data[offset:])
+		case tagType == rpmTypeString && tag == rpmTagRelease:
+			header.Release = rpmHeaderString(data[offset:])
+		case tagType == rpmTypeString && tag == rpmTagArch:
+			header.Arch = rpmHeaderString(data[offset:])
+		case tagType == rpmTypeInt32 && tag == rpmTagEpoch && offset+4 <= len(data):
+			header.Epoch = int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		}
+	}
+	if header.Name == "" {
+		return header, errors.New("package header has no name")
+	}
+	return header, nil
+}
+
+func rpmHeaderString(data []byte) string {
+	if end := bytes.IndexByte(data, 0); end >= 0 {
+		return string(data[:end])
+	}
+	return string(data)
+}
+
+// "epoch:version-release" like rpm -q prints it, the epoch only if it is set
+func rpmFullVersion(header RpmHeader) string {
+	version := header.Version
+	if header.Release != "" {
+		version += "-" + header.Release
+	}
+	if header.Epoch != 0 {
+		version = fmt.Sprint(header.Epoch) + ":" + version
+	}
+	return strings.TrimPrefix(version, "-")
+}
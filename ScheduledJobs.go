@@ -0,0 +1,369 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type ScheduledJob struct {
+	Source   string                 `json:"source"`
+	Schedule string                 `json:"schedule"`
+	Command  string                 `json:"command"`
+	User     string                 `json:"user"`
+	Enabled  bool                   `json:"enabled"`
+	File     string                 `json:"file"`
+	Line     int                    `json:"line"`
+	FileStat map[string]interface{} `json:"fileStat"`
+}
+
+// users is only set for cron.allow and cron.deny
+type ScheduledJobFile struct {
+	Path      string                 `json:"path"`
+	Source    string                 `json:"source"`
+	Directory bool                   `json:"directory"`
+	Exists    bool                   `json:"exists"`
+	FileStat  map[string]interface{} `json:"fileStat"`
+	Users     []string               `json:"users"`
+}
+
+const (
+	systemCrontabFile = "/etc/crontab"
+	cronDirectory     = "/etc/cron.d"
+	anacrontabFile    = "/etc/anacrontab"
+	cronAllowFile     = "/etc/cron.allow"
+	cronDenyFile      = "/etc/cron.deny"
+)
+
+// Debian, RHEL and SUSE keep the crontabs of the users in different places
+var cronSpoolDirectories = []string{"/var/spool/cron/crontabs", "/var/spool/cron", "/var/spool/cron/tabs"}
+
+// directories run by run-parts with the schedule of the job that runs them
+var cronPeriodicDirectories = []string{"/etc/cron.hourly", "/etc/cron.daily", "/etc/cron.weekly", "/etc/cron.monthly"}
+
+var timerScheduleKeys = []string{"OnCalendar", "OnActiveSec", "OnBootSec", "OnStartupSec", "OnUnitActiveSec", "OnUnitInactiveSec"}
+
+var cronEnvironmentRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\s*=`)
+
+// only Debian and its derivatives have this file
+const debianVersionFile = "/etc/debian_version"
+
+// run-parts of Debian only runs names made of these characters
+var runPartsNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// jobs of cron, anacron and systemd timers with the mode and owner of the file they are set in
+func ScheduledJobs() ([]interface{}, error) {
+	jobs, err := readScheduledJobs()
+	if err != nil {
+		return nil, err
+	}
+	return toJavaScriptValue(jobs).([]interface{}), nil
+}
+
+func readScheduledJobs() ([]ScheduledJob, error) {
+	jobs := []ScheduledJob{}
+	found, err := parseCrontab(systemCrontabFile, "crontab", "")
+	if err != nil {
+		return nil, err
+	}
+	jobs = append(jobs, found...)
+
+	for _, file := range cronDFiles() {
+		found, err = parseCrontab(file, "cron.d", "")
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, found...)
+	}
+
+	for _, directory := range cronSpoolDirectories {
+		for _, file := range cronDirectoryFiles(directory) {
+			found, err = parseCrontab(file, "spool", filepath.Base(file))
+			if err != nil {
+				// the spool is only readable by root
+				WriteLog(err.Error(), "WARN")
+				continue
+			}
+			jobs = append(jobs, found...)
+		}
+	}
+
+	found, err = parseAnacrontab(anacrontabFile)
+	if err != nil {
+		return nil, err
+	}
+	jobs = append(jobs, found...)
+	jobs = append(jobs, periodicCronJobs()...)
+
+	found, err = timerJobs()
+	if err != nil {
+		return nil, err
+	}
+	return append(jobs, found...), nil
+}
+
+// every file and directory of cron and anacron with its stat, the fixed paths are also listed if they do not exist
+func ScheduledJobFiles() []interface{} {
+	return toJavaScriptValue(readScheduledJobFiles()).([]interface{})
+}
+
+func readScheduledJobFiles() []ScheduledJobFile {
+	files := []ScheduledJobFile{scheduledJobFile(systemCrontabFile, "crontab")}
+	files = append(files, scheduledJobDirectoryFiles(cronDirectory, "cron.d")...)
+	for _, directory := range cronPeriodicDirectories {
+		files = append(files, scheduledJobDirectoryFiles(directory, filepath.Base(directory))...)
+	}
+	for _, directory := range cronSpoolDirectories {
+		if checkPathExists(hostPath(directory)) {
+			files = append(files, scheduledJobDirectoryFiles(directory, "spool")...)
+		}
+	}
+	files = append(files, scheduledJobFile(anacrontabFile, "anacrontab"))
+	for _, path := range []string{cronAllowFile, cronDenyFile} {
+		file := scheduledJobFile(path, filepath.Base(path))
+		file.Users = []string{}
+		if file.Exists {
+			file.Users = readCronUsers(path)
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// the directory and every file in it, also the ones cron skips
+func scheduledJobDirectoryFiles(directory string, source string) []ScheduledJobFile {
+	files := []ScheduledJobFile{scheduledJobFile(directory, source)}
+	entries, _ := ioutil.ReadDir(hostPath(directory))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files = append(files, scheduledJobFile(filepath.Join(directory, entry.Name()), source))
+		}
+	}
+	return files
+}
+
+func scheduledJobFile(path string, source string) ScheduledJobFile {
+	file := ScheduledJobFile{Path: path, Source: source}
+	fileStat, err := Stat(hostPath(path))
+	if err != nil {
+		return file
+	}
+	file.Exists = true
+	file.Directory, _ = fileStat["isDir"].(bool)
+	file.FileStat = fileStat
+	return file
+}
+
+// one user per line, cron.allow is only readable by root on some systems
+func readCronUsers(path string) []string {
+	users := []string{}
+	content, err := ioutil.ReadFile(hostPath(path))
+	if err != nil {
+		WriteLog("cron: cannot read "+path+", its users are unknown", "WARN")
+		return users
+	}
+	saveFileArtefact(hostPath(path), content)
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			users = append(users, line)
+		}
+	}
+	return users
+}
+
+// files cron reads from a directory, hidden files, backups and files of the package manager are skipped
+func cronDirectoryFiles(directory string) []string {
+	var files []string
+	entries, _ := ioutil.ReadDir(hostPath(directory))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") || strings.Contains(name, ".dpkg-") || strings.Contains(name, ".rpm") {
+			continue
+		}
+		files = append(files, filepath.Join(directory, name))
+	}
+	return files
+}
+
+// cron of Debian skips names in /etc/cron.d that run-parts would not run, like "job.conf" or "job.bak"
+func cronDFiles() []string {
+	files := cronDirectoryFiles(cronDirectory)
+	if !checkPathExists(hostPath(debianVersionFile)) {
+		return files
+	}
+	var runPartsFiles []string
+	for _, file := range files {
+		if runPartsNameRegex.MatchString(filepath.Base(file)) {
+			runPartsFiles = append(runPartsFiles, file)
+		}
+	}
+	return runPartsFiles
+}
+
+// the crontab of a user has no user field, a missing file has no jobs
+func parseCrontab(path string, source string, owner string) ([]ScheduledJob, error) {
+	content, err := ioutil.ReadFile(hostPath(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New("cron: cannot read " + path)
+	}
+	saveFileArtefact(hostPath(path), content)
+	fileStat, _ := Stat(hostPath(path))
+
+	var jobs []ScheduledJob
+	for number, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || cronEnvironmentRegex.MatchString(line) {
+			continue
+		}
+		timeFields := 5
+		if strings.HasPrefix(line, "@") {
+			timeFields = 1
+		}
+		userFields := 1
+		if owner != "" {
+			userFields = 0
+		}
+		fields, command := splitCronLine(line, timeFields+userFields)
+		if command == "" {
+			return nil, errors.New("cron: " + path + " line " + strconv.Itoa(number+1) + ": missing command")
+		}
+		job := ScheduledJob{Source: source, Schedule: strings.Join(fields[:timeFields], " "), Command: command, User: owner, Enabled: true, File: path, Line: number + 1, FileStat: fileStat}
+		if owner == "" {
+			job.User = fields[timeFields]
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// the first count fields and the rest of the line with its spacing kept
+func splitCronLine(line string, count int) ([]string, string) {
+	var fields []string
+	rest := line
+	for len(fields) < count {
+		rest = strings.TrimLeft(rest, " \t")
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			if rest != "" {
+				fields = append(fields, rest)
+			}
+			return fields, ""
+		}
+		fields = append(fields, rest[:end])
+		rest = rest[end:]
+	}
+	return fields, strings.TrimSpace(rest)
+}
+
+// "period delay identifier command", the period is in days or @daily, @weekly, @monthly
+func parseAnacrontab(path string) ([]ScheduledJob, error) {
+	content, err := ioutil.ReadFile(hostPath(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New("anacron: cannot read " + path)
+	}
+	saveFileArtefact(hostPath(path), content)
+	fileStat, _ := Stat(hostPath(path))
+
+	var jobs []ScheduledJob
+	for number, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || cronEnvironmentRegex.MatchString(line) {
+			continue
+		}
+		fields, command := splitCronLine(line, 3)
+		if command == "" {
+			return nil, errors.New("anacron: " + path + " line " + strconv.Itoa(number+1) + ": missing command")
+		}
+		jobs = append(jobs, ScheduledJob{Source: "anacrontab", Schedule: fields[0], Command: command, User: "root", Enabled: true, File: path, Line: number + 1, FileStat: fileStat})
+	}
+	return jobs, nil
+}
+
+// scripts in /etc/cron.daily and the like, run-parts only runs executable files
+func periodicCronJobs() []ScheduledJob {
+	var jobs []ScheduledJob
+	for _, directory := range cronPeriodicDirectories {
+		entries, _ := ioutil.ReadDir(hostPath(directory))
+		for _, entry := range entries {
+			if entry.IsDir() || !runPartsNameRegex.MatchString(entry.Name()) {
+				continue
+			}
+			path := filepath.Join(directory, entry.Name())
+			fileStat, _ := Stat(hostPath(path))
+			schedule := "@" + strings.TrimPrefix(filepath.Base(directory), "cron.")
+			jobs = append(jobs, ScheduledJob{Source: filepath.Base(directory), Schedule: schedule, Command: path, User: "root", Enabled: entry.Mode()&0111 != 0, File: path, FileStat: fileStat})
+		}
+	}
+	return jobs
+}
+
+// the schedule is made of the On* settings, the command is the ExecStart of the unit the timer starts
+func timerJobs() ([]ScheduledJob, error) {
+	var jobs []ScheduledJob
+	for _, name := range listSystemdUnits(".timer") {
+		timer, found, err := loadSystemdUnit(name)
+		if err != nil {
+			return nil, err
+		}
+		if !found || timer.Masked {
+			continue
+		}
+		var schedule []string
+		for _, key := range timerScheduleKeys {
+			for _, value := range timer.Sections["Timer"][key] {
+				schedule = append(schedule, key+"="+value)
+			}
+		}
+
+		job := ScheduledJob{Source: "timer", Schedule: strings.Join(schedule, "; "), User: "root", Enabled: isSystemdUnitEnabled(name), File: timer.Path}
+		job.FileStat, _ = Stat(hostPath(timer.Path))
+		serviceName := systemdUnitValue(timer, "Timer", "Unit")
+		if serviceName == "" {
+			serviceName = strings.TrimSuffix(name, ".timer") + ".service"
+		}
+		service, found, err := loadSystemdUnit(serviceName)
+		if err != nil {
+			return nil, err
+		}
+		if found && !service.Masked {
+			job.Command = strings.Join(service.Sections["Service"]["ExecStart"], "; ")
+			if user := systemdUnitValue(service, "Service", "User"); user != "" {
+				job.User = user
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,363 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+// read-only access to the tables of a SQLite 3 file, only what the rpm database needs
+type SqliteDatabase struct {
+	Path       string
+	Content    []byte
+	PageSize   int
+	UsableSize int
+	WalPages   map[uint32][]byte
+}
+
+const sqliteMagic = "SQLite format 3\x00"
+const sqliteWalHeaderSize = 32
+const sqliteWalFrameHeaderSize = 24
+
+// the lowest bit of the magic number tells the byte order of the checksums
+const sqliteWalMagic = 0x377f0682
+
+// the format allows no smaller usable size and no larger record
+const sqliteMinUsableSize = 480
+const sqliteMaxPayloadSize = math.MaxInt32
+
+const (
+	sqliteInteriorTable = 0x05
+	sqliteLeafTable     = 0x0d
+)
+
+// pages of committed transactions in the -wal file replace the pages of the file
+func openSqliteDatabase(path string) (*SqliteDatabase, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("sqlite: cannot read " + path)
+	}
+	if len(content) < 100 || string(content[:16]) != sqliteMagic {
+		return nil, errors.New("sqlite: " + path + " is not a SQLite 3 database")
+	}
+	pageSize := int(binary.BigEndian.Uint16(content[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, errors.New("sqlite: " + path + " has an invalid page size")
+	}
+	database := &SqliteDatabase{Path: path, Content: content, PageSize: pageSize, UsableSize: pageSize - int(content[20])}
+	if database.UsableSize < sqliteMinUsableSize {
+		return nil, errors.New("sqlite: " + path + " has an invalid reserved space")
+	}
+
+	database.WalPages = make(map[uint32][]byte)
+	if wal, err := ioutil.ReadFile(path + "-wal"); err == nil {
+		database.WalPages = readSqliteWal(wal, pageSize)
+	}
+	return database, nil
+}
+
+// frames with the salt of the header and a valid checksum up to the last commit frame,
+// frames left over from an earlier checkpoint fail one of both
+func readSqliteWal(wal []byte, pageSize int) map[uint32][]byte {
+	committed := make(map[uint32][]byte)
+	if len(wal) < sqliteWalHeaderSize || int(binary.BigEndian.Uint32(wal[8:12])) != pageSize {
+		return committed
+	}
+	magic := binary.BigEndian.Uint32(wal[0:4])
+	if magic&^1 != sqliteWalMagic {
+		return committed
+	}
+	bigEndian := magic&1 == 1
+	checksum0, checksum1 := sqliteWalChecksum(wal[0:24], bigEndian, 0, 0)
+	if checksum0 != binary.BigEndian.Uint32(wal[24:28]) || checksum1 != binary.BigEndian.Uint32(wal[28:32]) {
+		return committed
+	}
+
+	salt := wal[16:24]
+	pending := make(map[uint32][]byte)
+	for offset := sqliteWalHeaderSize; offset+sqliteWalFrameHeaderSize+pageSize <= len(wal); offset += sqliteWalFrameHeaderSize + pageSize {
+		frameHeader := wal[offset : offset+sqliteWalFrameHeaderSize]
+		if !bytes.Equal(frameHeader[8:16], salt) {
+			break
+		}
+		// the checksum of a frame continues the one of the frame before
+		checksum0, checksum1 = sqliteWalChecksum(frameHeader[0:8], bigEndian, checksum0, checksum1)
+		checksum0, checksum1 = sqliteWalChecksum(wal[offset+sqliteWalFrameHeaderSize:offset+sqliteWalFrameHeaderSize+pageSize], bigEndian, checksum0, checksum1)
+		if checksum0 != binary.BigEndian.Uint32(frameHeader[16:20]) || checksum1 != binary.BigEndian.Uint32(frameHeader[20:24]) {
+			break
+		}
+		pending[binary.BigEndian.Uint32(frameHeader[0:4])] = wal[offset+sqliteWalFrameHeaderSize : offset+sqliteWalFrameHeaderSize+pageSize]
+		if binary.BigEndian.Uint32(frameHeader[4:8]) != 0 {
+			for page, data := range pending {
+				committed[page] = data
+			}
+			pending = make(map[uint32][]byte)
+		}
+	}
+	return committed
+}
+
+// the Fletcher-like checksum of the WAL format over pairs of 32 bit words
+func sqliteWalChecksum(data []byte, bigEndian bool, checksum0 uint32, checksum1 uint32) (uint32, uint32) {
+	for i := 0; i+8 <= len(data); i += 8 {
+		word0, word1 := binary.LittleEndian.Uint32(data[i:i+4]), binary.LittleEndian.Uint32(data[i+4:i+8])
+		if bigEndian {
+			word0, word1 = binary.BigEndian.Uint32(data[i:i+4]), binary.BigEndian.Uint32(data[i+4:i+8])
+		}
+		checksum0 += word0 + checksum1
+		checksum1 += word1 + checksum0
+	}
+	return checksum0, checksum1
+}
+
+func sqlitePage(database *SqliteDatabase, number uint32) ([]byte, error) {
+	if page, ok := database.WalPages[number]; ok {
+		return page, nil
+	}
+	start := int64(number-1) * int64(database.PageSize)
+	if number == 0 || start+int64(database.PageSize) > int64(len(database.Content)) {
+		return nil, errors.New("sqlite: " + database.Path + " has no page " + fmt.Sprint(number))
+	}
+	return database.Content[start : start+int64(database.PageSize)], nil
+}
+
+// rows of a table in rowid order, the columns are int64, float64, string, []byte or nil
+func readSqliteTable(database *SqliteDatabase, table string) ([][]interface{}, error) {
+	schema, err := sqliteTableRows(database, 1)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range schema {
+		if len(row) < 4 || row[0] != "table" || row[1] != table {
+			continue
+		}
+		rootPage, ok := row[3].(int64)
+		if !ok {
+			break
+		}
+		return sqliteTableRows(database, uint32(rootPage))
+	}
+	return nil, errors.New("sqlite: " + database.Path + " has no table " + table)
+}
+
+func sqliteTableRows(database *SqliteDatabase, rootPage uint32) ([][]interface{}, error) {
+	var rows [][]interface{}
+	visited := make(map[uint32]bool)
+	var walk func(pageNumber uint32) error
+	walk = func(pageNumber uint32) error {
+		if visited[pageNumber] {
+			return errors.New("sqlite: " + database.Path + " has a loop in its pages")
+		}
+		visited[pageNumber] = true
+		page, err := sqlitePage(database, pageNumber)
+		if err != nil {
+			return err
+		}
+
+		headerOffset := 0
+		if pageNumber == 1 {
+			headerOffset = 100
+		}
+		pageType := page[headerOffset]
+		cellCount := int(binary.BigEndian.Uint16(page[headerOffset+3 : headerOffset+5]))
+		cellPointers := headerOffset + 8
+		if pageType == sqliteInteriorTable {
+			cellPointers = headerOffset + 12
+		} else if pageType != sqliteLeafTable {
+			return errors.New("sqlite: " + database.Path + " page " + fmt.Sprint(pageNumber) + " is not a table page")
+		}
+
+		for i := 0; i < cellCount; i++ {
+			pointer := cellPointers + 2*i
+			if pointer+2 > len(page) {
+				return errors.New("sqlite: " + database.Path + " page " + fmt.Sprint(pageNumber) + " is truncated")
+			}
+			cell := int(binary.BigEndian.Uint16(page[pointer : pointer+2]))
+			if cell+4 > len(page) {
+				return errors.New("sqlite: " + database.Path + " page " + fmt.Sprint(pageNumber) + " has an invalid cell")
+			}
+			if pageType == sqliteInteriorTable {
+				if err := walk(binary.BigEndian.Uint32(page[cell : cell+4])); err != nil {
+					return err
+				}
+				continue
+			}
+			payload, err := sqliteCellPayload(database, page, cell)
+			if err != nil {
+				return err
+			}
+			row, err := decodeSqliteRecord(payload)
+			if err != nil {
+				return errors.New("sqlite: " + database.Path + " page " + fmt.Sprint(pageNumber) + ": " + err.Error())
+			}
+			rows = append(rows, row)
+		}
+		if pageType == sqliteInteriorTable {
+			return walk(binary.BigEndian.Uint32(page[headerOffset+8 : headerOffset+12]))
+		}
+		return nil
+	}
+	return rows, walk(rootPage)
+}
+
+// payload of a leaf cell, large payloads continue on a chain of overflow pages
+func sqliteCellPayload(database *SqliteDatabase, page []byte, cell int) ([]byte, error) {
+	payloadSize, length := sqliteVarint(page[cell:])
+	cell += length
+	_, rowidLength := sqliteVarint(page[cell:])
+	cell += rowidLength
+	if length == 0 || rowidLength == 0 || payloadSize > sqliteMaxPayloadSize {
+		return nil, errors.New("sqlite: " + database.Path + " has an invalid cell")
+	}
+
+	usable := database.UsableSize
+	maxLocal := usable - 35
+	local := int(payloadSize)
+	if local > maxLocal {
+		minLocal := (usable-12)*32/255 - 23
+		local = minLocal + (int(payloadSize)-minLocal)%(usable-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if cell+local > database.UsableSize || local != int(payloadSize) && cell+local+4 > database.UsableSize {
+		return nil, errors.New("sqlite: " + database.Path + " has a cell larger than its page")
+	}
+	payload := append([]byte{}, page[cell:cell+local]...)
+	if local == int(payloadSize) {
+		return payload, nil
+	}
+	// every overflow page holds usable-4 bytes, a larger payload than the pages can hold is broken
+	if (int(payloadSize)-local)/(usable-4) > len(database.Content)/database.PageSize+len(database.WalPages) {
+		return nil, errors.New("sqlite: " + database.Path + " has a broken overflow chain")
+	}
+
+	overflowPage := binary.BigEndian.Uint32(page[cell+local : cell+local+4])
+	for pages := 0; len(payload) < int(payloadSize); pages++ {
+		if overflowPage == 0 || pages > len(database.Content)/database.PageSize+len(database.WalPages) {
+			return nil, errors.New("sqlite: " + database.Path + " has a broken overflow chain")
+		}
+		overflow, err := sqlitePage(database, overflowPage)
+		if err != nil {
+			return nil, err
+		}
+		remaining := int(payloadSize) - len(payload)
+		if remaining > usable-4 {
+			remaining = usable - 4
+		}
+		payload = append(payload, overflow[4:4+remaining]...)
+		overflowPage = binary.BigEndian.Uint32(overflow[0:4])
+	}
+	return payload, nil
+}
+
+// a header with the serial types of the columns followed by their values
+func decodeSqliteRecord(payload []byte) ([]interface{}, error) {
+	headerSize, length := sqliteVarint(payload)
+	if headerSize > uint64(len(payload)) || length == 0 {
+		return nil, errors.New("invalid record")
+	}
+	var serialTypes []uint64
+	for position := length; position < int(headerSize); {
+		serialType, length := sqliteVarint(payload[position:int(headerSize)])
+		if length == 0 {
+			return nil, errors.New("invalid record header")
+		}
+		serialTypes = append(serialTypes, serialType)
+		position += length
+	}
+
+	var values []interface{}
+	body := payload[headerSize:]
+	for _, serialType := range serialTypes {
+		if serialType > uint64(2*len(body)+13) {
+			return nil, errors.New("record is shorter than its header")
+		}
+		size := sqliteSerialSize(serialType)
+		if size > len(body) {
+			return nil, errors.New("record is shorter than its header")
+		}
+		value := body[:size]
+		body = body[size:]
+		switch {
+		case serialType == 0:
+			values = append(values, nil)
+		case serialType <= 6:
+			number := int64(0)
+			if value[0]&0x80 != 0 {
+				number = -1
+			}
+			for _, b := range value {
+				number = number<<8 | int64(b)
+			}
+			values = append(values, number)
+		case serialType == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(value)))
+		case serialType == 8 || serialType == 9:
+			values = append(values, int64(serialType-8))
+		case serialType >= 12 && serialType%2 == 0:
+			values = append(values, append([]byte{}, value...))
+		case serialType >= 13:
+			values = append(values, string(value))
+		default:
+			return nil, errors.New("unknown serial type " + fmt.Sprint(serialType))
+		}
+	}
+	return values, nil
+}
+
+func sqliteSerialSize(serialType uint64) int {
+	switch {
+	case serialType >= 12:
+		return int((serialType - 12) / 2)
+	case serialType == 5:
+		return 6
+	case serialType == 6 || serialType == 7:
+		return 8
+	case serialType >= 1 && serialType <= 4:
+		return int(serialType)
+	}
+	return 0
+}
+
+// big-endian with 7 bits per byte, the ninth byte has 8 bits, the length is 0 if data is missing
+func sqliteVarint(data []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < 9 && i < len(data); i++ {
+		if i == 8 {
+			return value<<8 | uint64(data[i]), 9
+		}
+		value = value<<7 | uint64(data[i]&0x7f)
+		if data[i]&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,474 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type SshdDirective struct {
+	Keyword string
+	Args    []string
+	File    string
+	Line    int
+}
+
+// directives after a Match line belong to it until the next Match
+type SshdMatchBlock struct {
+	Criteria   []string
+	File       string
+	Line       int
+	Directives []SshdDirective
+}
+
+type SshdConfigFile struct {
+	Global      []SshdDirective
+	MatchBlocks []SshdMatchBlock
+}
+
+// connection the Match blocks are evaluated for, like sshd -T -C
+type SshdMatchContext struct {
+	User         string   `json:"user"`
+	Groups       []string `json:"groups"`
+	Host         string   `json:"host"`
+	Address      string   `json:"address"`
+	LocalAddress string   `json:"localAddress"`
+	LocalPort    string   `json:"localPort"`
+	RDomain      string   `json:"rdomain"`
+}
+
+const sshdDefaultConfig = "/etc/ssh/sshd_config"
+const sshdConfigDir = "/etc/ssh"
+const sshdMaxIncludeDepth = 16
+
+// keywords that collect every value instead of keeping the first one
+var sshdListKeywords = map[string]bool{
+	"acceptenv": true, "allowgroups": true, "allowusers": true, "denygroups": true, "denyusers": true, "setenv": true,
+}
+
+// keywords that collect every directive as one entry
+var sshdRepeatedKeywords = map[string]bool{
+	"hostkey": true, "hostcertificate": true, "listenaddress": true, "port": true, "subsystem": true,
+}
+
+var sshdKeywordAliases = map[string]string{
+	"challengeresponseauthentication": "kbdinteractiveauthentication",
+	"dsaauthentication":               "pubkeyauthentication",
+	"skeyauthentication":              "kbdinteractiveauthentication",
+	"pubkeyacceptedkeytypes":          "pubkeyacceptedalgorithms",
+	"hostbasedacceptedkeytypes":       "hostbasedacceptedalgorithms",
+}
+
+// built-in values of OpenSSH for keywords that are not set
+var sshdDefaults = map[string]string{
+	"addressfamily":                "any",
+	"allowagentforwarding":         "yes",
+	"allowstreamlocalforwarding":   "yes",
+	"allowtcpforwarding":           "yes",
+	"authorizedkeysfile":           ".ssh/authorized_keys .ssh/authorized_keys2",
+	"banner":                       "none",
+	"clientalivecountmax":          "3",
+	"clientaliveinterval":          "0",
+	"compression":                  "yes",
+	"disableforwarding":            "no",
+	"gatewayports":                 "no",
+	"gssapiauthentication":         "no",
+	"hostbasedauthentication":      "no",
+	"ignorerhosts":                 "yes",
+	"ignoreuserknownhosts":         "no",
+	"kbdinteractiveauthentication": "yes",
+	"kerberosauthentication":       "no",
+	"logingracetime":               "120",
+	"loglevel":                     "INFO",
+	"maxauthtries":                 "6",
+	"maxsessions":                  "10",
+	"maxstartups":                  "10:30:100",
+	"passwordauthentication":       "yes",
+	"permitemptypasswords":         "no",
+	"permitopen":                   "any",
+	"permitrootlogin":              "prohibit-password",
+	"permittty":                    "yes",
+	"permittunnel":                 "no",
+	"permituserenvironment":        "no",
+	"permituserrc":                 "yes",
+	"printlastlog":                 "yes",
+	"printmotd":                    "yes",
+	"pubkeyauthentication":         "yes",
+	"strictmodes":                  "yes",
+	"syslogfacility":               "AUTH",
+	"tcpkeepalive":                 "yes",
+	"usedns":                       "no",
+	"usepam":                       "no",
+	"x11displayoffset":             "10",
+	"x11forwarding":                "no",
+	"x11uselocalhost":              "yes",
+}
+
+var sshdRepeatedDefaults = map[string][]string{
+	"hostkey":       {"/etc/ssh/ssh_host_rsa_key", "/etc/ssh/ssh_host_ecdsa_key", "/etc/ssh/ssh_host_ed25519_key"},
+	"listenaddress": {"0.0.0.0", "::"},
+	"port":          {"22"},
+}
+
+// effective sshd configuration, Match blocks are only applied if a context is given
+func SshdConfig(path string, context map[string]interface{}) (map[string]interface{}, error) {
+	if path == "" {
+		path = sshdDefaultConfig
+	}
+	config, err := parseSshdConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var matchContext *SshdMatchContext
+	if context != nil {
+		matchContext, err = toSshdMatchContext(context)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return effectiveSshdConfig(config, matchContext)
+}
+
+// groups of the user are looked up on this host if they are not given
+func toSshdMatchContext(context map[string]interface{}) (*SshdMatchContext, error) {
+	contextJson, err := json.Marshal(context)
+	if err != nil {
+		return nil, errors.New("invalid match context: " + err.Error())
+	}
+	var matchContext SshdMatchContext
+	if err := json.Unmarshal(contextJson, &matchContext); err != nil {
+		return nil, errors.New("invalid match context: " + err.Error())
+	}
+	if matchContext.User != "" && matchContext.Groups == nil {
+		matchContext.Groups = lookupUserGroups(matchContext.User)
+	}
+	return &matchContext, nil
+}
+
+func parseSshdConfig(path string) (SshdConfigFile, error) {
+	var config SshdConfigFile
+	err := parseSshdConfigFile(hostPath(path), &config, -1, 0)
+	return config, err
+}
+
+// Include is replaced by the files it matches, also inside a Match block,
+// a Match in an included file ends at the end of that file
+func parseSshdConfigFile(path string, config *SshdConfigFile, matchIndex int, depth int) error {
+	if depth > sshdMaxIncludeDepth {
+		return errors.New("sshd config: too many nested includes in " + path)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	saveFileArtefact(path, content)
+
+	for i, line := range strings.Split(string(content), "\n") {
+		keyword, args, err := splitSshdLine(line)
+		if err != nil {
+			return errors.New("sshd config: " + path + " line " + fmt.Sprint(i+1) + ": " + err.Error())
+		}
+		switch keyword {
+		case "":
+		case "include":
+			if len(args) == 0 {
+				return errors.New("sshd config: " + path + " line " + fmt.Sprint(i+1) + ": Include without a file")
+			}
+			for _, pattern := range args {
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(sshdConfigDir, pattern)
+				}
+				files, _ := filepath.Glob(hostPath(pattern))
+				sort.Strings(files)
+				for _, file := range files {
+					if err := parseSshdConfigFile(file, config, matchIndex, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+		case "match":
+			config.MatchBlocks = append(config.MatchBlocks, SshdMatchBlock{Criteria: args, File: path, Line: i + 1})
+			matchIndex = len(config.MatchBlocks) - 1
+		default:
+			directive := SshdDirective{Keyword: keyword, Args: args, File: path, Line: i + 1}
+			if matchIndex < 0 {
+				config.Global = append(config.Global, directive)
+			} else {
+				config.MatchBlocks[matchIndex].Directives = append(config.MatchBlocks[matchIndex].Directives, directive)
+			}
+		}
+	}
+	return nil
+}
+
+// keyword and arguments of a line, "Keyword value", "Keyword=value" and quoted values are allowed
+func splitSshdLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+	keywordEnd := strings.IndexAny(line, " \t=")
+	if keywordEnd < 0 {
+		keywordEnd = len(line)
+	}
+	keyword := strings.ToLower(line[:keywordEnd])
+	rest := strings.TrimLeft(line[keywordEnd:], " \t")
+	rest = strings.TrimLeft(strings.TrimPrefix(rest, "="), " \t")
+
+	var args []string
+	for rest != "" {
+		if strings.HasPrefix(rest, "#") {
+			break
+		}
+		var arg string
+		if strings.HasPrefix(rest, "\"") {
+			quoteEnd := strings.Index(rest[1:], "\"")
+			if quoteEnd < 0 {
+				return "", nil, errors.New("unterminated quote")
+			}
+			arg = rest[1 : quoteEnd+1]
+			rest = rest[quoteEnd+2:]
+		} else {
+			argEnd := strings.IndexAny(rest, " \t")
+			if argEnd < 0 {
+				argEnd = len(rest)
+			}
+			arg = rest[:argEnd]
+			rest = rest[argEnd:]
+		}
+		args = append(args, arg)
+		rest = strings.TrimLeft(rest, " \t")
+	}
+
+	if alias, ok := sshdKeywordAliases[keyword]; ok {
+		keyword = alias
+	}
+	return keyword, args, nil
+}
+
+// the first value of a keyword wins, values of matching blocks replace the global ones
+func effectiveSshdConfig(config SshdConfigFile, matchContext *SshdMatchContext) (map[string]interface{}, error) {
+	values := make(map[string][]string)
+	applySshdDirectives(values, config.Global)
+
+	if matchContext != nil {
+		matchValues := make(map[string][]string)
+		for _, matchBlock := range config.MatchBlocks {
+			matches, err := sshdMatches(matchBlock.Criteria, matchContext)
+			if err != nil {
+				return nil, errors.New("sshd config: " + matchBlock.File + " line " + fmt.Sprint(matchBlock.Line) + ": " + err.Error())
+			}
+			if matches {
+				applySshdDirectives(matchValues, matchBlock.Directives)
+			}
+		}
+		for keyword, value := range matchValues {
+			values[keyword] = value
+		}
+	}
+
+	effective := make(map[string]interface{})
+	for keyword, value := range sshdDefaults {
+		effective[keyword] = value
+	}
+	for keyword, value := range sshdRepeatedDefaults {
+		effective[keyword] = value
+	}
+	for keyword, value := range values {
+		if sshdListKeywords[keyword] || sshdRepeatedKeywords[keyword] {
+			effective[keyword] = value
+		} else {
+			effective[keyword] = value[0]
+		}
+	}
+	return effective, nil
+}
+
+func applySshdDirectives(values map[string][]string, directives []SshdDirective) {
+	collected := make(map[string]bool)
+	for _, directive := range directives {
+		keyword := directive.Keyword
+		switch {
+		case sshdListKeywords[keyword]:
+			values[keyword] = append(values[keyword], directive.Args...)
+		case sshdRepeatedKeywords[keyword]:
+			// a block replaces the list it got from the global section
+			if !collected[keyword] {
+				values[keyword] = nil
+				collected[keyword] = true
+			}
+			values[keyword] = append(values[keyword], strings.Join(directive.Args, " "))
+		default:
+			if _, found := values[keyword]; !found {
+				values[keyword] = []string{strings.Join(directive.Args, " ")}
+			}
+		}
+	}
+}
+
+// every criterion of a Match line has to match, missing connection data never matches
+func sshdMatches(criteria []string, matchContext *SshdMatchContext) (bool, error) {
+	if len(criteria) == 0 {
+		return false, errors.New("Match without criteria")
+	}
+	result := true
+	for i := 0; i < len(criteria); i++ {
+		criterion := strings.ToLower(criteria[i])
+		if criterion == "all" {
+			continue
+		}
+		if i+1 >= len(criteria) {
+			return false, errors.New("Match " + criteria[i] + " without a value")
+		}
+		patterns := criteria[i+1]
+		i++
+
+		switch criterion {
+		case "user":
+			result = result && matchContext.User != "" && matchPatternList(matchContext.User, patterns, false)
+		case "group":
+			result = result && matchGroupPatternList(matchContext.Groups, patterns)
+		case "host":
+			result = result && matchContext.Host != "" && matchPatternList(matchContext.Host, patterns, true)
+		case "address":
+			result = result && matchContext.Address != "" && matchAddressList(matchContext.Address, patterns)
+		case "localaddress":
+			result = result && matchContext.LocalAddress != "" && matchAddressList(matchContext.LocalAddress, patterns)
+		case "localport":
+			result = result && matchContext.LocalPort != "" && matchPatternList(matchContext.LocalPort, patterns, false)
+		case "rdomain":
+			result = result && matchContext.RDomain != "" && matchPatternList(matchContext.RDomain, patterns, false)
+		default:
+			return false, errors.New("unsupported Match criterion " + criteria[i-1])
+		}
+	}
+	return result, nil
+}
+
+// comma separated patterns, a matching negated pattern ("!root") rejects the value
+func matchPatternList(value string, patterns string, ignoreCase bool) bool {
+	return patternListResult(value, patterns, ignoreCase) == 1
+}
+
+// like match_pattern_list of OpenSSH: -1 if a negated pattern matches, 1 if another pattern matches, else 0
+func patternListResult(value string, patterns string, ignoreCase bool) int {
+	if ignoreCase {
+		value = strings.ToLower(value)
+		patterns = strings.ToLower(patterns)
+	}
+	found := 0
+	for _, pattern := range strings.Split(patterns, ",") {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if matchWildcard(value, pattern) {
+			if negated {
+				return -1
+			}
+			found = 1
+		}
+	}
+	return found
+}
+
+// like ga_match_pattern_list of OpenSSH, a group that matches a negated pattern rejects the user
+// even if another group matches
+func matchGroupPatternList(groups []string, patterns string) bool {
+	found := false
+	for _, group := range groups {
+		switch patternListResult(group, patterns, false) {
+		case -1:
+			return false
+		case 1:
+			found = true
+		}
+	}
+	return found
+}
+
+// like matchPatternList, patterns can also be networks in CIDR notation
+func matchAddressList(address string, patterns string) bool {
+	ip := net.ParseIP(address)
+	found := false
+	for _, pattern := range strings.Split(patterns, ",") {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+
+		matches := false
+		if _, network, err := net.ParseCIDR(pattern); err == nil {
+			matches = ip != nil && network.Contains(ip)
+		} else {
+			matches = matchWildcard(address, pattern)
+		}
+		if matches {
+			if negated {
+				return false
+			}
+			found = true
+		}
+	}
+	return found
+}
+
+// "*" matches any text and "?" one character
+func matchWildcard(value string, pattern string) bool {
+	if pattern == "" {
+		return value == ""
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(value); i++ {
+			if matchWildcard(value[i:], pattern[1:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return value != "" && matchWildcard(value[1:], pattern[1:])
+	default:
+		return value != "" && value[0] == pattern[0] && matchWildcard(value[1:], pattern[1:])
+	}
+}
+
+// names of the groups a local user is member of
+func lookupUserGroups(username string) []string {
+	groups := []string{}
+	localUser, err := user.Lookup(username)
+	if err != nil {
+		return groups
+	}
+	groupIds, _ := localUser.GroupIds()
+	for _, groupId := range groupIds {
+		if group, err := user.LookupGroupId(groupId); err == nil {
+			groups = append(groups, group.Name)
+		}
+	}
+	return groups
+}
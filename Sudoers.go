@@ -0,0 +1,608 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type SudoersDefault struct {
+	Scope    string      `json:"scope"`
+	Targets  []string    `json:"targets"`
+	Name     string      `json:"name"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value"`
+	File     string      `json:"file"`
+	Line     int         `json:"line"`
+}
+
+// one command of a user specification, aliases are expanded
+type SudoersRule struct {
+	Users       []string          `json:"users"`
+	Hosts       []string          `json:"hosts"`
+	RunasUsers  []string          `json:"runasUsers"`
+	RunasGroups []string          `json:"runasGroups"`
+	Tags        []string          `json:"tags"`
+	Options     map[string]string `json:"options"`
+	Command     string            `json:"command"`
+	File        string            `json:"file"`
+	Line        int               `json:"line"`
+}
+
+type SudoersConfig struct {
+	Defaults  []SudoersDefault               `json:"defaults"`
+	Settings  map[string]interface{}         `json:"settings"`
+	Aliases   map[string]map[string][]string `json:"aliases"`
+	UserSpecs []SudoersRule                  `json:"userSpecs"`
+	Files     []string                       `json:"files"`
+}
+
+type sudoersLine struct {
+	text   string
+	file   string
+	number int
+}
+
+// a user specification before the aliases are expanded
+type sudoersUserSpec struct {
+	users []string
+	rules []SudoersRule
+}
+
+const sudoersDefaultFile = "/etc/sudoers"
+const sudoersMaxIncludeDepth = 128
+
+var sudoersAliasTypes = map[string]string{
+	"user_alias":  "user",
+	"runas_alias": "runas",
+	"host_alias":  "host",
+	"cmnd_alias":  "command",
+	"cmd_alias":   "command",
+}
+
+var sudoersTags = map[string]bool{
+	"NOPASSWD": true, "PASSWD": true, "NOEXEC": true, "EXEC": true, "SETENV": true, "NOSETENV": true,
+	"LOG_INPUT": true, "NOLOG_INPUT": true, "LOG_OUTPUT": true, "NOLOG_OUTPUT": true, "MAIL": true, "NOMAIL": true,
+	"FOLLOW": true, "NOFOLLOW": true, "INTERCEPT": true, "NOINTERCEPT": true,
+}
+
+var sudoersOptions = map[string]bool{
+	"TIMEOUT": true, "CWD": true, "CHROOT": true, "ROLE": true, "TYPE": true, "NOTBEFORE": true, "NOTAFTER": true,
+	"APPARMOR_PROFILE": true, "PRIVS": true, "LIMITPRIVS": true,
+}
+
+var sudoersDigests = map[string]bool{"sha224": true, "sha256": true, "sha384": true, "sha512": true}
+
+var sudoersAliasName = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+var sudoersAliasStart = regexp.MustCompile(`^\s*[A-Z][A-Z0-9_]*\s*=`)
+
+// Defaults, aliases and user specifications of sudoers and its included files
+func Sudoers(path string) (map[string]interface{}, error) {
+	if path == "" {
+		path = sudoersDefaultFile
+	}
+	config, err := parseSudoers(path)
+	if err != nil {
+		return nil, err
+	}
+	return toJavaScriptValue(config).(map[string]interface{}), nil
+}
+
+func parseSudoers(path string) (SudoersConfig, error) {
+	config := SudoersConfig{
+		Defaults:  []SudoersDefault{},
+		Settings:  make(map[string]interface{}),
+		Aliases:   map[string]map[string][]string{"user": {}, "runas": {}, "host": {}, "command": {}},
+		UserSpecs: []SudoersRule{},
+		Files:     []string{},
+	}
+
+	var lines []sudoersLine
+	err := readSudoersFile(path, &lines, &config.Files, 0)
+	if err != nil {
+		return config, err
+	}
+
+	// aliases can be used before they are defined, so they are collected first
+	var userSpecs []sudoersUserSpec
+	for _, line := range lines {
+		keyword := strings.ToLower(strings.Fields(line.text)[0])
+		switch {
+		case sudoersAliasTypes[keyword] != "":
+			err = parseSudoersAlias(line, sudoersAliasTypes[keyword], config.Aliases)
+		case keyword == "defaults" || strings.HasPrefix(keyword, "defaults") && strings.ContainsAny(keyword[8:9], "@:!>"):
+			var defaults []SudoersDefault
+			defaults, err = parseSudoersDefaults(line)
+			config.Defaults = append(config.Defaults, defaults...)
+		default:
+			var userSpec sudoersUserSpec
+			userSpec, err = parseSudoersUserSpec(line)
+			userSpecs = append(userSpecs, userSpec)
+		}
+		if err != nil {
+			return config, errors.New("sudoers: " + line.file + " line " + fmt.Sprint(line.number) + ": " + err.Error())
+		}
+	}
+
+	for i, defaultEntry := range config.Defaults {
+		config.Defaults[i].Targets = expandSudoersList(defaultEntry.Targets, config.Aliases[sudoersScopeAliases(defaultEntry.Scope)])
+		if defaultEntry.Scope == "" {
+			applySudoersSetting(config.Settings, defaultEntry)
+		}
+	}
+	for _, userSpec := range userSpecs {
+		for _, rule := range userSpec.rules {
+			rule.Users = expandSudoersList(userSpec.users, config.Aliases["user"])
+			rule.Hosts = expandSudoersList(rule.Hosts, config.Aliases["host"])
+			rule.RunasUsers = expandSudoersList(rule.RunasUsers, config.Aliases["runas"])
+			rule.RunasGroups = expandSudoersList(rule.RunasGroups, config.Aliases["runas"])
+			for _, command := range expandSudoersList([]string{rule.Command}, config.Aliases["command"]) {
+				expandedRule := rule
+				expandedRule.Command = command
+				config.UserSpecs = append(config.UserSpecs, expandedRule)
+			}
+		}
+	}
+	return config, nil
+}
+
+// @include, @includedir and the old #include forms are read in place
+func readSudoersFile(path string, lines *[]sudoersLine, files *[]string, depth int) error {
+	if depth > sudoersMaxIncludeDepth {
+		return errors.New("sudoers: too many nested includes in " + path)
+	}
+	content, err := ioutil.ReadFile(hostPath(path))
+	if err != nil {
+		return errors.New("sudoers: cannot read " + path)
+	}
+	saveFileArtefact(hostPath(path), content)
+	*files = append(*files, path)
+
+	for _, line := range joinSudoersLines(string(content)) {
+		fields := strings.Fields(line.text)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "@include", "#include", "@includedir", "#includedir":
+			if len(fields) < 2 {
+				return errors.New("sudoers: " + path + " line " + fmt.Sprint(line.number) + ": " + fields[0] + " without a path")
+			}
+			includePath := sudoersIncludePath(path, strings.Trim(strings.Join(fields[1:], " "), "\""))
+			if strings.HasSuffix(fields[0], "includedir") {
+				err = readSudoersDirectory(includePath, lines, files, depth)
+			} else {
+				err = readSudoersFile(includePath, lines, files, depth+1)
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			line.file = path
+			*lines = append(*lines, line)
+		}
+	}
+	return nil
+}
+
+// like sudo, files with a dot in the name or ending with ~ are skipped
+func readSudoersDirectory(directory string, lines *[]sudoersLine, files *[]string, depth int) error {
+	fileInfos, err := ioutil.ReadDir(hostPath(directory))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, fileInfo := range fileInfos {
+		name := fileInfo.Name()
+		if fileInfo.IsDir() || strings.Contains(name, ".") || strings.HasSuffix(name, "~") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err := readSudoersFile(filepath.Join(directory, name), lines, files, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relative paths start at the directory of the including file, %h is the short host name
+func sudoersIncludePath(includingFile string, path string) string {
+	if strings.Contains(path, "%h") {
+		hostname, _ := os.Hostname()
+		path = strings.ReplaceAll(path, "%h", strings.SplitN(hostname, ".", 2)[0])
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(includingFile), path)
+	}
+	return path
+}
+
+// lines ending with "\" are continued, "#" starts a comment unless it is a uid like #0 or an include
+func joinSudoersLines(content string) []sudoersLine {
+	var lines []sudoersLine
+	current := ""
+	start := 0
+	for i, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if current == "" {
+			start = i + 1
+		}
+		line = stripSudoersComment(current + line)
+		if strings.HasSuffix(line, "\\") && !strings.HasSuffix(line, "\\\\") {
+			current = strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		current = ""
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, sudoersLine{text: strings.TrimSpace(line), number: start})
+		}
+	}
+	return lines
+}
+
+func stripSudoersComment(line string) string {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "#include") {
+		return line
+	}
+	inQuotes := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\':
+			i++
+		case line[i] == '"':
+			inQuotes = !inQuotes
+		case line[i] == '#' && !inQuotes:
+			if i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9' {
+				continue
+			}
+			if i > 0 && line[i-1] == '%' {
+				continue
+			}
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// "Cmnd_Alias SHUTDOWN = /sbin/halt, /sbin/reboot : NET = /sbin/ip"
+func parseSudoersAlias(line sudoersLine, aliasType string, aliases map[string]map[string][]string) error {
+	definitions := strings.TrimSpace(line.text[len(strings.Fields(line.text)[0]):])
+	for _, definition := range splitSudoersAliasDefinitions(definitions) {
+		nameAndItems := strings.SplitN(definition, "=", 2)
+		name := strings.TrimSpace(nameAndItems[0])
+		if len(nameAndItems) != 2 || !sudoersAliasName.MatchString(name) || name == "ALL" {
+			return errors.New("invalid alias " + definition)
+		}
+		aliases[aliasType][name] = splitSudoersList(nameAndItems[1])
+	}
+	return nil
+}
+
+// a colon only starts the next alias if a name and "=" follow, digests contain colons too
+func splitSudoersAliasDefinitions(text string) []string {
+	var definitions []string
+	start := 0
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' {
+			i++
+			continue
+		}
+		if text[i] == ':' && sudoersAliasStart.MatchString(text[i+1:]) {
+			definitions = append(definitions, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	return append(definitions, strings.TrimSpace(text[start:]))
+}
+
+// comma separated items without the spaces around them, escaped commas are kept
+func splitSudoersList(text string) []string {
+	items := []string{}
+	item := ""
+	inQuotes := false
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && i+1 < len(text):
+			item += text[i : i+2]
+			i++
+		case text[i] == '"':
+			inQuotes = !inQuotes
+			item += "\""
+		case text[i] == ',' && !inQuotes:
+			items = append(items, strings.TrimSpace(item))
+			item = ""
+		default:
+			item += string(text[i])
+		}
+	}
+	if strings.TrimSpace(item) != "" {
+		items = append(items, strings.TrimSpace(item))
+	}
+	return items
+}
+
+// "Defaults:%wheel !requiretty, timestamp_timeout=5"
+func parseSudoersDefaults(line sudoersLine) ([]SudoersDefault, error) {
+	separator := strings.IndexAny(line.text, " \t")
+	if separator < 0 {
+		return nil, errors.New("Defaults without a setting")
+	}
+	fields := []string{line.text[:separator], line.text[separator+1:]}
+
+	scope := ""
+	var targets []string
+	if qualifier := fields[0][len("Defaults"):]; qualifier != "" {
+		scope = map[byte]string{'@': "host", ':': "user", '!': "command", '>': "runas"}[qualifier[0]]
+		targets = splitSudoersList(qualifier[1:])
+	}
+
+	var defaults []SudoersDefault
+	for _, setting := range splitSudoersList(fields[1]) {
+		defaultEntry := SudoersDefault{Scope: scope, Targets: targets, File: line.file, Line: line.number}
+		operatorIndex := strings.Index(setting, "=")
+		switch {
+		case operatorIndex > 0:
+			defaultEntry.Name = strings.TrimSpace(setting[:operatorIndex])
+			defaultEntry.Operator = "="
+			if strings.HasSuffix(defaultEntry.Name, "+") || strings.HasSuffix(defaultEntry.Name, "-") {
+				defaultEntry.Operator = defaultEntry.Name[len(defaultEntry.Name)-1:] + "="
+				defaultEntry.Name = strings.TrimSpace(defaultEntry.Name[:len(defaultEntry.Name)-1])
+			}
+			defaultEntry.Value = strings.Trim(strings.TrimSpace(setting[operatorIndex+1:]), "\"")
+		case strings.HasPrefix(setting, "!"):
+			defaultEntry.Name = strings.TrimSpace(strings.TrimLeft(setting, "!"))
+			defaultEntry.Value = false
+		default:
+			defaultEntry.Name = setting
+			defaultEntry.Value = true
+		}
+		if defaultEntry.Name == "" {
+			return nil, errors.New("invalid setting " + setting)
+		}
+		defaults = append(defaults, defaultEntry)
+	}
+	return defaults, nil
+}
+
+// settings without a scope, the last one wins like in sudo
+func applySudoersSetting(settings map[string]interface{}, defaultEntry SudoersDefault) {
+	switch defaultEntry.Operator {
+	case "+=":
+		if current, ok := settings[defaultEntry.Name].(string); ok && current != "" {
+			settings[defaultEntry.Name] = current + " " + defaultEntry.Value.(string)
+			return
+		}
+		settings[defaultEntry.Name] = defaultEntry.Value
+	case "-=":
+		current, _ := settings[defaultEntry.Name].(string)
+		var kept []string
+		for _, word := range strings.Fields(current) {
+			if word != defaultEntry.Value {
+				kept = append(kept, word)
+			}
+		}
+		settings[defaultEntry.Name] = strings.Join(kept, " ")
+	default:
+		settings[defaultEntry.Name] = defaultEntry.Value
+	}
+}
+
+func sudoersScopeAliases(scope string) string {
+	if scope == "" {
+		return "user"
+	}
+	return scope
+}
+
+// "%admin, bob ALL = (root) NOPASSWD: /bin/ls, (ALL : ALL) ALL : web1 = /bin/cat"
+func parseSudoersUserSpec(line sudoersLine) (sudoersUserSpec, error) {
+	tokens := tokenizeSudoersUserSpec(line.text)
+	position := 0
+	next := func() string {
+		if position < len(tokens) {
+			position++
+			return tokens[position-1]
+		}
+		return ""
+	}
+	peek := func(offset int) string {
+		if position+offset < len(tokens) {
+			return tokens[position+offset]
+		}
+		return ""
+	}
+	readList := func() []string {
+		list := []string{next()}
+		for peek(0) == "," {
+			next()
+			list = append(list, next())
+		}
+		return list
+	}
+
+	userSpec := sudoersUserSpec{users: readList()}
+	for position < len(tokens) {
+		hosts := readList()
+		if next() != "=" {
+			return userSpec, errors.New("expected \"=\" after the hosts")
+		}
+
+		var runasUsers, runasGroups, tags []string
+		options := map[string]string{}
+		for {
+			if peek(0) == "(" {
+				next()
+				runasUsers, runasGroups = []string{}, []string{}
+				if peek(0) != ":" && peek(0) != ")" {
+					runasUsers = readList()
+				}
+				if peek(0) == ":" {
+					next()
+					runasGroups = readList()
+				}
+				if next() != ")" {
+					return userSpec, errors.New("expected \")\" after the runas list")
+				}
+			}
+			for {
+				if sudoersTags[peek(0)] && peek(1) == ":" {
+					tags = setSudoersTag(tags, next())
+					next()
+				} else if sudoersOptions[peek(0)] && peek(1) == "=" {
+					option := next()
+					next()
+					options[option] = strings.Trim(next(), "\"")
+				} else {
+					break
+				}
+			}
+
+			var command []string
+			if sudoersDigests[peek(0)] && peek(1) == ":" {
+				command = append(command, next()+next()+next())
+			}
+			for position < len(tokens) && peek(0) != "," && peek(0) != ":" {
+				command = append(command, next())
+			}
+			if len(command) == 0 {
+				return userSpec, errors.New("expected a command")
+			}
+
+			userSpec.rules = append(userSpec.rules, SudoersRule{
+				Hosts:       hosts,
+				RunasUsers:  copyStrings(runasUsers),
+				RunasGroups: copyStrings(runasGroups),
+				Tags:        copyStrings(tags),
+				Options:     options,
+				Command:     strings.Join(command, " "),
+				File:        line.file,
+				Line:        line.number,
+			})
+			if next() != "," {
+				break
+			}
+		}
+	}
+	return userSpec, nil
+}
+
+// a tag replaces its opposite, NOPASSWD and PASSWD can not be set both
+func setSudoersTag(tags []string, tag string) []string {
+	opposite := "NO" + tag
+	if strings.HasPrefix(tag, "NO") {
+		opposite = strings.TrimPrefix(tag, "NO")
+	}
+	var result []string
+	for _, existing := range tags {
+		if existing != tag && existing != opposite {
+			result = append(result, existing)
+		}
+	}
+	return append(result, tag)
+}
+
+// words and the characters , : = ( ), escaped characters stay part of the word
+func tokenizeSudoersUserSpec(text string) []string {
+	var tokens []string
+	word := ""
+	inQuotes := false
+	flush := func() {
+		if word != "" {
+			tokens = append(tokens, word)
+			word = ""
+		}
+	}
+	for i := 0; i < len(text); i++ {
+		character := text[i]
+		switch {
+		case character == '\\' && i+1 < len(text):
+			word += string(text[i+1])
+			i++
+		case character == '"':
+			inQuotes = !inQuotes
+			word += "\""
+		case inQuotes:
+			word += string(character)
+		case character == ' ' || character == '\t':
+			flush()
+		case strings.IndexByte(",:=()", character) >= 0:
+			flush()
+			tokens = append(tokens, string(character))
+		default:
+			word += string(character)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// aliases are replaced by their members, "!ALIAS" negates every member
+func expandSudoersList(items []string, aliases map[string][]string) []string {
+	expanded := []string{}
+	for _, item := range items {
+		expanded = append(expanded, expandSudoersItem(item, aliases, map[string]bool{})...)
+	}
+	return expanded
+}
+
+func expandSudoersItem(item string, aliases map[string][]string, seen map[string]bool) []string {
+	negated := strings.HasPrefix(item, "!")
+	name := strings.TrimSpace(strings.TrimLeft(item, "!"))
+	members, isAlias := aliases[name]
+	if !isAlias || seen[name] {
+		return []string{item}
+	}
+	seen[name] = true
+	var expanded []string
+	for _, member := range members {
+		for _, expandedMember := range expandSudoersItem(member, aliases, seen) {
+			if negated {
+				if strings.HasPrefix(expandedMember, "!") {
+					expandedMember = strings.TrimPrefix(expandedMember, "!")
+				} else {
+					expandedMember = "!" + expandedMember
+				}
+			}
+			expanded = append(expanded, expandedMember)
+		}
+	}
+	delete(seen, name)
+	return expanded
+}
+
+func copyStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return append([]string{}, values...)
+}
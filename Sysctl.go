@@ -0,0 +1,216 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type SysctlSetting struct {
+	Key        string          `json:"key"`
+	Value      string          `json:"value"`
+	Pattern    string          `json:"pattern,omitempty"`
+	File       string          `json:"file"`
+	Line       int             `json:"line"`
+	Overridden []SysctlSetting `json:"overridden,omitempty"`
+}
+
+// a file in an earlier directory replaces files with the same name in later ones
+var sysctlDirectories = []string{"/etc/sysctl.d", "/run/sysctl.d", "/usr/local/lib/sysctl.d", "/usr/lib/sysctl.d", "/lib/sysctl.d"}
+
+// read after the sysctl.d files like "sysctl --system" does
+const sysctlConfFile = "/etc/sysctl.conf"
+
+// running value from /proc/sys, null if the key does not exist
+func SysctlRuntime(key string) (interface{}, error) {
+	content, err := ioutil.ReadFile(hostPath(sysctlProcPath(key)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New("sysctl: cannot read " + key + ": " + err.Error())
+	}
+	return normalizeSysctlValue(string(content)), nil
+}
+
+// value that is set at boot with the file and line it comes from, null if no file sets the key
+func SysctlPersisted(key string) (interface{}, error) {
+	setting, found, err := sysctlPersisted(key)
+	if err != nil || !found {
+		return nil, err
+	}
+	return toJavaScriptValue(setting), nil
+}
+
+// the last explicit setting wins, a glob only applies if the key is not set explicitly
+func sysctlPersisted(key string) (SysctlSetting, bool, error) {
+	key = normalizeSysctlKey(key)
+	var explicit, globbed []SysctlSetting
+	for _, file := range sysctlFiles() {
+		settings, err := parseSysctlFile(file)
+		if err != nil {
+			return SysctlSetting{}, false, err
+		}
+		for _, setting := range settings {
+			if setting.Pattern == "" && setting.Key == key {
+				explicit = append(explicit, setting)
+			} else if setting.Pattern != "" && matchSysctlPattern(setting.Pattern, key) {
+				setting.Key = key
+				globbed = append(globbed, setting)
+			}
+		}
+	}
+
+	candidates := explicit
+	if len(candidates) == 0 {
+		candidates = globbed
+	}
+	if len(candidates) == 0 {
+		return SysctlSetting{}, false, nil
+	}
+	winner := candidates[len(candidates)-1]
+	winner.Overridden = candidates[:len(candidates)-1]
+	return winner, true, nil
+}
+
+// *.conf files of all directories sorted by name, /etc/sysctl.conf comes last
+func sysctlFiles() []string {
+	filesByName := make(map[string]string)
+	for i := len(sysctlDirectories) - 1; i >= 0; i-- {
+		matches, _ := filepath.Glob(filepath.Join(hostPath(sysctlDirectories[i]), "*.conf"))
+		for _, match := range matches {
+			filesByName[filepath.Base(match)] = filepath.Join(sysctlDirectories[i], filepath.Base(match))
+		}
+	}
+
+	var names []string
+	for name := range filesByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var files []string
+	for _, name := range names {
+		files = append(files, filesByName[name])
+	}
+	if checkPathExists(hostPath(sysctlConfFile)) && !isLinkedSysctlConf(files) {
+		files = append(files, sysctlConfFile)
+	}
+	return files
+}
+
+// many distributions link /etc/sysctl.d/99-sysctl.conf to /etc/sysctl.conf
+func isLinkedSysctlConf(files []string) bool {
+	sysctlConf, err := filepath.EvalSymlinks(hostPath(sysctlConfFile))
+	if err != nil {
+		return false
+	}
+	for _, file := range files {
+		if resolvedFile, err := filepath.EvalSymlinks(hostPath(file)); err == nil && resolvedFile == sysctlConf {
+			return true
+		}
+	}
+	return false
+}
+
+// a file linked to /dev/null masks the files with the same name
+func parseSysctlFile(file string) ([]SysctlSetting, error) {
+	if isMaskedFile(file) {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(hostPath(file))
+	if err != nil {
+		return nil, errors.New("sysctl: cannot read " + file)
+	}
+	saveFileArtefact(hostPath(file), content)
+
+	var settings []SysctlSetting
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		keyValue := strings.SplitN(line, "=", 2)
+		if len(keyValue) != 2 {
+			WriteLog("sysctl: "+file+" line "+fmt.Sprint(i+1)+" has no value", "WARN")
+			continue
+		}
+		// "-" only tells systemd-sysctl to ignore errors of the key
+		key := normalizeSysctlKey(strings.TrimPrefix(strings.TrimSpace(keyValue[0]), "-"))
+		setting := SysctlSetting{Key: key, Value: normalizeSysctlValue(keyValue[1]), File: file, Line: i + 1}
+		if strings.ContainsAny(key, "*?[") {
+			setting.Pattern = key
+			setting.Key = ""
+		}
+		settings = append(settings, setting)
+	}
+	return settings, nil
+}
+
+// "net/ipv4/ip_forward" and "net.ipv4.ip_forward" are the same key, a "/" after the first "." is part of a name
+func normalizeSysctlKey(key string) string {
+	key = strings.TrimSpace(key)
+	separator := strings.IndexAny(key, "./")
+	if separator < 0 || key[separator] == '.' {
+		return key
+	}
+	return strings.Map(func(character rune) rune {
+		switch character {
+		case '/':
+			return '.'
+		case '.':
+			return '/'
+		}
+		return character
+	}, key)
+}
+
+// "net.ipv4.conf.eth0/10.forwarding" is /proc/sys/net/ipv4/conf/eth0.10/forwarding
+func sysctlProcPath(key string) string {
+	key = normalizeSysctlKey(key)
+	return "/proc/sys/" + strings.Map(func(character rune) rune {
+		switch character {
+		case '.':
+			return '/'
+		case '/':
+			return '.'
+		}
+		return character
+	}, key)
+}
+
+// a glob matches within one level of the key like in /proc/sys
+func matchSysctlPattern(pattern string, key string) bool {
+	matches, err := path.Match(sysctlProcPath(pattern), sysctlProcPath(key))
+	return err == nil && matches
+}
+
+// "4096\t16384  4194304" and "4096 16384 4194304" are the same value
+func normalizeSysctlValue(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
@@ -0,0 +1,351 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// unit file with its drop-ins applied, values of a key are kept in order
+type SystemdUnitFile struct {
+	Name     string
+	Path     string
+	Aliases  []string
+	Masked   bool
+	DropIns  []string
+	Sections map[string]map[string][]string
+}
+
+type SystemdUnitState struct {
+	Name     string                         `json:"name"`
+	Found    bool                           `json:"found"`
+	Path     string                         `json:"path"`
+	Aliases  []string                       `json:"aliases"`
+	DropIns  []string                       `json:"dropIns"`
+	Masked   bool                           `json:"masked"`
+	Enabled  bool                           `json:"enabled"`
+	State    string                         `json:"state"`
+	WantedBy []string                       `json:"wantedBy"`
+	Service  map[string]string              `json:"service"`
+	Sections map[string]map[string][]string `json:"sections"`
+}
+
+// a unit in an earlier directory replaces units with the same name in later ones
+var systemdUnitDirectories = []string{"/etc/systemd/system", "/run/systemd/system", "/usr/local/lib/systemd/system", "/usr/lib/systemd/system", "/lib/systemd/system"}
+
+var systemdUnitSuffixes = []string{".service", ".socket", ".target", ".device", ".mount", ".automount", ".swap", ".timer", ".path", ".slice", ".scope"}
+
+// only links in these directories enable a unit, the vendor links in /usr/lib belong to the unit itself
+var systemdEnablementDirectories = []string{"/etc/systemd/system", "/run/systemd/system"}
+
+// the link chain between an alias and the unit is limited like the include depth of other parsers
+const maxSystemdAliasDepth = 8
+
+// state of a unit like "systemctl is-enabled" reports it, read from the unit files only
+func SystemdUnit(name string) (interface{}, error) {
+	state, err := systemdUnitState(name)
+	if err != nil {
+		return nil, err
+	}
+	return toJavaScriptValue(state), nil
+}
+
+func systemdUnitState(name string) (SystemdUnitState, error) {
+	if !hasSystemdUnitSuffix(name) {
+		name += ".service"
+	}
+	state := SystemdUnitState{Name: name, Aliases: []string{}, DropIns: []string{}, WantedBy: []string{}, Service: make(map[string]string), Sections: make(map[string]map[string][]string)}
+	unit, found, err := loadSystemdUnit(name)
+	if err != nil {
+		return state, err
+	}
+	if !found {
+		state.State = "not-found"
+		return state, nil
+	}
+	state.Found = true
+	state.Name = unit.Name
+	state.Path = unit.Path
+	state.Aliases = unit.Aliases
+	state.Masked = unit.Masked
+	if unit.Masked {
+		state.State = "masked"
+		return state, nil
+	}
+	state.DropIns = unit.DropIns
+	state.Sections = unit.Sections
+	for key := range unit.Sections["Service"] {
+		state.Service[key] = systemdUnitValue(unit, "Service", key)
+	}
+	if wantedBy := unit.Sections["Install"]["WantedBy"]; len(wantedBy) > 0 {
+		state.WantedBy = strings.Fields(strings.Join(wantedBy, " "))
+	}
+
+	enablement := ""
+	for _, unitName := range append([]string{unit.Name}, unit.Aliases...) {
+		if unitEnablement := systemdUnitEnablement(unitName); unitEnablement != "" && enablement != "enabled" {
+			enablement = unitEnablement
+		}
+	}
+	state.Enabled = enablement != ""
+	install := unit.Sections["Install"]
+	switch {
+	case state.Enabled:
+		state.State = enablement
+	case len(install["WantedBy"]) > 0 || len(install["RequiredBy"]) > 0 || len(install["UpheldBy"]) > 0 || len(install["Alias"]) > 0:
+		state.State = "disabled"
+	case len(install["Also"]) > 0:
+		state.State = "indirect"
+	default:
+		state.State = "static"
+	}
+	return state, nil
+}
+
+func hasSystemdUnitSuffix(name string) bool {
+	for _, suffix := range systemdUnitSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// the unit file, its drop-ins from <name>.d/*.conf and if the unit is masked,
+// an alias linking to another unit is followed and its name kept in Aliases
+func loadSystemdUnit(name string) (SystemdUnitFile, bool, error) {
+	unit := SystemdUnitFile{Name: name, Aliases: []string{}, DropIns: []string{}, Sections: make(map[string]map[string][]string)}
+	for depth := 0; unit.Path == ""; depth++ {
+		if depth > maxSystemdAliasDepth {
+			return unit, true, errors.New("systemd: too many aliases for " + name)
+		}
+		path := findSystemdUnit(unit.Name)
+		if path == "" && systemdTemplateName(unit.Name) != "" {
+			path = findSystemdUnit(systemdTemplateName(unit.Name))
+		}
+		if path == "" {
+			return unit, false, nil
+		}
+		if isMaskedFile(path) {
+			unit.Path = path
+			unit.Masked = true
+			return unit, true, nil
+		}
+		target, err := os.Readlink(hostPath(path))
+		if err != nil {
+			unit.Path = path
+			break
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		if filepath.Base(target) == filepath.Base(path) {
+			// linked unit file outside of the unit directories
+			unit.Path = target
+			break
+		}
+		unit.Aliases = append(unit.Aliases, unit.Name)
+		unit.Name = systemdInstanceName(filepath.Base(target), unit.Name)
+		if findSystemdUnit(filepath.Base(target)) == "" {
+			unit.Path = target
+		}
+	}
+
+	err := readSystemdUnitFile(unit.Path, unit.Sections)
+	if err != nil {
+		return unit, true, err
+	}
+	// drop-ins of the template come first so that the ones of the instance replace them
+	names := append([]string{unit.Name}, unit.Aliases...)
+	if template := systemdTemplateName(unit.Name); template != "" {
+		names = append([]string{template}, names...)
+	}
+	for _, dropIn := range systemdDropIns(names...) {
+		if err := readSystemdUnitFile(dropIn, unit.Sections); err != nil {
+			return unit, true, err
+		}
+		unit.DropIns = append(unit.DropIns, dropIn)
+	}
+	return unit, true, nil
+}
+
+// path of the unit in the first directory that has it, links are not followed
+func findSystemdUnit(name string) string {
+	for _, directory := range systemdUnitDirectories {
+		path := filepath.Join(directory, name)
+		if _, err := os.Lstat(hostPath(path)); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// drop-ins of all directories and names of the unit sorted by file name, like units the earlier directory wins
+func systemdDropIns(names ...string) []string {
+	dropInsByName := make(map[string]string)
+	for i := len(systemdUnitDirectories) - 1; i >= 0; i-- {
+		for _, name := range names {
+			directory := filepath.Join(systemdUnitDirectories[i], name+".d")
+			matches, _ := filepath.Glob(filepath.Join(hostPath(directory), "*.conf"))
+			for _, match := range matches {
+				dropInsByName[filepath.Base(match)] = filepath.Join(directory, filepath.Base(match))
+			}
+		}
+	}
+
+	var dropInNames []string
+	for dropInName := range dropInsByName {
+		dropInNames = append(dropInNames, dropInName)
+	}
+	sort.Strings(dropInNames)
+	var dropIns []string
+	for _, dropInName := range dropInNames {
+		if !isMaskedFile(dropInsByName[dropInName]) {
+			dropIns = append(dropIns, dropInsByName[dropInName])
+		}
+	}
+	return dropIns
+}
+
+// names of all units with the suffix (e.g. ".mount"), masked units are included
+func listSystemdUnits(suffix string) []string {
+	found := make(map[string]bool)
+	for _, directory := range systemdUnitDirectories {
+		matches, _ := filepath.Glob(filepath.Join(hostPath(directory), "*"+suffix))
+		for _, match := range matches {
+			found[filepath.Base(match)] = true
+		}
+	}
+	var names []string
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// "getty@tty1.service" is an instance of "getty@.service", "" if the name is no instance
+func systemdTemplateName(name string) string {
+	at := strings.Index(name, "@")
+	suffix := filepath.Ext(name)
+	if at < 0 || at+1 >= len(name)-len(suffix) {
+		return ""
+	}
+	return name[:at+1] + suffix
+}
+
+// an alias of a template like "autovt@.service" keeps the instance of the name
+func systemdInstanceName(target string, name string) string {
+	if !strings.HasSuffix(target, "@"+filepath.Ext(target)) || systemdTemplateName(name) == "" {
+		return target
+	}
+	instance := name[strings.Index(name, "@")+1 : len(name)-len(filepath.Ext(name))]
+	return strings.TrimSuffix(target, filepath.Ext(target)) + instance + filepath.Ext(target)
+}
+
+func isSystemdUnitEnabled(name string) bool {
+	return systemdUnitEnablement(name) != ""
+}
+
+// "enabled" if a .wants or .requires directory of /etc links to the unit, "enabled-runtime" if one of /run does
+func systemdUnitEnablement(name string) string {
+	for _, directory := range systemdEnablementDirectories {
+		for _, pattern := range []string{"*.wants", "*.requires"} {
+			matches, _ := filepath.Glob(filepath.Join(hostPath(directory), pattern, name))
+			if len(matches) == 0 {
+				continue
+			}
+			if strings.HasPrefix(directory, "/run/") {
+				return "enabled-runtime"
+			}
+			return "enabled"
+		}
+	}
+	return ""
+}
+
+// "Key=" without a value resets the values set before, lines ending with "\" are continued
+func readSystemdUnitFile(path string, sections map[string]map[string][]string) error {
+	content, err := ioutil.ReadFile(hostPath(path))
+	if err != nil {
+		return errors.New("systemd: cannot read " + path)
+	}
+	saveFileArtefact(hostPath(path), content)
+
+	section := ""
+	continued := ""
+	for _, line := range strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if continued == "" && (line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";")) {
+			continue
+		}
+		if strings.HasSuffix(line, "\\") {
+			continued += strings.TrimSpace(strings.TrimSuffix(line, "\\")) + " "
+			continue
+		}
+		line = continued + line
+		continued = ""
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			if sections[section] == nil {
+				sections[section] = make(map[string][]string)
+			}
+			continue
+		}
+		keyValue := strings.SplitN(line, "=", 2)
+		if section == "" || len(keyValue) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(keyValue[0])
+		value := strings.TrimSpace(keyValue[1])
+		if value == "" {
+			sections[section][key] = []string{}
+			continue
+		}
+		sections[section][key] = append(sections[section][key], value)
+	}
+	return nil
+}
+
+// the last value of a key, most settings only use this one
+func systemdUnitValue(unit SystemdUnitFile, section string, key string) string {
+	values := unit.Sections[section][key]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+// linked to /dev/null or empty
+func isMaskedFile(path string) bool {
+	if target, err := os.Readlink(hostPath(path)); err == nil && target == "/dev/null" {
+		return true
+	}
+	fileInfo, err := os.Stat(hostPath(path))
+	return err == nil && fileInfo.Size() == 0
+}
@@ -25,44 +25,66 @@ import (
 	"encoding/json"
 	"errors"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type CommandFailedResult struct {
-	NameOutput        string `json:"Name"`
-	CommandOutput     string `json:"Command"`
-	CommandSuccessful bool   `json:"Command was executed"`
-	ErrorMessage      string `json:"Error-Message"`
+	NameOutput        string     `json:"Name"`
+	CommandOutput     string     `json:"Command"`
+	CommandSuccessful bool       `json:"Command was executed"`
+	ErrorMessage      string     `json:"Error-Message"`
+	Evidence          []Evidence `json:"Evidence,omitempty"`
 }
 
 type AuditSuccessfulResult struct {
-	NameOutput        string `json:"Name"`
-	CommandOutput     string `json:"Command"`
-	CommandSuccessful bool   `json:"Command was executed"`
-	AuditSuccessful   bool   `json:"Output is as expected"`
+	NameOutput        string     `json:"Name"`
+	CommandOutput     string     `json:"Command"`
+	CommandSuccessful bool       `json:"Command was executed"`
+	AuditSuccessful   bool       `json:"Output is as expected"`
+	Evidence          []Evidence `json:"Evidence,omitempty"`
 }
 
 type AuditFailedResult struct {
-	NameOutput        string `json:"Name"`
-	CommandOutput     string `json:"Command"`
-	CommandSuccessful bool   `json:"Command was executed"`
-	AuditSuccessful   bool   `json:"Output is as expected"`
-	Expected          string `json:"Expected Value"`
-	Out               string `json:"Actual Value"`
-	Operator          string `json:"Operator"`
+	NameOutput        string     `json:"Name"`
+	CommandOutput     string     `json:"Command"`
+	CommandSuccessful bool       `json:"Command was executed"`
+	AuditSuccessful   bool       `json:"Output is as expected"`
+	Expected          string     `json:"Expected Value"`
+	Out               string     `json:"Actual Value"`
+	Operator          string     `json:"Operator"`
+	Evidence          []Evidence `json:"Evidence,omitempty"`
 }
 
+type ScriptResult struct {
+	NameOutput        string      `json:"Name"`
+	CommandOutput     string      `json:"Command"`
+	CommandSuccessful bool        `json:"Command was executed"`
+	Status            string      `json:"Status"`
+	Message           string      `json:"Message,omitempty"`
+	Details           interface{} `json:"Details,omitempty"`
+	Evidence          []Evidence  `json:"Evidence,omitempty"`
+}
+
+type RunMetadata struct {
+	Interrupted    bool           `json:"Interrupted,omitempty"`
+	InterruptedAt  string         `json:"Interrupted at,omitempty"`
+	ResumedAt      string         `json:"Resumed at,omitempty"`
+	PinnedBinaries []PinnedBinary `json:"Pinned Binaries,omitempty"`
+	Facts          *Facts         `json:"Facts,omitempty"`
+}
+
+var runMetadata RunMetadata
+
 var FirstAuditEntry bool
 var FirstErrorEntry bool
 var FirstResultEntry bool
 
 func WriteResultJSON(audit BigAudit, isCommandSuccessful bool, isAuditSuccessful bool, output string, err string, operator string) {
 
-	var fileText string
 	var auditResult interface{}
-	var auditAsByteArr []byte
 
 	if !isCommandSuccessful {
 		auditResult = CommandFailedResult{
@@ -70,6 +92,7 @@ func WriteResultJSON(audit BigAudit, isCommandSuccessful bool, isAuditSuccessful
 			CommandOutput:     audit.Command,
 			CommandSuccessful: isCommandSuccessful,
 			ErrorMessage:      err,
+			Evidence:          checkResult.Evidence,
 		}
 	} else {
 		if isAuditSuccessful {
@@ -78,6 +101,7 @@ func WriteResultJSON(audit BigAudit, isCommandSuccessful bool, isAuditSuccessful
 				CommandOutput:     audit.Command,
 				CommandSuccessful: isCommandSuccessful,
 				AuditSuccessful:   isAuditSuccessful,
+				Evidence:          checkResult.Evidence,
 			}
 		} else {
 			auditResult = AuditFailedResult{
@@ -88,10 +112,30 @@ func WriteResultJSON(audit BigAudit, isCommandSuccessful bool, isAuditSuccessful
 				Expected:          audit.Expected,
 				Out:               output,
 				Operator:          operator,
+				Evidence:          checkResult.Evidence,
 			}
 		}
 	}
-	auditAsByteArr, _ = json.MarshalIndent(auditResult, "\t\t", "\t")
+	appendResultJSON(auditResult)
+}
+
+// the status a script set through the result object replaces the comparison with expected
+func WriteScriptResultJSON(audit BigAudit, result CheckResult) {
+	appendResultJSON(ScriptResult{
+		NameOutput:        audit.Name,
+		CommandOutput:     audit.Command,
+		CommandSuccessful: true,
+		Status:            result.Status,
+		Message:           result.Message,
+		Details:           result.Details,
+		Evidence:          result.Evidence,
+	})
+}
+
+func appendResultJSON(auditResult interface{}) {
+	var fileText string
+
+	auditAsByteArr, _ := json.MarshalIndent(auditResult, "\t\t", "\t")
 	auditAsByteArr, _ = UnescapeUnicodeCharactersInJSON(auditAsByteArr)
 
 	if !FirstResultEntry {
@@ -123,6 +167,28 @@ func WriteResultJSON(audit BigAudit, isCommandSuccessful bool, isAuditSuccessful
 	fileWriter(fileText, "result.json", false)
 }
 
+// adds the run metadata after the audit results, nothing is written if there is nothing to record
+func WriteRunMetadata() {
+	if reflect.DeepEqual(runMetadata, RunMetadata{}) {
+		return
+	}
+
+	metadataAsByteArr, _ := json.MarshalIndent(runMetadata, "\t", "\t")
+	metadataAsByteArr, _ = UnescapeUnicodeCharactersInJSON(metadataAsByteArr)
+
+	// an audit interrupted before the first result still gets its metadata
+	fileText := "{\n\t" + `"` + ConfigName + `":` + " [\n\t]\n}"
+	if checkPathExists("./output/result.json") {
+		fileText = getResultJSONContent()
+	}
+	fileText = strings.TrimSuffix(fileText, "\n\t]\n}")
+	fileText += "\n\t],\n\t" + `"Run Metadata": ` + string(metadataAsByteArr) + "\n}"
+	fileWriter(fileText, "result.json", false)
+	if debugModeEnabled {
+		WriteDebugLog("run metadata written to ./output/result.json", "INFO")
+	}
+}
+
 //let auditName empty if u don't want to log an audit
 func WriteErrorLog(err string, auditName string) {
 	logType := "ERROR"
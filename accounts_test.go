@@ -0,0 +1,161 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeAccountFixture() {
+	writeHostFile("etc/passwd", "root:x:0:0:root:/root:/bin/bash\n# comment\nalice:x:1000:1000:Alice,,,:/home/alice:/bin/bash\ntoor:x:0:0::/root:/bin/sh\nlegacy:$1$salt$hash:1001:1001::/home/legacy:/bin/sh\nnopw::1002:1002::/nonexistent:/usr/sbin/nologin\nghost:x:1003:1003::/home/ghost:/bin/sh\n+@nis::::::\n")
+	writeHostFile("etc/shadow", "root:$6$abc$secrethash:19000:0:99999:7:::\nalice:!$y$j9T$salt$secrethash:19500:1:90:14:30:20000:\ntoor:*:19000::::::\n")
+	writeHostFile("etc/group", "root:x:0:\nshadow:x:42:alice\nsudo:x:27:alice,bob\nalice:x:1000:\nlegacy:secret:1001:\n")
+	writeHostFile("etc/gshadow", "root:*::\nshadow:*::alice\nsudo:*:root:alice,bob\nalice:!::\n")
+	os.MkdirAll("./output/host/home/alice", 0700)
+	hostRoot = "./output/host"
+}
+
+func TestReadUsers(t *testing.T) {
+	writeAccountFixture()
+
+	users, err := readUsers(false)
+	assert.Nil(t, err)
+	assert.Len(t, users, 6)
+
+	root := users[0]
+	assert.Equal(t, "root", root.Group)
+	assert.Equal(t, passwordSet, root.PasswordStatus)
+	assert.Equal(t, 19000, *root.LastChange)
+	assert.Equal(t, 99999, *root.MaxDays)
+	assert.Nil(t, root.InactiveDays)
+	assert.Equal(t, "", root.HashAlgorithm)
+
+	alice := users[1]
+	assert.Equal(t, 1000, alice.Uid)
+	assert.Equal(t, "Alice,,,", alice.Gecos)
+	assert.Equal(t, []string{"shadow", "sudo"}, alice.Groups)
+	assert.Equal(t, passwordLocked, alice.PasswordStatus)
+	assert.Equal(t, 90, *alice.MaxDays)
+	assert.Equal(t, 30, *alice.InactiveDays)
+	assert.Equal(t, 20000, *alice.ExpireDate)
+	assert.Equal(t, true, alice.HomeStat["isDir"])
+	assert.Equal(t, 3, alice.Line)
+
+	assert.Equal(t, 0, users[2].Uid)
+	assert.Equal(t, passwordLocked, users[2].PasswordStatus)
+	assert.True(t, users[3].HashInPasswd)
+	assert.Equal(t, passwordSet, users[3].PasswordStatus)
+	assert.Equal(t, passwordEmpty, users[4].PasswordStatus)
+	assert.Nil(t, users[4].HomeStat)
+	assert.Equal(t, passwordUnknown, users[5].PasswordStatus)
+	assert.Nil(t, users[5].MaxDays)
+
+	users, _ = readUsers(true)
+	assert.Equal(t, "sha512", users[0].HashAlgorithm)
+	assert.Equal(t, "yescrypt", users[1].HashAlgorithm)
+	assert.Equal(t, "", users[2].HashAlgorithm)
+	assert.Equal(t, "md5", users[3].HashAlgorithm)
+	assert.Equal(t, "", users[5].HashAlgorithm)
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestUsersNeverExposeHashes(t *testing.T) {
+	writeAccountFixture()
+	bigAudit = BigAudit{Name: "Accounts"}
+
+	users, err := Users(map[string]interface{}{"hashAlgorithm": true})
+	assert.Nil(t, err)
+	groups, err := Groups()
+	assert.Nil(t, err)
+	usersJson, _ := json.Marshal(users)
+	groupsJson, _ := json.Marshal(groups)
+	assert.NotContains(t, string(usersJson), "secrethash")
+	assert.NotContains(t, string(usersJson), "$salt$")
+	assert.NotContains(t, string(groupsJson), "secret")
+
+	CheckFileExists(t, "./output/artefacts/Accounts/output_host_etc_passwd")
+	passwdArtefact, _ := os.ReadFile("./output/artefacts/Accounts/output_host_etc_passwd")
+	assert.NotContains(t, string(passwdArtefact), "$1$salt$hash")
+	assert.Contains(t, string(passwdArtefact), "\nlegacy:*:1001:1001::/home/legacy:/bin/sh\nnopw::1002:")
+	assert.Contains(t, string(passwdArtefact), "root:x:0:0:root:/root:/bin/bash\n# comment\n")
+	groupArtefact, _ := os.ReadFile("./output/artefacts/Accounts/output_host_etc_group")
+	assert.NotContains(t, string(groupArtefact), "secret")
+	assert.Contains(t, string(groupArtefact), "\nlegacy:*:1001:\n")
+	assert.NoFileExists(t, "./output/artefacts/Accounts/output_host_etc_shadow")
+	assert.NoFileExists(t, "./output/artefacts/Accounts/output_host_etc_gshadow")
+
+	bigAudit = BigAudit{}
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestRedactAccountHashes(t *testing.T) {
+	assert.Equal(t, "a:x:1:\nb::2:\nc:*:3:\nd:!*:4:\ne:!:5:\n# f:$6$x:6:", redactAccountHashes("a:x:1:\nb::2:\nc:$6$salt$hash:3:\nd:!$y$salt$hash:4:\ne:!:5:\n# f:$6$x:6:"))
+}
+
+func TestReadGroups(t *testing.T) {
+	writeAccountFixture()
+
+	groups, err := readGroups()
+	assert.Nil(t, err)
+	assert.Len(t, groups, 5)
+	assert.Equal(t, GroupAccount{Name: "shadow", Gid: 42, Members: []string{"alice"}, Administrators: []string{}, ShadowMembers: []string{"alice"}, PasswordStatus: passwordLocked, Line: 2}, groups[1])
+	assert.Equal(t, []string{"root"}, groups[2].Administrators)
+	assert.Equal(t, passwordSet, groups[4].PasswordStatus)
+
+	writeHostFile("etc/group", "broken:x:abc:\n")
+	_, err = readGroups()
+	assert.Equal(t, "group: /etc/group line 1 has an invalid gid", err.Error())
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestLoginDefs(t *testing.T) {
+	writeHostFile("usr/etc/login.defs", "# vendor defaults\nPASS_MAX_DAYS\t99999\nENCRYPT_METHOD SHA512\nUMASK 022\nUMASK 027\nMAIL_DIR \"/var/mail\"\nUSERGROUPS_ENAB\n")
+	hostRoot = "./output/host"
+
+	settings, err := LoginDefs()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"PASS_MAX_DAYS": "99999", "ENCRYPT_METHOD": "SHA512", "UMASK": "027", "MAIL_DIR": "/var/mail", "USERGROUPS_ENAB": ""}, settings)
+
+	os.Remove("./output/host/usr/etc/login.defs")
+	_, err = LoginDefs()
+	assert.Equal(t, "login.defs: cannot read /etc/login.defs or /usr/etc/login.defs", err.Error())
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestHashAlgorithm(t *testing.T) {
+	assert.Equal(t, "bcrypt", hashAlgorithm("$2b$10$abc"))
+	assert.Equal(t, "des", hashAlgorithm("abJnggxhB/yWI"))
+	assert.Equal(t, "sha256", hashAlgorithm("!!$5$x$y"))
+	assert.Equal(t, "", hashAlgorithm("!!"))
+	assert.Equal(t, "unknown", hashAlgorithm("plain"))
+}
@@ -0,0 +1,129 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lines as "auditctl -l" prints them
+const loadedAuditRules = `-a always,exit -F arch=b64 -S adjtimex,settimeofday,clock_settime -F key=time-change
+-w /etc/sudoers -p wa -k scope
+-a always,exit -F dir=/etc/sudoers.d -F perm=wa -F key=scope
+-a always,exit -F arch=b64 -S execve -C uid!=euid -F auid!=-1 -F key=user_emulation
+-a always,exit -F path=/usr/bin/sudo -F perm=x -F auid>=1000 -F auid!=unset -F key=privileged`
+
+func TestParseAuditRules(t *testing.T) {
+	rules, err := parseAuditRules(loadedAuditRules, "")
+	assert.Nil(t, err)
+	assert.Len(t, rules, 5)
+	assert.Equal(t, AuditRule{Type: "syscall", List: "exit", Action: "always", Arch: "b64", Syscalls: []string{"adjtimex", "clock_settime", "settimeofday"}, Fields: []string{}, Keys: []string{"time-change"}, Text: rules[0].Text, Line: 1}, rules[0])
+	assert.Equal(t, AuditRule{Type: "watch", Syscalls: []string{}, Fields: []string{}, Path: "/etc/sudoers", Permissions: "wa", Keys: []string{"scope"}, Text: "-w /etc/sudoers -p wa -k scope", Line: 2}, rules[1])
+	assert.Equal(t, "watch", rules[2].Type)
+	assert.Equal(t, "/etc/sudoers.d", rules[2].Path)
+	assert.Equal(t, []string{"auid!=unset", "euid!=uid"}, rules[3].Fields)
+	assert.Equal(t, "syscall", rules[4].Type)
+	assert.Equal(t, []string{"all"}, rules[4].Syscalls)
+	assert.Equal(t, []string{"auid!=unset", "auid>=1000", "path=/usr/bin/sudo", "perm=x"}, rules[4].Fields)
+
+	rules, _ = parseAuditRules("-D\n-b 8192\n\n# comment\n-W /etc/passwd\n-e 2", "/etc/audit/audit.rules")
+	assert.Len(t, rules, 3)
+	assert.Equal(t, "control", rules[2].Type)
+	assert.Equal(t, "2", rules[2].Value)
+	assert.Equal(t, 6, rules[2].Line)
+
+	_, err = parseAuditRules("-a always,exit -S", "/etc/audit/rules.d/broken.rules")
+	assert.Equal(t, "audit: /etc/audit/rules.d/broken.rules line 1: missing value for -S", err.Error())
+	_, err = parseAuditRule("-a always -S open")
+	assert.Equal(t, "invalid list and action always", err.Error())
+	_, err = parseAuditRule("-F arch=b64")
+	assert.Equal(t, "rule has neither -a nor -w", err.Error())
+}
+
+func TestIsAuditRuleCovered(t *testing.T) {
+	rules, _ := parseAuditRules(loadedAuditRules+"\n-a always,exit -F arch=b64 -S stime -k time\n-e 2", "")
+	covered := func(text string) bool {
+		required, err := parseAuditRule(text)
+		assert.Nil(t, err)
+		return isAuditRuleCovered(required, rules)
+	}
+
+	assert.True(t, covered("-a exit,always -F arch=b64 -S settimeofday -S adjtimex,stime -k other-key"))
+	assert.False(t, covered("-a always,exit -F arch=b32 -S adjtimex"))
+	assert.False(t, covered("-a always,exit -F arch=b64 -S clock_adjtime"))
+	assert.True(t, covered("-a always,exit -F arch=b64 -C euid!=uid -F auid!=4294967295 -S execve"))
+	assert.False(t, covered("-a always,exit -F arch=b64 -C euid!=uid -S execve"))
+	assert.True(t, covered("-w /etc/sudoers -p w"))
+	assert.False(t, covered("-w /etc/sudoers -p wr"))
+	assert.True(t, covered("-w /etc/sudoers.d/ -p wa"))
+	assert.True(t, covered("-w /etc/sudoers.d/admins -p a"))
+	assert.False(t, covered("-w /etc/passwd -p wa"))
+	assert.True(t, covered("-a always,exit -F path=/usr/bin/sudo -F perm=x -F auid>=1000 -F auid!=-1 -k priv"))
+	assert.True(t, covered("-e 2"))
+	assert.False(t, covered("-e 1"))
+	assert.False(t, covered("-a always,user -F uid=0"))
+}
+
+func TestAssertAuditRules(t *testing.T) {
+	writeHostFile("etc/audit/rules.d/10-base.rules", "-D\n-b 8192\n")
+	writeHostFile("etc/audit/rules.d/50-scope.rules", "-w /etc/sudoers -p wa -k scope\n-w /etc/sudoers.d -p wa -k scope\n")
+	writeHostFile("etc/audit/rules.d/99-finalize.rules", "-e 2\n")
+	writeHostFile("etc/audit/rules.d/notes.txt", "-e 1\n")
+	writeHostFile("etc/audit/audit.rules", "-w /etc/passwd -p wa\n")
+	hostRoot = "./output/host"
+
+	rules, err := readAuditRules("")
+	assert.Nil(t, err)
+	assert.Len(t, rules, 5)
+	assert.Equal(t, "/etc/audit/rules.d/99-finalize.rules", rules[4].File)
+
+	command := "assertAuditRules(['-w /etc/sudoers -p wa -k sudoers', '-w /etc/sudoers.d/ -p wa', '-w /etc/passwd -p wa', '-e 2']).join()"
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Audit", Command: command}))
+	assert.Equal(t, "-w /etc/passwd -p wa", output)
+	assert.Equal(t, "failed", checkResult.Status)
+	assert.Equal(t, "missing audit rules: -w /etc/passwd -p wa", checkResult.Message)
+
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Audit", Command: "assertAuditRules(['-e 2'], 'persisted')"}))
+	assert.Equal(t, CheckResult{Status: "passed", Message: "all required audit rules are set"}, checkResult)
+
+	assert.NotNil(t, runCheckInNewRuntime(BigAudit{Name: "Audit", Command: "assertAuditRules(['-x 2'])"}))
+	_, err = readAuditRules("running")
+	assert.Equal(t, "audit: unknown source running, use persisted or loaded", err.Error())
+
+	hostRoot = "/"
+	bigAudit = BigAudit{}
+	dontSaveArtefact = false
+	deleteOutput()
+}
+
+func TestReadLoadedAuditRulesWithoutOutput(t *testing.T) {
+	dontSaveArtefact = true
+	output = "previous"
+
+	_, err := readLoadedAuditRules()
+	assert.NotNil(t, err)
+	assert.Equal(t, "previous", output)
+
+	dontSaveArtefact = false
+}
@@ -0,0 +1,148 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testBinaryContent = "#!/bin/sh\necho pinned\n"
+
+func writeTestBinary() string {
+	os.MkdirAll("./output/bin", 0755)
+	os.WriteFile("./output/bin/echo", []byte(testBinaryContent), 0755)
+	path, _ := filepath.Abs("./output/bin/echo")
+	return path
+}
+
+func TestLoadBinaryPins(t *testing.T) {
+	runMetadata = RunMetadata{}
+	binaryPath := writeTestBinary()
+	checksum := sha256.Sum256([]byte(testBinaryContent))
+	expectedChecksum := hex.EncodeToString(checksum[:])
+
+	pinContent := `{
+		"pins": [
+			{
+				"command": "echo",
+				"path": "` + binaryPath + `",
+				"sha256": "` + strings.ToUpper(expectedChecksum) + `"
+			}
+		]
+	}`
+	fileWriter(pinContent, "pins.json", false)
+
+	assert.Nil(t, loadBinaryPins("./output/pins.json"))
+	assert.Equal(t, []PinnedBinary{{
+		Command:      "echo",
+		Path:         binaryPath,
+		ResolvedPath: binaryPath,
+		Sha256:       expectedChecksum,
+		VerifiedBy:   "SHA-256",
+	}}, runMetadata.PinnedBinaries)
+
+	commandPath, err := pinnedCommandPath("echo")
+	assert.Nil(t, err)
+	assert.Equal(t, "'"+binaryPath+"'", commandPath)
+
+	commandPath, err = pinnedCommandPath("grep")
+	assert.Nil(t, err)
+	assert.Equal(t, "grep", commandPath)
+
+	// the binary was replaced after the start of the audit
+	os.WriteFile(binaryPath, []byte("#!/bin/sh\necho trojan\n"), 0755)
+	_, failPosition, err := AuditWrapper(SmallAudit{Command: "echo", Arguments: []string{"hello"}})
+	assert.Equal(t, 0, failPosition)
+	assert.EqualError(t, err, "binary verification failed: echo: SHA-256 of "+binaryPath+" does not match")
+
+	binaryPins = make(map[string]BinaryPin)
+	runMetadata = RunMetadata{}
+	deleteOutput()
+}
+
+func TestLoadBinaryPinsInvalid(t *testing.T) {
+	var testCases = []struct {
+		pin      string
+		expected string
+	}{
+		{
+			`{"path": "/usr/bin/grep", "sha256": "abc"}`,
+			"Issue at the 1st pin in ./output/pins.json. You have to specify the command",
+		},
+		{
+			`{"command": "not-supported", "path": "/usr/bin/grep", "sha256": "abc"}`,
+			"Issue at the 1st pin in ./output/pins.json. not-supported is not a supported command",
+		},
+		{
+			`{"command": "grep", "path": "grep", "sha256": "abc"}`,
+			"Issue at the 1st pin in ./output/pins.json. The path of grep has to be absolute",
+		},
+		{
+			`{"command": "grep", "path": "/usr/bin/grep"}`,
+			"Issue at the 1st pin in ./output/pins.json. You have to specify a sha256 or package verification for grep",
+		},
+	}
+	for _, test := range testCases {
+		fileWriter(`{"pins": [`+test.pin+`]}`, "pins.json", false)
+		assert.EqualError(t, loadBinaryPins("./output/pins.json"), test.expected)
+	}
+
+	binaryPins = make(map[string]BinaryPin)
+	deleteOutput()
+}
+
+func TestVerifyDpkgOwnedFile(t *testing.T) {
+	binaryPath := writeTestBinary()
+	checksum := md5.Sum([]byte(testBinaryContent))
+
+	os.MkdirAll("./output/dpkg/info", 0755)
+	os.WriteFile("./output/dpkg/info/coreutils.md5sums", []byte(hex.EncodeToString(checksum[:])+"  "+strings.TrimPrefix(binaryPath, "/")+"\n"), 0644)
+	os.WriteFile("./output/dpkg/info/other.md5sums", []byte("00000000000000000000000000000000  usr/bin/other\n"), 0644)
+	dpkgInfoDir = "./output/dpkg/info"
+
+	pinned, err := verifyBinaryPin(BinaryPin{Command: "echo", Path: binaryPath, Package: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "package coreutils", pinned.VerifiedBy)
+
+	os.WriteFile(binaryPath, []byte("#!/bin/sh\necho trojan\n"), 0755)
+	_, err = verifyBinaryPin(BinaryPin{Command: "echo", Path: binaryPath, Package: true})
+	assert.EqualError(t, err, "echo: "+binaryPath+" does not match the checksum of package coreutils")
+
+	os.Remove("./output/dpkg/info/coreutils.md5sums")
+	_, err = verifyBinaryPin(BinaryPin{Command: "echo", Path: binaryPath, Package: true})
+	assert.EqualError(t, err, "echo: "+binaryPath+" is not owned by any dpkg package")
+
+	dpkgInfoDir = "/var/lib/dpkg/info"
+	deleteOutput()
+}
+
+func TestPackagePathCandidates(t *testing.T) {
+	assert.Equal(t, []string{"/bin/grep", "/usr/bin/grep", "/usr/bin/grep", "/bin/grep"}, packagePathCandidates("/bin/grep", "/usr/bin/grep"))
+}
@@ -115,8 +115,9 @@ func TestMainValidConfigFlagValidJSONValidCommandsValidSystem(t *testing.T) {
 				"Actual Value": "hallo",
 				"Operator": "=="
 			}
-		]
-	}`
+		],
+		"Run Metadata": {
+			"Facts": {`
 
 	blackBoxWriter(configContent, configFileName)
 
@@ -421,8 +422,9 @@ func TestMainValidConfigFlagValidJSONValidCommandsSystemRegQuery(t *testing.T) {
 				"Command was executed": false,
 				"Error-Message": "command not executed"
 			}
-		]
-	}`
+		],
+		"Run Metadata": {
+			"Facts": {`
 
 	blackBoxWriter(configContent, configFileName)
 
@@ -530,8 +532,9 @@ func TestMainDifferentStringsInCommand(t *testing.T) {
 				"Command was executed": false,
 				"Error-Message": "command not executed"
 			}
-		]
-	}`
+		],
+		"Run Metadata": {
+			"Facts": {`
 
 	expectedErrorLogContent := "[ERROR]: different_string_4: SyntaxError: JavaScript"
 
@@ -667,8 +670,9 @@ func TestMainDifferentOwnJavaScriptFunctions(t *testing.T) {
 				"Command was executed": true,
 				"Output is as expected": true
 			}
-		]
-	}`
+		],
+		"Run Metadata": {
+			"Facts": {`
 
 	blackBoxWriter(configContent, configFileName)
 
@@ -791,8 +795,9 @@ func TestMainDifferentOwnJavaScriptFunctionsWithVerbose(t *testing.T) {
 				"Command was executed": true,
 				"Output is as expected": true
 			}
-		]
-	}`
+		],
+		"Run Metadata": {
+			"Facts": {`
 
 	blackBoxWriter(configContent, configFileName)
 
@@ -919,8 +924,9 @@ func TestMainDifferentOwnJavaScriptFunctionsWithDebug(t *testing.T) {
 				"Command was executed": true,
 				"Output is as expected": true
 			}
-		]
-	}`
+		],
+		"Run Metadata": {
+			"Facts": {`
 
 	blackBoxWriter(configContent, configFileName)
 
@@ -1082,8 +1088,9 @@ func TestMainDifferentTypeExpected(t *testing.T) {
 				"Command was executed": true,
 				"Output is as expected": true
 			}
-		]
-	}`
+		],
+		"Run Metadata": {
+			"Facts": {`
 
 	blackBoxWriter(configContent, configFileName)
 
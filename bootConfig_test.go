@@ -0,0 +1,143 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const grubCfg = `# DO NOT EDIT THIS FILE
+function load_video {
+  insmod all_video
+}
+set superusers="root"
+password_pbkdf2 root grub.pbkdf2.sha512.10000.C0FFEE.BEEF
+if [ x"${feature_menuentry_id}" = xy ]; then
+  menuentry_id_option="--id"
+fi
+menuentry 'Debian GNU/Linux' --class debian --unrestricted $menuentry_id_option 'gnulinux-simple' {
+	load_video
+	linux	/boot/vmlinuz-6.1.0-13-amd64 root=UUID=1234 ro audit=1 apparmor=1 security=apparmor quiet
+}
+submenu 'Advanced options' {
+	menuentry 'Debian GNU/Linux, with Linux 6.1.0-13-amd64 (recovery mode)' {
+		linux	/boot/vmlinuz-6.1.0-13-amd64 root=UUID=1234 ro single audit=1
+	}
+}
+menuentry 'Memory test (memtest86+x64.efi)' {
+	linux	/boot/memtest86+x64.efi
+}
+menuentry 'Memory test (memtest86+.bin)' {
+	linux16	/boot/memtest86+.bin
+}
+`
+
+func TestReadBootConfig(t *testing.T) {
+	writeHostFile("proc/cmdline", "BOOT_IMAGE=/boot/vmlinuz-6.1.0-13-amd64 root=UUID=1234 ro quiet audit=0 \"dyndbg=file a.c +p\"\n")
+	writeHostFile("etc/default/grub", "GRUB_DEFAULT=0\nGRUB_CMDLINE_LINUX_DEFAULT=\"quiet\"\nGRUB_CMDLINE_LINUX=\"audit=1\"\n")
+	writeHostFile("etc/default/grub.d/apparmor.cfg", "GRUB_CMDLINE_LINUX=\"$GRUB_CMDLINE_LINUX apparmor=1 security=apparmor\"\n")
+	writeHostFile("boot/grub/grub.cfg", grubCfg)
+	os.Chmod("./output/host/boot/grub/grub.cfg", 0600)
+	hostRoot = "./output/host"
+	bigAudit = BigAudit{Name: "Boot"}
+
+	config, err := readBootConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, "audit=1 apparmor=1 security=apparmor", config.DefaultGrub["GRUB_CMDLINE_LINUX"])
+	assert.Equal(t, []string{"root"}, config.Grub.Superusers)
+	assert.Equal(t, []GrubPassword{{User: "root", Type: "pbkdf2", File: "/boot/grub/grub.cfg", Line: 6}}, config.Grub.Passwords)
+	assert.Len(t, config.Grub.Files, 1)
+	assert.Equal(t, "0600", config.Grub.Files[0]["mode"])
+	assert.Equal(t, []BootEntry{
+		{Title: "Debian GNU/Linux", Kernel: "/boot/vmlinuz-6.1.0-13-amd64", Options: "root=UUID=1234 ro audit=1 apparmor=1 security=apparmor quiet", Unrestricted: true, File: "/boot/grub/grub.cfg", Line: 10},
+		{Title: "Debian GNU/Linux, with Linux 6.1.0-13-amd64 (recovery mode)", Kernel: "/boot/vmlinuz-6.1.0-13-amd64", Options: "root=UUID=1234 ro single audit=1", File: "/boot/grub/grub.cfg", Line: 15},
+		{Title: "Memory test (memtest86+x64.efi)", Kernel: "/boot/memtest86+x64.efi", File: "/boot/grub/grub.cfg", Line: 19},
+		{Title: "Memory test (memtest86+.bin)", Kernel: "/boot/memtest86+.bin", File: "/boot/grub/grub.cfg", Line: 22},
+	}, config.Grub.MenuEntries)
+
+	// the memtest86+ entries take no kernel parameters and are not counted
+	assert.Equal(t, KernelParameter{Name: "audit", Active: true, ActiveValue: "0", Persisted: true, PersistedValue: "1", DefaultGrub: true, Entries: 2, TotalEntries: 2}, config.Parameters["audit"])
+	assert.Equal(t, KernelParameter{Name: "apparmor", Persisted: false, DefaultGrub: true, Entries: 1, TotalEntries: 2}, config.Parameters["apparmor"])
+	assert.Equal(t, KernelParameter{Name: "quiet", Active: true, DefaultGrub: true, Entries: 1, TotalEntries: 2}, config.Parameters["quiet"])
+	assert.Equal(t, "file a.c +p", config.Parameters["dyndbg"].ActiveValue)
+
+	grubArtefact, err := os.ReadFile("./output/artefacts/Boot/output_host_boot_grub_grub.cfg")
+	assert.Nil(t, err)
+	assert.NotContains(t, string(grubArtefact), "C0FFEE")
+	assert.Contains(t, string(grubArtefact), "\npassword_pbkdf2 root *\n")
+
+	hostRoot = "/"
+	bigAudit = BigAudit{}
+	deleteOutput()
+}
+
+func TestReadBootConfigLoaderEntries(t *testing.T) {
+	writeHostFile("boot/grub2/grub.cfg", "set default=\"${saved_entry}\"\nblscfg\n")
+	writeHostFile("boot/grub2/grubenv", "# GRUB Environment Block\nkernelopts=root=/dev/mapper/rhel-root ro audit=1\n####\n")
+	writeHostFile("boot/loader/entries/abc-5.14.0.conf", "title Red Hat Enterprise Linux (5.14.0)\nversion 5.14.0\nlinux /vmlinuz-5.14.0\noptions $kernelopts\noptions audit_backlog_limit=8192\n")
+	writeHostFile("boot/loader/entries/abc-0-rescue.conf", "title Rescue\nlinux /vmlinuz-0-rescue\noptions root=/dev/mapper/rhel-root ro audit=1\n")
+	hostRoot = "./output/host"
+
+	config, err := readBootConfig()
+	assert.Nil(t, err)
+	assert.Empty(t, config.Cmdline)
+	assert.Empty(t, config.Grub.MenuEntries)
+	assert.Empty(t, config.Grub.Superusers)
+	assert.Len(t, config.LoaderEntries, 2)
+	assert.Equal(t, BootEntry{Title: "Red Hat Enterprise Linux (5.14.0)", Kernel: "/vmlinuz-5.14.0", Options: "root=/dev/mapper/rhel-root ro audit=1 audit_backlog_limit=8192", File: "/boot/loader/entries/abc-5.14.0.conf"}, config.LoaderEntries[1])
+	assert.True(t, config.Parameters["audit"].Persisted)
+	assert.False(t, config.Parameters["audit"].Active)
+	assert.False(t, config.Parameters["audit_backlog_limit"].Persisted)
+	assert.Equal(t, 1, config.Parameters["audit_backlog_limit"].Entries)
+
+	writeHostFile("boot/grub2/grub.cfg", "menuentry 'broken {\n")
+	_, err = readBootConfig()
+	assert.Equal(t, "boot: /boot/grub2/grub.cfg line 1: unterminated quote", err.Error())
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestBootConfigWithoutEntries(t *testing.T) {
+	writeHostFile("etc/default/grub", "GRUB_CMDLINE_LINUX='audit=1 audit_backlog_limit=8192'\n")
+	hostRoot = "./output/host"
+
+	command := "var p = bootConfig().parameters; p.audit.persisted + ' ' + p.audit_backlog_limit.persistedValue + ' ' + (p.apparmor === undefined)"
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Boot", Command: command}))
+	assert.Equal(t, "true 8192 true", output)
+
+	hostRoot = "/"
+	dontSaveArtefact = false
+	deleteOutput()
+}
+
+func TestRedactGrubPasswords(t *testing.T) {
+	content := "set superusers=\"root\"\n  password_pbkdf2 root grub.pbkdf2.sha512.10000.C0FFEE.BEEF\npassword 'admin user' \"plain secret\"\necho password root\n"
+	assert.Equal(t, "set superusers=\"root\"\n  password_pbkdf2 root *\npassword 'admin user' *\necho password root\n", string(redactGrubPasswords([]byte(content))))
+}
+
+func TestParseKernelCmdline(t *testing.T) {
+	assert.Equal(t, map[string]string{"ro": "", "root": "/dev/sda1", "audit": "1", "a": "b c"}, parseKernelCmdline("  ro root=/dev/sda1 audit=0  audit=1 a=\"b c\" "))
+}
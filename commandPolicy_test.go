@@ -0,0 +1,283 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCommandPolicy(t *testing.T) {
+	var testCases = []struct {
+		command   string
+		arguments []string
+		expected  string
+	}{
+		{
+			"useradd",
+			[]string{"-D"},
+			"",
+		},
+		{
+			"useradd",
+			[]string{"-D", "-f", "30"},
+			"policy violation: argument \"-f\" of useradd is not allowed",
+		},
+		{
+			"modprobe",
+			[]string{"-n", "-v", "cramfs"},
+			"",
+		},
+		{
+			"modprobe",
+			[]string{"-v", "cramfs"},
+			"policy violation: modprobe requires the argument \"-n\"",
+		},
+		{
+			"modprobe",
+			[]string{"-n", "-v", "-r", "cramfs"},
+			"policy violation: argument \"-r\" of modprobe is not allowed",
+		},
+		{
+			"rmmod",
+			[]string{"cramfs"},
+			"policy violation: argument \"cramfs\" of rmmod is forbidden",
+		},
+		{
+			"grep",
+			[]string{"-r", "anything"},
+			"",
+		},
+	}
+	for _, test := range testCases {
+		err := checkCommandPolicy(test.command, test.arguments)
+		if test.expected == "" {
+			assert.Nil(t, err, "Check \""+test.command+" "+strings.Join(test.arguments, " ")+"\" is allowed")
+		} else {
+			assert.EqualError(t, err, test.expected)
+		}
+	}
+}
+
+func TestCheckCommandPolicyWrappedCommands(t *testing.T) {
+	var testCases = []struct {
+		command   string
+		arguments []string
+		expected  string
+	}{
+		{
+			"xargs",
+			[]string{"useradd", "-D"},
+			"policy violation: xargs passes unchecked arguments to useradd",
+		},
+		{
+			"xargs",
+			[]string{"-0", "-n", "1", "rmmod"},
+			"policy violation: xargs passes unchecked arguments to rmmod",
+		},
+		{
+			"xargs",
+			[]string{"-I", "{}", "reboot", "{}"},
+			"policy violation: xargs runs reboot which is not allowed",
+		},
+		{
+			"xargs",
+			[]string{"-r", "grep", "-l", "nodev"},
+			"",
+		},
+		{
+			"find",
+			[]string{"/lib/modules", "-name", "*.ko", "-exec", "rmmod", "{}", "\\;"},
+			"policy violation: argument \"{}\" of rmmod is forbidden",
+		},
+		{
+			"find",
+			[]string{"/", "-execdir", "'sh'", "-c", "id", "';'"},
+			"policy violation: find runs sh which is not allowed",
+		},
+		{
+			"find",
+			[]string{"/etc", "-type", "f", "-exec", "stat", "-c", "%a", "{}", "+", "-exec", "xargs", "rmmod", "+"},
+			"policy violation: xargs passes unchecked arguments to rmmod",
+		},
+		{
+			"find",
+			[]string{"/etc", "-perm", "-0002", "-exec", "ls", "-l", "{}", "\\;"},
+			"",
+		},
+		{
+			"find",
+			[]string{"/etc", "-exec", "ls", "{}", ";", "rmmod", "x"},
+			"policy violation: \";\" in the arguments of find is run by the shell",
+		},
+		{
+			"awk",
+			[]string{"'{system(\"modprobe", "cramfs\")}'"},
+			"policy violation: awk must not run commands",
+		},
+		{
+			"awk",
+			[]string{"'{print", "|", "\"sh\"}'"},
+			"policy violation: awk must not run commands",
+		},
+		{
+			"awk",
+			[]string{"'BEGIN{\"id\"|getline", "x}'"},
+			"policy violation: awk must not run commands",
+		},
+		{
+			"awk",
+			[]string{"-F:", "'($3", "==", "0", "||", "$1", "~", "/^(root|halt)$/)", "{print", "$1}'", "/etc/passwd"},
+			"",
+		},
+		{
+			"awk",
+			[]string{"'BEGIN{c=\"id\";", "print", "\"x\"", "|", "c}'"},
+			"policy violation: awk must not run commands",
+		},
+		{
+			"awk",
+			[]string{"'{x", "=", "i++", "/", "2;", "print", "x", "|", "\"sh\";", "y", "=", "1/2}'"},
+			"policy violation: awk must not run commands",
+		},
+		{
+			"awk",
+			[]string{"-F'|'", "'$2", "~", "/[/\"]|x/", "{n++}", "END", "{print", "n", "/", "2}'", "/etc/group"},
+			"",
+		},
+		{
+			"awk",
+			[]string{"-f", "/tmp/prog.awk", "/etc/passwd"},
+			"policy violation: awk must not read its program from a file",
+		},
+	}
+	for _, test := range testCases {
+		err := checkCommandPolicy(test.command, test.arguments)
+		if test.expected == "" {
+			assert.Nil(t, err, "Check \""+test.command+" "+strings.Join(test.arguments, " ")+"\" is allowed")
+		} else {
+			assert.EqualError(t, err, test.expected)
+		}
+	}
+}
+
+func TestCheckCommandPolicyShellCharacters(t *testing.T) {
+	var testCases = []struct {
+		command   string
+		arguments []string
+		expected  string
+	}{
+		{"ls", []string{"/tmp;", "rmmod", "x"}, "policy violation: \";\" in the arguments of ls is run by the shell"},
+		{"ls", []string{"/tmp", "&&", "rmmod", "x"}, "policy violation: \"&\" in the arguments of ls is run by the shell"},
+		{"ls", []string{"/missing", "||", "rmmod", "x"}, "policy violation: \"|\" in the arguments of ls is run by the shell"},
+		{"ls", []string{"/tmp|rmmod", "x"}, "policy violation: \"|\" in the arguments of ls is run by the shell"},
+		{"ls", []string{"$(rmmod", "x)"}, "policy violation: \"(\" in the arguments of ls is run by the shell"},
+		{"ls", []string{"\"$(rmmod", "x)\""}, "policy violation: \"$\" in the arguments of ls is run by the shell"},
+		{"ls", []string{"`rmmod", "x`"}, "policy violation: \"`\" in the arguments of ls is run by the shell"},
+		{"ls", []string{"/tmp", ">", "/etc/passwd"}, "policy violation: \">\" in the arguments of ls is run by the shell"},
+		{"cat", []string{"<", "/etc/shadow"}, "policy violation: \"<\" in the arguments of cat is run by the shell"},
+		// a quote that is not closed would continue in the next step of the pipeline
+		{"grep", []string{"'a"}, "policy violation: unterminated quote in the arguments of grep"},
+		{"grep", []string{"-E", "'^(PermitRootLogin|Protocol);'", "\"$HOME\"", "a\\;b"}, ""},
+		// the read-only policies cannot be skipped either
+		{"systemctl", []string{"status", "sshd;", "systemctl", "stop", "sshd"}, "policy violation: \";\" in the arguments of systemctl is run by the shell"},
+	}
+	for _, test := range testCases {
+		err := checkCommandPolicy(test.command, test.arguments)
+		if test.expected == "" {
+			assert.Nil(t, err, "Check \""+test.command+" "+strings.Join(test.arguments, " ")+"\" is allowed")
+		} else {
+			assert.EqualError(t, err, test.expected)
+		}
+	}
+}
+
+func TestShellWords(t *testing.T) {
+	assert.Equal(t, []string{"-F:", "{print $1}", "a b", "c\\;", ";"}, shellWords(`-F: '{print $1}' "a b" "c\\;" \;`))
+}
+
+func TestLoadCommandPolicyFile(t *testing.T) {
+	fileNamePolicy := "policy.json"
+	policyContent := `{
+		"policies": [
+			{
+				"command": "New-Command",
+				"allowedArguments": ["--list", "--name=[a-z]+"],
+				"forbiddenArguments": ["--name=root"]
+			}
+		]
+	}`
+	fileWriter(policyContent, fileNamePolicy, false)
+
+	policyCommands, err := loadCommandPolicyFile("./output/" + fileNamePolicy)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"New-Command"}, policyCommands)
+
+	assert.Nil(t, checkCommandPolicy("new-command", []string{"--list", "--name=audit"}))
+	assert.EqualError(t, checkCommandPolicy("new-command", []string{"--name=root"}), "policy violation: argument \"--name=root\" of new-command is forbidden")
+	assert.EqualError(t, checkCommandPolicy("new-command", []string{"--delete"}), "policy violation: argument \"--delete\" of new-command is not allowed")
+
+	invalidPolicyContent := `{
+		"policies": [
+			{
+				"command": "other-command",
+				"allowedArguments": ["(unclosed"]
+			}
+		]
+	}`
+	fileWriter(invalidPolicyContent, fileNamePolicy, false)
+	_, err = loadCommandPolicyFile("./output/" + fileNamePolicy)
+	assert.EqualError(t, err, "invalid argument pattern \"(unclosed\" for other-command in ./output/policy.json")
+
+	_, err = loadCommandPolicyFile("./output/NotExisting.json")
+	assert.Error(t, err)
+
+	delete(commandPolicies, "new-command")
+	deleteOutput()
+}
+
+func TestGetAdditionalCommandsWithPolicyFile(t *testing.T) {
+	fileNamePolicy := "policy.json"
+	policyContent := `{
+		"policies": [
+			{
+				"command": "policy-command",
+				"allowedArguments": ["-l"]
+			}
+		]
+	}`
+	fileWriter(policyContent, fileNamePolicy, false)
+
+	flags.addedCommands = []string{"./output/" + fileNamePolicy}
+	getAdditionalCommands()
+
+	assert.Contains(t, SupportedCommands, "policy-command")
+	_, failPosition, err := AuditWrapper(SmallAudit{Command: "echo", Arguments: []string{"ok"}}, SmallAudit{Command: "policy-command", Arguments: []string{"-x"}})
+	assert.Equal(t, 1, failPosition)
+	assert.EqualError(t, err, "policy violation: argument \"-x\" of policy-command is not allowed")
+
+	flags.addedCommands = nil
+	delete(commandPolicies, "policy-command")
+	deleteOutput()
+}
@@ -0,0 +1,152 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfigIniWithDropIns(t *testing.T) {
+	writeHostFile("etc/systemd/journald.conf", "# defaults\n[Journal]\nStorage=auto\n;Compress=yes\nForwardToSyslog=no\nMaxLevelStore=debug \\\n  info\n")
+	writeHostFile("usr/lib/systemd/journald.conf.d/10-vendor.conf", "[Journal]\nStorage=volatile\nCompress=no\n")
+	writeHostFile("usr/lib/systemd/journald.conf.d/20-masked.conf", "[Journal]\nForwardToSyslog=yes\n")
+	writeHostFile("etc/systemd/journald.conf.d/10-vendor.conf", "[Journal]\nStorage=persistent\n")
+	writeHostFile("run/systemd/journald.conf.d/30-runtime.conf", "[Journal]\nCompress=yes\n")
+	writeHostFile("etc/systemd/journald.conf.d/notes.txt", "[Journal]\nStorage=none\n")
+	os.Symlink("/dev/null", "./output/host/etc/systemd/journald.conf.d/20-masked.conf")
+	hostRoot = "./output/host"
+
+	config, err := parseConfig("/etc/systemd/journald.conf", "ini", "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/etc/systemd/journald.conf", "/etc/systemd/journald.conf.d/10-vendor.conf", "/run/systemd/journald.conf.d/30-runtime.conf"}, config.Files)
+	assert.Equal(t, map[string]interface{}{"Journal": map[string]interface{}{"Storage": "persistent", "ForwardToSyslog": "no", "MaxLevelStore": "debug info", "Compress": "yes"}}, config.Values)
+	assert.Equal(t, ConfigEntry{Section: "Journal", Key: "MaxLevelStore", Value: "debug info", File: "/etc/systemd/journald.conf", Line: 6}, config.Entries[2])
+
+	config, err = parseConfig("/etc/systemd/logind.conf", "", "")
+	assert.Nil(t, err)
+	assert.Empty(t, config.Files)
+	assert.Empty(t, config.Values)
+
+	writeHostFile("etc/sssd/sssd.conf", "[sssd\nservices = nss\n")
+	_, err = parseConfig("/etc/sssd/sssd.conf", "ini", "")
+	assert.Equal(t, "config: /etc/sssd/sssd.conf line 1: unterminated section [sssd", err.Error())
+	_, err = parseConfig("/etc/sssd/sssd.conf", "yaml", "")
+	assert.Equal(t, "config: unknown dialect yaml, use ini, keyvalue, space or shell", err.Error())
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestParseConfigDropInPattern(t *testing.T) {
+	writeHostFile("etc/sssd/sssd.conf", "[sssd]\nservices = nss\n")
+	writeHostFile("etc/sssd/conf.d/20-pam.conf", "[sssd]\nservices = nss, pam\n")
+	writeHostFile("etc/sssd/conf.d/10-domain.conf", "[domain/example]\nid_provider = ldap\n")
+	writeHostFile("etc/sssd/sssd.conf.d/ignored.conf", "[sssd]\nservices = none\n")
+	writeHostFile("usr/lib/sssd/sssd.conf.d/ignored.conf", "[sssd]\nservices = none\n")
+	hostRoot = "./output/host"
+
+	// only files in /etc/systemd have drop-ins in <name>.d
+	config, err := parseConfig("/etc/sssd/sssd.conf", "ini", "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/etc/sssd/sssd.conf"}, config.Files)
+
+	config, err = parseConfig("/etc/sssd/sssd.conf", "ini", "/etc/sssd/conf.d/*.conf")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/etc/sssd/sssd.conf", "/etc/sssd/conf.d/10-domain.conf", "/etc/sssd/conf.d/20-pam.conf"}, config.Files)
+	assert.Equal(t, "nss, pam", config.Values["sssd"].(map[string]interface{})["services"])
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestParseConfigDialects(t *testing.T) {
+	writeHostFile("etc/security/pwquality.conf", "# minlen = 9\nminlen = 14\n  dcredit=-1\nbroken line\n")
+	writeHostFile("etc/chrony.conf", "! comment\n% comment\nserver 0.pool.ntp.org iburst\nserver 1.pool.ntp.org   iburst\nmakestep 1.0 3\n")
+	writeHostFile("etc/default/grub", "GRUB_TIMEOUT=5\nGRUB_DISTRIBUTOR=`lsb_release -i -s 2> /dev/null || echo Debian`\nexport GRUB_CMDLINE_LINUX_DEFAULT=\"quiet \\\"splash\\\"\" # comment\nGRUB_CMDLINE_LINUX='audit=1 \\\napparmor=1'\n[ -r /etc/default/grub.local ] && . /etc/default/grub.local\nGRUB_DISABLE_RECOVERY=true\nGRUB_TERMINAL=console GRUB_GFXMODE=\"auto\" # comment\nLANG=C update-grub\n")
+	hostRoot = "./output/host"
+
+	_, err := parseConfig("/etc/security/pwquality.conf", "keyvalue", "")
+	assert.Equal(t, "config: /etc/security/pwquality.conf line 4: missing = in broken line", err.Error())
+	writeHostFile("etc/security/pwquality.conf", "# minlen = 9\nminlen = 14\n  dcredit=-1\n")
+	config, _ := parseConfig("/etc/security/pwquality.conf", "keyvalue", "")
+	assert.Equal(t, map[string]interface{}{"minlen": "14", "dcredit": "-1"}, config.Values)
+
+	config, err = parseConfig("/etc/chrony.conf", "space", "")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"server": "1.pool.ntp.org   iburst", "makestep": "1.0 3"}, config.Values)
+	assert.Len(t, config.Entries, 3)
+	assert.Equal(t, "0.pool.ntp.org iburst", config.Entries[0].Value)
+
+	config, err = parseConfig("/etc/default/grub", "shell", "")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"GRUB_TIMEOUT":               "5",
+		"GRUB_DISTRIBUTOR":           "`lsb_release -i -s 2> /dev/null || echo Debian`",
+		"GRUB_CMDLINE_LINUX_DEFAULT": "quiet \"splash\"",
+		"GRUB_CMDLINE_LINUX":         "audit=1 apparmor=1",
+		"GRUB_DISABLE_RECOVERY":      "true",
+		"GRUB_TERMINAL":              "console",
+		"GRUB_GFXMODE":               "auto",
+	}, config.Values)
+	assert.Equal(t, 4, config.Entries[3].Line)
+	assert.Equal(t, 7, config.Entries[4].Line)
+	assert.Equal(t, ConfigEntry{Key: "GRUB_GFXMODE", Value: "auto", File: "/etc/default/grub", Line: 8}, config.Entries[6])
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestUnquoteShellValue(t *testing.T) {
+	value, rest, _ := unquoteShellValue(`"a b"'c d'e\ f`)
+	assert.Equal(t, "a bc de f", value)
+	assert.Equal(t, "", rest)
+	value, rest, _ = unquoteShellValue(`$(echo "(x)") # comment`)
+	assert.Equal(t, `$(echo "(x)")`, value)
+	assert.Equal(t, "", rest)
+	value, rest, _ = unquoteShellValue(`a  B=2`)
+	assert.Equal(t, "a", value)
+	assert.Equal(t, "B=2", rest)
+	_, _, err := unquoteShellValue(`"open`)
+	assert.Equal(t, "unterminated quote", err.Error())
+	_, _, err = unquoteShellValue("`date")
+	assert.Equal(t, "unterminated command substitution", err.Error())
+
+	assignments, _ := splitShellAssignments(`A=1 B="2 3"`)
+	assert.Equal(t, [][2]string{{"A", "1"}, {"B", "2 3"}}, assignments)
+	assignments, _ = splitShellAssignments(`A=1 command`)
+	assert.Empty(t, assignments)
+}
+
+func TestParseConfigFromJavaScript(t *testing.T) {
+	writeHostFile("etc/systemd/logind.conf", "[Login]\nKillUserProcesses=yes\n")
+	hostRoot = "./output/host"
+
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Config", Command: "parseConfig('/etc/systemd/logind.conf', 'ini').values.Login.KillUserProcesses"}))
+	assert.Equal(t, "yes", output)
+
+	hostRoot = "/"
+	dontSaveArtefact = false
+	deleteOutput()
+}
@@ -0,0 +1,159 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testDryRunConfig = `{
+	"commands": [
+		{
+			"name": "Pipeline",
+			"command": "echo hello | grep hello"
+		}
+	],
+	"system":
+	{
+		` + getConfigSystemForOS() + `
+	}
+}`
+
+func TestPlanAuditPipeline(t *testing.T) {
+	flags.input = "./output/configDryRun.json"
+	fileWriter(testDryRunConfig, "configDryRun.json", false)
+	ReadConfig()
+
+	plan := planAudit(BigAudit{Name: "Pipeline", Command: "echo hello | grep hello", BlackenContent: "hel+o"})
+	assert.Equal(t, "", plan.Issue)
+	assert.Len(t, plan.Calls, 1)
+	assert.Equal(t, "call", plan.Calls[0].Function)
+	assert.Equal(t, "echo hello | grep hello", plan.Calls[0].Argument)
+	assert.Equal(t, []PlannedCommand{
+		{Command: "echo", Binary: plannedBinary("echo"), Argv: []string{"echo", "hello"}},
+		{Command: "grep", Binary: plannedBinary("grep"), Argv: []string{"grep", "hello"}},
+	}, plan.Calls[0].Commands)
+	assert.Equal(t, "./output/artefacts/Pipeline.txt (output of echo), blackened with hel+o", plan.Calls[0].Artefact)
+	assert.Equal(t, "", plan.Calls[0].Issue)
+
+	plan = planAudit(BigAudit{Name: "Pipeline", Command: "echo hello", DontSaveArtefact: true})
+	assert.Equal(t, "", plan.Calls[0].Artefact)
+
+	deleteOutput()
+}
+
+func TestPlanAuditHelpers(t *testing.T) {
+	flags.input = "./output/configDryRun.json"
+	fileWriter(testDryRunConfig, "configDryRun.json", false)
+	ReadConfig()
+
+	command := "auditRules().length > 0 && auditRules('persisted') && auditRules('loaded') && assertAuditRules(['-w /etc/sudoers -p wa'], 'loaded') && firewall().tables.length > 0"
+	plan := planAudit(BigAudit{Name: "Helpers", Command: command})
+	assert.Equal(t, "", plan.Issue)
+	assert.Len(t, plan.Calls, 3)
+	assert.Equal(t, "auditRules", plan.Calls[0].Function)
+	assert.Equal(t, "'loaded'", plan.Calls[0].Source)
+	assert.Equal(t, []PlannedCommand{{Command: "auditctl", Binary: plannedBinary("auditctl"), Argv: []string{"auditctl", "-l"}}}, plan.Calls[0].Commands)
+	assert.Equal(t, "./output/artefacts/Helpers.txt (output of auditctl)", plan.Calls[0].Artefact)
+	assert.Equal(t, "assertAuditRules", plan.Calls[1].Function)
+	assert.Equal(t, []string{"auditctl", "-l"}, plan.Calls[1].Commands[0].Argv)
+	assert.Equal(t, "firewall", plan.Calls[2].Function)
+	assert.Equal(t, []PlannedCommand{
+		{Command: "iptables-save", Binary: plannedBinary("iptables-save"), Argv: []string{"iptables-save"}},
+		{Command: "ip6tables-save", Binary: plannedBinary("ip6tables-save"), Argv: []string{"ip6tables-save"}},
+		{Command: "nft", Binary: plannedBinary("nft"), Argv: []string{"nft", "-j", "list", "ruleset"}},
+	}, plan.Calls[2].Commands)
+	assert.Equal(t, "", plan.Calls[2].Issue)
+
+	plan = planAudit(BigAudit{Name: "Helpers", Command: "var s = 'loaded'; auditRules(s)"})
+	assert.Len(t, plan.Calls, 1)
+	assert.Equal(t, "source is not a string literal and cannot be planned", plan.Calls[0].Issue)
+
+	deleteOutput()
+}
+
+func TestPlanAuditNestedCalls(t *testing.T) {
+	flags.input = "./output/configDryRun.json"
+	fileWriter(testDryRunConfig, "configDryRun.json", false)
+	ReadConfig()
+
+	command := "if (callCompare('echo a', 'a')) { printToLog('ok', 'INFO'); shell('echo b') } else { for (var i = 0; i < 2; i++) { callContains('cat §file§/etc/hosts', 'localhost') } }"
+	plan := planAudit(BigAudit{Name: "Nested", Command: command})
+	assert.Len(t, plan.Calls, 3)
+	assert.Equal(t, "callCompare", plan.Calls[0].Function)
+	assert.Equal(t, "shell", plan.Calls[1].Function)
+	assert.Equal(t, "shell() runs the command without the allowlist in "+GetSystem().Shell, plan.Calls[1].Issue)
+	assert.Equal(t, "./output/artefacts/Nested.txt (output)", plan.Calls[1].Artefact)
+	assert.Equal(t, "callContains", plan.Calls[2].Function)
+	assert.Equal(t, []string{"cat", "/etc/hosts"}, plan.Calls[2].Commands[0].Argv)
+	assert.Contains(t, plan.Calls[2].Artefact, "(copy of /etc/hosts)")
+
+	flags.readOnly = true
+	plan = planAudit(BigAudit{Name: "Nested", Command: command})
+	assert.Equal(t, "read-only violation: shell() is blocked", plan.Calls[1].Issue)
+	flags.readOnly = false
+
+	deleteOutput()
+}
+
+func TestPlanAuditIssues(t *testing.T) {
+	flags.input = "./output/configDryRun.json"
+	fileWriter(testDryRunConfig, "configDryRun.json", false)
+	ReadConfig()
+
+	plan := planAudit(BigAudit{Name: "NotAllowed", Command: "call('echo a | curl http://example.com')"})
+	assert.Equal(t, "Could not find command: curl", plan.Calls[0].Issue)
+	assert.Len(t, plan.Calls[0].Commands, 2)
+	assert.Equal(t, "", plan.Calls[0].Artefact)
+
+	plan = planAudit(BigAudit{Name: "Policy", Command: "rmmod usb_storage"})
+	assert.Equal(t, `policy violation: argument "usb_storage" of rmmod is forbidden`, plan.Calls[0].Issue)
+
+	plan = planAudit(BigAudit{Name: "Dynamic", Command: "var cmd = 'echo a'; call(cmd)"})
+	assert.Equal(t, "cmd", plan.Calls[0].Source)
+	assert.Equal(t, "command is not a string literal and cannot be planned", plan.Calls[0].Issue)
+
+	plan = planAudit(BigAudit{Name: "Syntax", Command: "var x = "})
+	assert.Contains(t, plan.Issue, "SyntaxError")
+
+	plan = planAudit(BigAudit{Name: "Empty", Command: ""})
+	assert.Equal(t, "cannot execute command", plan.Issue)
+
+	deleteOutput()
+}
+
+func TestFormatAuditPlan(t *testing.T) {
+	plan := AuditPlan{Name: "Audit", Calls: []PlannedCall{
+		{Function: "call", Source: "'echo a'", Argument: "echo a", Commands: []PlannedCommand{{Command: "echo", Binary: "/bin/echo", Argv: []string{"echo", "a"}}}, Artefact: "./output/artefacts/Audit.txt (output of echo)"},
+		{Function: "shell", Source: "'id'", Argument: "id", Issue: "shell() runs the command without the allowlist in /bin/bash"},
+	}}
+	expected := "[1/2] Audit\n" +
+		"\tcall('echo a')\n" +
+		"\t\t/bin/echo\t[\"echo\" \"a\"]\n" +
+		"\t\tartefact: ./output/artefacts/Audit.txt (output of echo)\n" +
+		"\tshell('id')\n" +
+		"\t\tISSUE: shell() runs the command without the allowlist in /bin/bash\n"
+	assert.Equal(t, expected, formatAuditPlan(plan, 1, 2))
+	assert.Equal(t, "[2/2] JS\n\tno commands\n", formatAuditPlan(AuditPlan{Name: "JS"}, 2, 2))
+}
@@ -0,0 +1,108 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGatherPlatformFactsFromHostRoot(t *testing.T) {
+	writeHostFile("etc/os-release", "ID=ubuntu\nID_LIKE=debian\nVERSION_ID=\"22.04\"\n")
+	writeHostFile("proc/sys/kernel/ostype", "Linux\n")
+	writeHostFile("proc/sys/kernel/osrelease", "5.15.0-91-generic\n")
+	writeHostFile("proc/sys/kernel/version", "#101-Ubuntu SMP\n")
+	writeHostFile("sys/class/dmi/id/sys_vendor", "QEMU\n")
+	writeHostFile("sys/class/dmi/id/product_name", "Standard PC (Q35 + ICH9, 2009)\n")
+	writeHostFile("proc/1/cgroup", "0::/\n")
+	hostRoot = "./output/host"
+
+	facts := &Facts{}
+	gatherPlatformFacts(facts)
+	assert.Equal(t, "ubuntu", facts.Os.Id)
+	assert.Equal(t, []string{"debian"}, facts.Os.IdLike)
+	assert.Equal(t, "22.04", facts.Os.VersionId)
+	assert.Equal(t, KernelFacts{Name: "Linux", Release: "5.15.0-91-generic", Version: "#101-Ubuntu SMP", Machine: facts.Kernel.Machine}, facts.Kernel)
+	assert.Equal(t, "QEMU", facts.Dmi.Vendor)
+	assert.Equal(t, "Standard PC (Q35 + ICH9, 2009)", facts.Dmi.Product)
+	assert.Equal(t, VirtualizationFacts{Vm: "qemu", Container: "none"}, facts.Virtualization)
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestGatherPlatformFactsUsrLibOsRelease(t *testing.T) {
+	writeHostFile("usr/lib/os-release", "ID=fedora\n")
+	hostRoot = "./output/host"
+
+	facts := &Facts{}
+	gatherPlatformFacts(facts)
+	assert.Equal(t, "fedora", facts.Os.Id)
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestDetectContainer(t *testing.T) {
+	hostRoot = "./output/host"
+
+	writeHostFile("proc/1/cgroup", "12:pids:/kubepods/besteffort/pod1\n")
+	assert.Equal(t, "kubepods", detectContainer("5.15.0"))
+
+	writeHostFile("proc/1/environ", "PATH=/bin\x00container=lxc\x00")
+	assert.Equal(t, "lxc", detectContainer("5.15.0"))
+
+	writeHostFile(".dockerenv", "")
+	assert.Equal(t, "docker", detectContainer("5.15.0"))
+
+	writeHostFile("run/.containerenv", "")
+	assert.Equal(t, "podman", detectContainer("5.15.0"))
+
+	writeHostFile("run/systemd/container", "systemd-nspawn\n")
+	assert.Equal(t, "systemd-nspawn", detectContainer("5.15.0"))
+
+	assert.Equal(t, "wsl", detectContainer("5.15.133.1-microsoft-standard-WSL2"))
+
+	deleteOutput()
+	assert.Equal(t, "none", detectContainer("5.15.0"))
+	hostRoot = "/"
+}
+
+func TestDetectVirtualMachine(t *testing.T) {
+	hostRoot = "./output/host"
+
+	assert.Equal(t, "vmware", detectVirtualMachine(DmiFacts{Vendor: "VMware, Inc.", Product: "VMware Virtual Platform"}))
+	assert.Equal(t, "oracle", detectVirtualMachine(DmiFacts{Vendor: "innotek GmbH", Product: "VirtualBox"}))
+	assert.Equal(t, "amazon", detectVirtualMachine(DmiFacts{BiosVendor: "Amazon EC2"}))
+	assert.Equal(t, "microsoft", detectVirtualMachine(DmiFacts{Vendor: "Microsoft Corporation", Product: "Virtual Machine"}))
+
+	writeHostFile("proc/cpuinfo", "processor\t: 0\nflags\t\t: fpu vme hypervisor lahf_lm\n")
+	assert.Equal(t, "other", detectVirtualMachine(DmiFacts{Vendor: "Dell Inc."}))
+
+	writeHostFile("sys/hypervisor/type", "xen\n")
+	assert.Equal(t, "xen", detectVirtualMachine(DmiFacts{}))
+
+	deleteOutput()
+	assert.Equal(t, "none", detectVirtualMachine(DmiFacts{Vendor: "Dell Inc."}))
+	hostRoot = "/"
+}
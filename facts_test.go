@@ -0,0 +1,100 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writes a file below ./output/host and creates its folders
+func writeHostFile(path string, content string) {
+	os.MkdirAll(filepath.Dir("./output/host/"+path), 0755)
+	os.WriteFile("./output/host/"+path, []byte(content), 0644)
+}
+
+func TestParseOsRelease(t *testing.T) {
+	writeHostFile("etc/os-release", "# comment\nNAME=\"Rocky Linux\"\nVERSION=\"9.2 (Blue Onyx)\"\nID=\"rocky\"\nID_LIKE=\"rhel centos fedora\"\nVERSION_ID=\"9.2\"\nPRETTY_NAME=\"Rocky Linux 9.2 (Blue Onyx)\"\n\nBROKEN LINE\n")
+
+	osFacts, found := parseOsRelease("./output/host/etc/os-release")
+	assert.True(t, found)
+	assert.Equal(t, OsFacts{
+		Id:         "rocky",
+		IdLike:     []string{"rhel", "centos", "fedora"},
+		Name:       "Rocky Linux",
+		Version:    "9.2 (Blue Onyx)",
+		VersionId:  "9.2",
+		PrettyName: "Rocky Linux 9.2 (Blue Onyx)",
+	}, osFacts)
+
+	_, found = parseOsRelease("./output/host/etc/missing")
+	assert.False(t, found)
+
+	deleteOutput()
+}
+
+func TestExposeFacts(t *testing.T) {
+	hostFacts = &Facts{Hostname: "auditedhost", Os: OsFacts{Id: "debian", IdLike: []string{}}, Interfaces: []InterfaceFacts{}}
+
+	createCommandVM()
+	value, err := VmCommand.RunString("facts.os.id = 'changed'; facts.hostname + ' ' + facts.os.id")
+	assert.Nil(t, err)
+	assert.Equal(t, "auditedhost changed", value.String())
+
+	createCommandVM()
+	value, err = VmCommand.RunString("facts.os.id")
+	assert.Nil(t, err)
+	assert.Equal(t, "debian", value.String())
+	assert.Equal(t, "debian", hostFacts.Os.Id)
+
+	hostFacts = nil
+	createCommandVM()
+	value, _ = VmCommand.RunString("typeof facts")
+	assert.Equal(t, "undefined", value.String())
+}
+
+func TestGatherFacts(t *testing.T) {
+	facts := gatherFacts()
+	hostname, _ := os.Hostname()
+	assert.Equal(t, hostname, facts.Hostname)
+	assert.Equal(t, hasAdminPermissions(), facts.Root)
+	assert.NotEmpty(t, facts.Architecture)
+	assert.NotEmpty(t, facts.Interfaces)
+	assert.NotEmpty(t, facts.Os.Id)
+}
+
+func TestWriteRunMetadataFacts(t *testing.T) {
+	os.Mkdir("./output", 0777)
+	ConfigName = "./output/configFacts.json"
+	FirstResultEntry = false
+	runMetadata = RunMetadata{Facts: &Facts{Hostname: "auditedhost", Root: true, Os: OsFacts{Id: "debian", IdLike: []string{}}}}
+
+	WriteResultJSON(BigAudit{Name: "Audit", Command: "echo a"}, true, true, "a", "", "==")
+	WriteRunMetadata()
+	CheckFileContent(t, pathResult, `"Run Metadata": {"Facts": {"hostname": "auditedhost","architecture": "","root": true,"os": {"id": "debian","idLike": [],`, nil)
+
+	runMetadata = RunMetadata{}
+	deleteOutput()
+}
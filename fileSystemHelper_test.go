@@ -0,0 +1,136 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadFileSavesArtefact(t *testing.T) {
+	fileWriter("user=admin\r\npassword=secret123\r\n", "fsHelper.txt", false)
+	bigAudit = BigAudit{Name: "ReadFileAudit", BlackenContent: "secret[0-9]+"}
+	dontSaveArtefact = false
+
+	content, err := ReadFile("./output/fsHelper.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "user=admin\r\npassword=secret123\r\n", content)
+	CheckFileExists(t, "./output/artefacts/ReadFileAudit/output_fsHelper.txt")
+	CheckFileContent(t, "./output/artefacts/ReadFileAudit/output_fsHelper.txt", "password=REDACTED", nil)
+
+	lines, err := ReadLines("./output/fsHelper.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user=admin", "password=secret123"}, lines)
+
+	_, err = ReadFile("./output/missing.txt")
+	assert.Error(t, err)
+
+	bigAudit = BigAudit{}
+	deleteOutput()
+}
+
+func TestReadFileDontSaveArtefact(t *testing.T) {
+	fileWriter("content", "fsHelper.txt", false)
+	bigAudit = BigAudit{Name: "ReadFileAudit"}
+	dontSaveArtefact = true
+
+	_, err := ReadFile("./output/fsHelper.txt")
+	assert.Nil(t, err)
+	assert.NoFileExists(t, "./output/artefacts/ReadFileAudit/output_fsHelper.txt")
+
+	dontSaveArtefact = false
+	bigAudit = BigAudit{}
+	deleteOutput()
+}
+
+func TestStatListDirGlob(t *testing.T) {
+	fileWriter("12345", "fsHelper.txt", false)
+	os.Chmod("./output/fsHelper.txt", 0640)
+	os.Mkdir("./output/fsHelperDir", 0755)
+
+	info, err := Stat("./output/fsHelper.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "0640", info["mode"])
+	assert.Equal(t, int64(5), info["size"])
+	assert.Equal(t, false, info["isDir"])
+	assert.Equal(t, false, info["isSymlink"])
+	assert.NotEmpty(t, info["mtime"])
+
+	_, err = Stat("./output/missing.txt")
+	assert.Error(t, err)
+
+	assert.True(t, Exists("./output/fsHelper.txt"))
+	assert.False(t, Exists("./output/missing.txt"))
+
+	entries, err := ListDir("./output")
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "fsHelper.txt", entries[0]["name"])
+	assert.Equal(t, "fsHelperDir", entries[1]["name"])
+	assert.Equal(t, true, entries[1]["isDir"])
+
+	matches, err := Glob("./output/*.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"output/fsHelper.txt"}, matches)
+	matches, err = Glob("./output/*.json")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, matches)
+	_, err = Glob("[")
+	assert.EqualError(t, err, "invalid pattern [")
+
+	deleteOutput()
+}
+
+func TestFileSystemHelpersInJavaScript(t *testing.T) {
+	fileWriter("first\nsecond\n", "fsHelper.txt", false)
+	dontSaveArtefact = true
+	createCommandVM()
+
+	value, err := VmCommand.RunString("stat('./output/fsHelper.txt').size == 13 && exists('./output/fsHelper.txt') && readLines('./output/fsHelper.txt')[1] == 'second'")
+	assert.Nil(t, err)
+	assert.True(t, value.ToBoolean())
+
+	value, err = VmCommand.RunString("listDir('./output').map(function (entry) { return entry.name }).join(',')")
+	assert.Nil(t, err)
+	assert.Equal(t, "fsHelper.txt", value.String())
+
+	_, err = VmCommand.RunString("readFile('./output/missing.txt')")
+	assert.Contains(t, betterGojaError(err), "no such file or directory")
+	assert.NotContains(t, betterGojaError(err), "native")
+
+	dontSaveArtefact = false
+	deleteOutput()
+}
+
+func TestFileModeToOctal(t *testing.T) {
+	assert.Equal(t, "0644", fileModeToOctal(0644))
+	assert.Equal(t, "4755", fileModeToOctal(os.ModeSetuid|0755))
+	assert.Equal(t, "1777", fileModeToOctal(os.ModeDir|os.ModeSticky|0777))
+	assert.Equal(t, "2750", fileModeToOctal(os.ModeSetgid|0750))
+}
+
+func TestFileArtefactName(t *testing.T) {
+	assert.Equal(t, "etc_ssh_sshd_config", fileArtefactName("/etc/ssh/sshd_config"))
+	assert.Equal(t, "output_fsHelper.txt", fileArtefactName("./output/fsHelper.txt"))
+}
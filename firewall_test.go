@@ -0,0 +1,227 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const iptablesSaveOutput = `# Generated by iptables-save v1.8.7 on Mon Oct 19 10:00:00 2026
+*filter
+:INPUT DROP [0:0]
+:FORWARD DROP [0:0]
+:OUTPUT ACCEPT [12:3456]
+:ssh-in - [0:0]
+-A INPUT -i lo -j ACCEPT
+-A INPUT -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+-A INPUT -s 10.0.0.0/8 ! -i eth1 -p tcp -m tcp --dport 22 -m comment --comment "admin ssh" -j ssh-in
+-A INPUT -p tcp -m multiport --dports 8000:8080,443 --syn -j ACCEPT
+-A INPUT -m limit --limit 5/min -j LOG --log-prefix "dropped: "
+-A ssh-in -j ACCEPT
+COMMIT
+*nat
+:PREROUTING ACCEPT [0:0]
+:POSTROUTING ACCEPT [0:0]
+-A POSTROUTING -o eth0 -j MASQUERADE
+COMMIT
+`
+
+const nftJsonOutput = `{"nftables": [{"metainfo": {"version": "1.0.6", "json_schema_version": 1}},
+{"table": {"family": "inet", "name": "filter", "handle": 1}},
+{"chain": {"family": "inet", "table": "filter", "name": "input", "handle": 1, "type": "filter", "hook": "input", "prio": 0, "policy": "drop"}},
+{"chain": {"family": "inet", "table": "filter", "name": "services", "handle": 2}},
+{"rule": {"family": "inet", "table": "filter", "chain": "input", "handle": 3, "expr": [{"match": {"op": "==", "left": {"meta": {"key": "iifname"}}, "right": "lo"}}, {"accept": null}]}},
+{"rule": {"family": "inet", "table": "filter", "chain": "input", "handle": 4, "expr": [{"match": {"op": "in", "left": {"ct": {"key": "state"}}, "right": ["established", "related"]}}, {"counter": {"packets": 10, "bytes": 800}}, {"accept": null}]}},
+{"rule": {"family": "inet", "table": "filter", "chain": "input", "handle": 5, "comment": "web", "expr": [{"match": {"op": "==", "left": {"payload": {"protocol": "ip", "field": "saddr"}}, "right": {"prefix": {"addr": "192.168.0.0", "len": 16}}}}, {"match": {"op": "==", "left": {"payload": {"protocol": "tcp", "field": "dport"}}, "right": {"set": [80, 443, {"range": [8000, 8080]}]}}}, {"jump": {"target": "services"}}]}},
+{"rule": {"family": "inet", "table": "filter", "chain": "input", "handle": 6, "expr": [{"match": {"op": "!=", "left": {"meta": {"key": "oifname"}}, "right": "eth0"}}, {"log": {"prefix": "in: "}}]}}
+]}`
+
+func TestParseIptablesSave(t *testing.T) {
+	tables, err := parseIptablesSave(iptablesSaveOutput, "ip")
+	assert.Nil(t, err)
+	assert.Len(t, tables, 2)
+	filter := tables[0]
+	assert.Equal(t, "filter", filter.Name)
+	assert.Equal(t, "ip", filter.Family)
+	assert.Len(t, filter.Chains, 4)
+	assert.Equal(t, "input", filter.Chains[0].Hook)
+	assert.Equal(t, "drop", filter.Chains[0].Policy)
+	assert.Equal(t, "", filter.Chains[3].Hook)
+	assert.Equal(t, "", filter.Chains[3].Policy)
+
+	rules := filter.Chains[0].Rules
+	assert.Len(t, rules, 5)
+	assert.Equal(t, FirewallRule{Action: "accept", InInterface: "lo", States: []string{}, Text: "-A INPUT -i lo -j ACCEPT"}, rules[0])
+	assert.Equal(t, []string{"related", "established"}, rules[1].States)
+	assert.Equal(t, FirewallRule{Action: "jump", Target: "ssh-in", Protocol: "tcp", Source: "10.0.0.0/8", InInterface: "!eth1", DestinationPorts: "22", States: []string{}, Comment: "admin ssh", Text: rules[2].Text}, rules[2])
+	assert.Equal(t, "8000-8080,443", rules[3].DestinationPorts)
+	assert.Equal(t, "accept", rules[3].Action)
+	assert.Equal(t, "log", rules[4].Action)
+	assert.Equal(t, "masquerade", tables[1].Chains[1].Rules[0].Action)
+
+	_, err = parseIptablesSave(":INPUT ACCEPT [0:0]", "ip")
+	assert.Equal(t, "firewall: iptables-save line 1: no table before :INPUT ACCEPT [0:0]", err.Error())
+	_, err = parseIptablesSave("*filter\n-A MISSING -j ACCEPT", "ip6")
+	assert.Equal(t, "firewall: iptables-save line 2: unknown chain MISSING", err.Error())
+	_, err = parseIptablesSave("*filter\n:\n", "ip")
+	assert.Equal(t, "firewall: iptables-save line 2: missing chain name", err.Error())
+}
+
+var testFirewallConfig = `{
+	"commands": [
+		{
+			"name": "Firewall",
+			"command": "firewall()"
+		}
+	],
+	"system":
+	{
+		` + getConfigSystemForOS() + `
+	}
+}`
+
+func TestCallFirewallCommand(t *testing.T) {
+	flags.input = "./output/configFirewall.json"
+	fileWriter(testFirewallConfig, "configFirewall.json", false)
+	ReadConfig()
+	bigAudit = GetBigAudits()[0]
+	writeHostFile("etc/iptables/rules.v4", "*filter\n")
+	output = "previous"
+
+	// stdout is kept when the command also writes to stderr
+	content, err := callFirewallCommand("ls ./output/host/etc/iptables/rules.v4 ./output/host/missing")
+	assert.Nil(t, err)
+	assert.Equal(t, "./output/host/etc/iptables/rules.v4", content)
+	assert.Equal(t, "previous", output)
+
+	_, err = callFirewallCommand("ls ./output/host/missing")
+	assert.Equal(t, "firewall: ls failed", err.Error())
+
+	output = ""
+	bigAudit = BigAudit{}
+	deleteOutput()
+}
+
+func TestParseNftJson(t *testing.T) {
+	tables, err := parseNftJson(nftJsonOutput)
+	assert.Nil(t, err)
+	assert.Len(t, tables, 1)
+	assert.Equal(t, "inet", tables[0].Family)
+	input := tables[0].Chains[0]
+	assert.Equal(t, FirewallChain{Name: "services", Rules: []FirewallRule{}}, tables[0].Chains[1])
+	assert.Equal(t, "input", input.Hook)
+	assert.Equal(t, "drop", input.Policy)
+	assert.Equal(t, "filter", input.Type)
+
+	assert.Len(t, input.Rules, 4)
+	assert.Equal(t, "lo", input.Rules[0].InInterface)
+	assert.Equal(t, "accept", input.Rules[0].Action)
+	assert.Equal(t, []string{"established", "related"}, input.Rules[1].States)
+	assert.Equal(t, "accept", input.Rules[1].Action)
+	assert.Equal(t, "192.168.0.0/16", input.Rules[2].Source)
+	assert.Equal(t, "tcp", input.Rules[2].Protocol)
+	assert.Equal(t, "80,443,8000-8080", input.Rules[2].DestinationPorts)
+	assert.Equal(t, "jump", input.Rules[2].Action)
+	assert.Equal(t, "services", input.Rules[2].Target)
+	assert.Equal(t, "web", input.Rules[2].Comment)
+	assert.Equal(t, "!eth0", input.Rules[3].OutInterface)
+	assert.Equal(t, "log", input.Rules[3].Action)
+
+	_, err = parseNftJson("Error: syntax error")
+	assert.Contains(t, err.Error(), "firewall: nft returned no valid JSON")
+}
+
+func TestReadFirewalldZones(t *testing.T) {
+	writeHostFile("usr/lib/firewalld/zones/public.xml", `<?xml version="1.0" encoding="utf-8"?>
+<zone>
+  <short>Public</short>
+  <service name="ssh"/>
+  <service name="dhcpv6-client"/>
+</zone>`)
+	writeHostFile("etc/firewalld/zones/public.xml", `<?xml version="1.0" encoding="utf-8"?>
+<zone target="DROP">
+  <interface name="eth0"/>
+  <source address="10.0.0.0/8"/>
+  <service name="ssh"/>
+  <port protocol="tcp" port="8000-8080"/>
+  <rule family="ipv4">
+    <source address="192.168.1.0/24" invert="True"/>
+    <service name="ssh"/>
+    <reject/>
+  </rule>
+</zone>`)
+	writeHostFile("usr/lib/firewalld/zones/trusted.xml", `<zone target="ACCEPT"><protocol value="icmp"/></zone>`)
+	writeHostFile("usr/lib/firewalld/services/ssh.xml", `<service><short>SSH</short><port protocol="tcp" port="22"/></service>`)
+	writeHostFile("etc/firewalld/firewalld.conf", "# comment\nDefaultZone=public\n")
+	hostRoot = "./output/host"
+
+	table, defaultZone, err := readFirewalldZones()
+	assert.Nil(t, err)
+	assert.Equal(t, "public", defaultZone)
+	assert.Len(t, table.Chains, 2)
+	public := table.Chains[0]
+	assert.Equal(t, "public", public.Name)
+	assert.True(t, public.Default)
+	assert.Equal(t, "drop", public.Policy)
+	assert.Equal(t, []string{"eth0"}, public.Interfaces)
+	assert.Equal(t, []string{"10.0.0.0/8"}, public.Sources)
+	assert.Len(t, public.Rules, 5)
+	assert.Equal(t, "lo", public.Rules[0].InInterface)
+	assert.Equal(t, FirewallRule{Action: "accept", Protocol: "tcp", DestinationPorts: "22", States: []string{}, Service: "ssh", Text: "service ssh"}, public.Rules[2])
+	assert.Equal(t, "8000-8080", public.Rules[3].DestinationPorts)
+	assert.Equal(t, FirewallRule{Action: "reject", Protocol: "tcp", Source: "!192.168.1.0/24", DestinationPorts: "22", States: []string{}, Service: "ssh", Text: "rule service ssh source !192.168.1.0/24 reject"}, public.Rules[4])
+	assert.Equal(t, "accept", table.Chains[1].Policy)
+	assert.False(t, table.Chains[1].Default)
+	assert.Equal(t, "icmp", table.Chains[1].Rules[2].Protocol)
+
+	writeHostFile("etc/firewalld/zones/broken.xml", "<zone><service></zone>")
+	_, _, err = readFirewalldZones()
+	assert.Contains(t, err.Error(), "firewall: /etc/firewalld/zones/broken.xml: ")
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestFirewall(t *testing.T) {
+	writeHostFile("usr/lib/firewalld/zones/drop.xml", `<zone target="DROP"/>`)
+	writeHostFile("etc/firewalld/firewalld.conf", "DefaultZone=drop\n")
+	writeHostFile("proc/812/comm", "firewalld\n")
+	hostRoot = "./output/host"
+
+	command := "var f = firewall(); f.tables.filter(function (t) { return t.backend == 'firewalld' }).map(function (t) { return t.chains[0].name + ' ' + t.chains[0].policy + ' ' + t.chains[0].default }).join() + ' ' + f.defaultZone"
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Firewall", Command: command}))
+	assert.Equal(t, "drop drop true drop", output)
+
+	// the zones of a stopped firewalld filter nothing
+	os.RemoveAll("./output/host/proc/812")
+	command = "var f = firewall(); f.backends.indexOf('firewalld') + ' ' + f.tables.filter(function (t) { return t.backend == 'firewalld' }).length + ' ' + (f.defaultZone == '')"
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Firewall", Command: command}))
+	assert.Equal(t, "-1 0 true", output)
+
+	hostRoot = "/"
+	bigAudit = BigAudit{}
+	dontSaveArtefact = false
+	deleteOutput()
+}
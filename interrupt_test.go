@@ -0,0 +1,165 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testInterruptConfig = `{
+	"commands": [
+		{
+			"name": "FirstAudit",
+			"command": "echo one"
+		},
+		{
+			"name": "SecondAudit",
+			"command": "echo two"
+		},
+		{
+			"name": "ThirdAudit",
+			"command": "echo three"
+		}
+	],
+	"system":
+	{
+		` + getConfigSystemForOS() + `
+	}
+}`
+
+func TestRunTrackedCommandInterrupt(t *testing.T) {
+	handleInterrupts()
+
+	out, err := runTrackedCommand(exec.Command("echo", "tracked"), false)
+	assert.Nil(t, err)
+	assert.Equal(t, "tracked\n", string(out))
+
+	started := time.Now()
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		interruptAudit("interrupt")
+	}()
+	_, err = runTrackedCommand(exec.Command("sleep", "10"), false)
+	assert.Error(t, err)
+	assert.True(t, time.Since(started) < 5*time.Second, "Check the running command was killed")
+	assert.True(t, isInterrupted())
+
+	_, err = runTrackedCommand(exec.Command("echo", "tracked"), false)
+	assert.EqualError(t, err, "audit interrupted")
+
+	stopHandlingInterrupts()
+	handleInterrupts()
+	assert.False(t, isInterrupted())
+	stopHandlingInterrupts()
+}
+
+func TestInterruptAndResume(t *testing.T) {
+	flags.input = "./output/configInterrupt.json"
+	fileWriter(testInterruptConfig, "configInterrupt.json", false)
+	ReadConfig()
+	FirstResultEntry = false
+	runMetadata = RunMetadata{}
+
+	WriteResultJSON(GetBigAudits()[0], true, true, "one", "", "==")
+	finishInterruptedAudit(1, GetBigAudits()[1])
+	WriteRunMetadata()
+
+	CheckFileExists(t, checkpointPath)
+	CheckFileContent(t, checkpointPath, `{"config": "./output/configInterrupt.json","nextAudit": 1,"auditName": "SecondAudit"}`, nil)
+	CheckFileContent(t, pathResult, `"Run Metadata": {"Interrupted": true,"Interrupted at": "SecondAudit"}`, nil)
+
+	createFolderIfNotExist("./output/artefacts/", "artefacts")
+	createFolderIfNotExist("./output/artefacts/SecondAudit/", "SecondAudit")
+	fileWriter("stale", "artefacts/SecondAudit/etc_passwd", false)
+	fileWriter("stale", "artefacts/SecondAudit.txt", false)
+
+	runMetadata = RunMetadata{}
+	startAudit, err := prepareResume()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, startAudit)
+	assert.Equal(t, "SecondAudit", runMetadata.ResumedAt)
+	assert.NotContains(t, getResultJSONContent(), "Run Metadata")
+	assert.False(t, checkPathExists("./output/artefacts/SecondAudit.txt"))
+	assert.False(t, checkPathExists("./output/artefacts/SecondAudit"))
+
+	WriteResultJSON(GetBigAudits()[1], true, true, "two", "", "==")
+	expectedResult := `{
+		"./output/configInterrupt.json": [
+			{
+				"Name": "FirstAudit",
+				"Command": "echo one",
+				"Command was executed": true,
+				"Output is as expected": true
+			},
+			{
+				"Name": "SecondAudit",
+				"Command": "echo two",
+				"Command was executed": true,
+				"Output is as expected": true
+			}
+		]
+	}`
+	CheckFileContent(t, pathResult, expectedResult, nil)
+
+	runMetadata = RunMetadata{}
+	deleteOutput()
+}
+
+func TestPrepareResumeInvalidCheckpoint(t *testing.T) {
+	flags.input = "./output/configInterrupt.json"
+	fileWriter(testInterruptConfig, "configInterrupt.json", false)
+	ReadConfig()
+
+	_, err := prepareResume()
+	assert.Error(t, err)
+
+	fileWriter(`{"config": "./output/configInterrupt.json", "nextAudit": 1, "auditName": "OtherAudit"}`, "checkpoint.json", false)
+	_, err = prepareResume()
+	assert.EqualError(t, err, "checkpoint does not match the config ./output/configInterrupt.json")
+
+	fileWriter(`{"config": "./output/otherConfig.json", "nextAudit": 1, "auditName": "SecondAudit"}`, "checkpoint.json", false)
+	_, err = prepareResume()
+	assert.EqualError(t, err, "checkpoint does not match the config ./output/configInterrupt.json")
+
+	deleteOutput()
+}
+
+func TestRemoveRunMetadataWithoutResults(t *testing.T) {
+	flags.input = "./output/configInterrupt.json"
+	fileWriter(testInterruptConfig, "configInterrupt.json", false)
+	ReadConfig()
+	FirstResultEntry = true
+	runMetadata = RunMetadata{Interrupted: true, InterruptedAt: "FirstAudit"}
+
+	WriteRunMetadata()
+	CheckFileExists(t, pathResult)
+
+	removeRunMetadata()
+	assert.NoFileExists(t, pathResult)
+
+	runMetadata = RunMetadata{}
+	deleteOutput()
+}
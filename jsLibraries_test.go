@@ -0,0 +1,125 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testJsLibrariesConfig = `{
+	"jsLibraries": ["lib/helpers.js"],
+	"commands": [
+		{
+			"name": "Library",
+			"command": "require('./lib/helpers').greet('audit')"
+		}
+	],
+	"system":
+	{
+		` + getConfigSystemForOS() + `
+	}
+}`
+
+func writeTestLibraries() {
+	os.MkdirAll("./output/lib", 0755)
+	fileWriter("var text = require('./text');\nexports.greet = function (name) {\n\treturn text.prefix + name;\n};\n", "lib/helpers.js", false)
+	fileWriter("exports.prefix = 'hello ';\n", "lib/text.js", false)
+	fileWriter(testJsLibrariesConfig, "configLibs.json", false)
+	flags.input = "./output/configLibs.json"
+	ReadConfig()
+}
+
+func TestLoadJsLibraries(t *testing.T) {
+	writeTestLibraries()
+	assert.Equal(t, []string{"lib/helpers.js"}, jsLibraries.Paths)
+
+	createCommandVM()
+	assert.Nil(t, loadJsLibraries())
+	value, err := VmCommand.RunString("require('./lib/helpers').greet('audit')")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello audit", value.String())
+
+	// libraries are compiled once, a new runtime gets the same code
+	fileWriter("exports.greet = function () { return 'changed' };\n", "lib/helpers.js", false)
+	createCommandVM()
+	value, err = VmCommand.RunString("require('./lib/helpers.js').greet('audit')")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello audit", value.String())
+
+	jsRegistry = nil
+	deleteOutput()
+}
+
+func TestLoadJsLibrariesSyntaxError(t *testing.T) {
+	writeTestLibraries()
+	fileWriter("exports.a = 1;\nexports.b = function ( {\n", "lib/helpers.js", false)
+
+	createCommandVM()
+	err := loadJsLibraries()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "JavaScript library lib/helpers.js: SyntaxError: lib/helpers.js: Line 2:")
+	assert.NotContains(t, err.Error(), "native")
+
+	jsRegistry = nil
+	deleteOutput()
+}
+
+func TestRequireOutsideConfigDir(t *testing.T) {
+	writeTestLibraries()
+	createCommandVM()
+	assert.Nil(t, loadJsLibraries())
+
+	_, err := VmCommand.RunString("require('../go.mod')")
+	assert.Equal(t, "../go.mod is outside of the config directory", betterGojaError(err))
+	_, err = VmCommand.RunString("require('/etc/hostname')")
+	assert.Error(t, err)
+	_, err = VmCommand.RunString("require('./lib/missing')")
+	assert.Error(t, err)
+
+	jsRegistry = nil
+	deleteOutput()
+}
+
+func TestLibraryModulePath(t *testing.T) {
+	assert.Equal(t, "./lib/helpers.js", libraryModulePath("lib/helpers.js"))
+	assert.Equal(t, "./helpers.js", libraryModulePath("./helpers.js"))
+	assert.Equal(t, "../helpers.js", libraryModulePath("../helpers.js"))
+}
+
+func TestPlanLibrary(t *testing.T) {
+	writeTestLibraries()
+	fileWriter("exports.check = function () { return callContains('echo a', 'a') || shell('id') };\n", "lib/helpers.js", false)
+
+	plan := planLibrary("lib/helpers.js")
+	assert.Equal(t, "jsLibrary lib/helpers.js", plan.Name)
+	assert.Len(t, plan.Calls, 2)
+	assert.Equal(t, "", plan.Calls[0].Issue)
+	assert.Equal(t, "", plan.Calls[0].Artefact)
+	assert.Equal(t, "shell", plan.Calls[1].Function)
+
+	assert.Equal(t, "cannot read lib/missing.js", planLibrary("lib/missing.js").Issue)
+
+	deleteOutput()
+}
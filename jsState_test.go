@@ -0,0 +1,75 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runCheckInNewRuntime(audit BigAudit) error {
+	bigAudit = audit
+	dontSaveArtefact = true
+	prepareCheckRuntime(audit)
+	return runCommand()
+}
+
+func TestCheckRuntimeIsolation(t *testing.T) {
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "First", Command: "leaked = 'first'; Math.max = function () { return 0 }; leaked"}))
+	assert.Equal(t, "first", output)
+
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Second", Command: "typeof leaked + ' ' + Math.max(1, 2)"}))
+	assert.Equal(t, "undefined 2", output)
+
+	dontSaveArtefact = false
+}
+
+func TestSharedState(t *testing.T) {
+	sharedState = make(map[string]interface{})
+
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Producer", Command: "sharedState.users = ['root', 'admin']; sharedState.count = 2; 'done'", SharedState: true}))
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Isolated", Command: "typeof sharedState == 'undefined'"}))
+	assert.Equal(t, "true", output)
+
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Consumer", Command: "sharedState.users.length + sharedState.count + ' ' + sharedState.users[1]", SharedState: true}))
+	assert.Equal(t, "4 admin", output)
+
+	sharedState = make(map[string]interface{})
+	dontSaveArtefact = false
+}
+
+func TestCheckRuntimePreloadsLibraries(t *testing.T) {
+	writeTestLibraries()
+	fileWriter("var text = require('./text');\nformatUser = function (name) {\n\treturn text.prefix + name;\n};\nexports.greet = formatUser;\n", "lib/helpers.js", false)
+	createCommandVM()
+	assert.Nil(t, loadJsLibraries())
+
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "First", Command: "formatUser('root')"}))
+	assert.Equal(t, "hello root", output)
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Second", Command: "formatUser('admin') + ' ' + require('./lib/helpers').greet('audit')"}))
+	assert.Equal(t, "hello admin hello audit", output)
+
+	jsRegistry = nil
+	dontSaveArtefact = false
+	deleteOutput()
+}
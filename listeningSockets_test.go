@@ -0,0 +1,125 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const procNetTcp = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0019 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1002 1 0000000000000000 100 0 0 10 0
+   2: 00000000:0017 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1003 1 0000000000000000 100 0 0 10 0
+   3: 0F02000A:0016 0A02000A:C350 01 00000000:00000000 02:00000FEE 00000000     0        0 1004 4 0000000000000000 20 4 30 10 -1
+`
+
+const procNetTcp6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:0016 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2001 1 0000000000000000 100 0 0 10 0
+`
+
+const procNetUdp = `   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  100: 3500007F:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000   101        0 3001 2 0000000000000000 0
+  101: 0F02000A:A2B4 08080808:0035 01 00000000:00000000 00:00000000 00000000     0        0 3002 2 0000000000000000 0
+`
+
+func writeSocketFixtures() {
+	writeHostFile("proc/net/tcp", procNetTcp)
+	writeHostFile("proc/net/tcp6", procNetTcp6)
+	writeHostFile("proc/net/udp", procNetUdp)
+	writeHostFile("proc/100/comm", "sshd\n")
+	writeHostFile("proc/200/comm", "in.telnetd\n")
+	writeHostFile("proc/150/comm", "sshd\n")
+	os.MkdirAll("./output/host/proc/100/fd", 0755)
+	os.MkdirAll("./output/host/proc/150/fd", 0755)
+	os.MkdirAll("./output/host/proc/200/fd", 0755)
+	os.Symlink("socket:[1001]", "./output/host/proc/150/fd/3")
+	os.Symlink("socket:[1001]", "./output/host/proc/100/fd/3")
+	os.Symlink("socket:[2001]", "./output/host/proc/100/fd/4")
+	os.Symlink("/dev/null", "./output/host/proc/100/fd/0")
+	os.Symlink("socket:[1003]", "./output/host/proc/200/fd/5")
+	hostRoot = "./output/host"
+}
+
+func TestReadListeningSockets(t *testing.T) {
+	writeSocketFixtures()
+
+	sockets, err := readListeningSockets()
+	assert.Nil(t, err)
+	assert.Len(t, sockets, 5)
+	assert.Equal(t, ListeningSocket{Protocol: "tcp", Address: "0.0.0.0", Port: 22, Pid: 100, Pids: []int{100, 150}, Command: "sshd", User: "root", Inode: 1001}, sockets[0])
+	assert.Equal(t, ListeningSocket{Protocol: "tcp", Address: "127.0.0.1", Port: 25, Pids: []int{}, User: "root", Inode: 1002}, sockets[1])
+	assert.Equal(t, "in.telnetd", sockets[2].Command)
+	assert.Equal(t, "::", sockets[3].Address)
+	assert.Equal(t, "tcp6", sockets[3].Protocol)
+	assert.Equal(t, "127.0.0.53", sockets[4].Address)
+	assert.Equal(t, 53, sockets[4].Port)
+	assert.Equal(t, 101, sockets[4].Uid)
+
+	writeHostFile("proc/net/udp6", "header\n   0: 0000:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000 0 0 4001 2 0 0\n")
+	_, err = readListeningSockets()
+	assert.Equal(t, "listeners: /proc/net/udp6 line 2: invalid address 0000:0035", err.Error())
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestParseProcNetAddress(t *testing.T) {
+	address, port, err := parseProcNetAddress("0100007F:0016")
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1", address)
+	assert.Equal(t, 22, port)
+	address, _, _ = parseProcNetAddress("0000000000000000FFFF00000100007F:0035")
+	assert.Equal(t, "127.0.0.1", address)
+	address, _, _ = parseProcNetAddress("00000000000000000000000001000000:0277")
+	assert.Equal(t, "::1", address)
+	_, _, err = parseProcNetAddress("0100007F")
+	assert.Equal(t, "invalid address 0100007F", err.Error())
+}
+
+func TestAssertListeners(t *testing.T) {
+	writeSocketFixtures()
+
+	command := "assertListeners([{command: 'sshd', port: 22}]).length"
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Listeners", Command: command}))
+	assert.Equal(t, "1", output)
+	assert.Equal(t, "failed", checkResult.Status)
+	assert.Equal(t, "unexpected listeners: tcp 0.0.0.0:23 (in.telnetd)", checkResult.Message)
+	assert.Equal(t, "in.telnetd", checkResult.Details.([]interface{})[0].(map[string]interface{})["command"])
+
+	command = "assertListeners([{protocol: 'tcp', port: 22}, {address: '0.0.0.0', port: 23}])"
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Listeners", Command: command}))
+	assert.Equal(t, CheckResult{Status: "passed", Message: "all listeners are allowed"}, checkResult)
+
+	command = "assertListeners([{protocol: 'tcp', address: '*'}], {loopback: true})"
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Listeners", Command: command}))
+	assert.Equal(t, "unexpected listeners: udp 127.0.0.53:53", checkResult.Message)
+
+	assert.NotNil(t, runCheckInNewRuntime(BigAudit{Name: "Listeners", Command: "assertListeners(['sshd'])"}))
+
+	hostRoot = "/"
+	bigAudit = BigAudit{}
+	dontSaveArtefact = false
+	deleteOutput()
+}
@@ -0,0 +1,96 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadMacStatusSELinux(t *testing.T) {
+	writeHostFile("sys/kernel/security/lsm", "lockdown,capability,yama,selinux,bpf\n")
+	writeHostFile("sys/fs/selinux/enforce", "0")
+	writeHostFile("sys/fs/selinux/policyvers", "33")
+	writeHostFile("sys/fs/selinux/mls", "1")
+	writeHostFile("etc/selinux/config", "# comment\nSELINUX=enforcing\nSELINUXTYPE=targeted\n")
+	writeHostFile("etc/selinux/targeted/policy/policy.33", "")
+	writeHostFile("proc/1/attr/current", "system_u:system_r:init_t:s0\x00")
+	writeHostFile("proc/1/comm", "systemd\n")
+	writeHostFile("proc/812/attr/current", "system_u:system_r:unconfined_service_t:s0\x00")
+	writeHostFile("proc/812/comm", "myapp\n")
+	hostRoot = "./output/host"
+
+	status := readMacStatus()
+	assert.Equal(t, []string{"lockdown", "capability", "yama", "selinux", "bpf"}, status.Lsm)
+	assert.True(t, status.SELinux.Enabled)
+	assert.Equal(t, "permissive", status.SELinux.Mode)
+	assert.Equal(t, "enforcing", status.SELinux.ConfiguredMode)
+	assert.Equal(t, "targeted", status.SELinux.PolicyType)
+	assert.True(t, status.SELinux.PolicyInstalled)
+	assert.Equal(t, 33, status.SELinux.PolicyVersion)
+	assert.True(t, status.SELinux.Mls)
+	assert.Equal(t, []MacProcess{{Pid: 812, Command: "myapp", Context: "system_u:system_r:unconfined_service_t:s0"}}, status.SELinux.UnconfinedProcesses)
+	assert.False(t, status.AppArmor.Enabled)
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestReadMacStatusAppArmor(t *testing.T) {
+	writeHostFile("sys/module/apparmor/parameters/enabled", "Y\n")
+	writeHostFile("sys/kernel/security/apparmor/profiles", "/usr/sbin/cupsd (enforce)\n/usr/bin/man (complain)\nnvidia_modprobe (enforce)\n")
+	writeHostFile("etc/apparmor.d/usr.sbin.cupsd", "")
+	writeHostFile("etc/apparmor.d/usr.bin.man", "")
+	writeHostFile("etc/apparmor.d/abstractions/base", "")
+	writeHostFile("etc/apparmor.d/disable/usr.sbin.rsyslogd", "")
+	writeHostFile("proc/1/attr/current", "unconfined\n")
+	writeHostFile("proc/640/attr/current", "/usr/sbin/cupsd (enforce)\n")
+	writeHostFile("proc/702/attr/current", "unconfined\n")
+	writeHostFile("proc/702/comm", "cupsd\n")
+	os.Symlink("/usr/sbin/cupsd", "./output/host/proc/702/exe")
+	hostRoot = "./output/host"
+
+	status := readMacStatus()
+	assert.False(t, status.SELinux.Enabled)
+	assert.Equal(t, "disabled", status.SELinux.Mode)
+	assert.True(t, status.AppArmor.Enabled)
+	assert.Equal(t, AppArmorProfile{Name: "/usr/sbin/cupsd", Mode: "enforce"}, status.AppArmor.Profiles[0])
+	assert.Equal(t, map[string]int{"enforce": 2, "complain": 1}, status.AppArmor.ProfileCounts)
+	assert.Equal(t, map[string]int{"enforce": 1, "unconfined": 2}, status.AppArmor.ProcessCounts)
+	assert.Equal(t, []string{"/etc/apparmor.d/usr.bin.man", "/etc/apparmor.d/usr.sbin.cupsd"}, status.AppArmor.PolicyFiles)
+	assert.Equal(t, []string{"usr.sbin.rsyslogd"}, status.AppArmor.DisabledProfiles)
+	assert.Equal(t, []MacProcess{{Pid: 702, Command: "cupsd", Executable: "/usr/sbin/cupsd", Context: "unconfined"}}, status.AppArmor.UnconfinedProcesses)
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestSplitAppArmorLabel(t *testing.T) {
+	name, mode := splitAppArmorLabel("/usr/bin/evince (enforce)")
+	assert.Equal(t, "/usr/bin/evince", name)
+	assert.Equal(t, "enforce", mode)
+	name, mode = splitAppArmorLabel("unconfined")
+	assert.Equal(t, "unconfined", name)
+	assert.Equal(t, "unconfined", mode)
+}
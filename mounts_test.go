@@ -0,0 +1,105 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testMountInfo = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw,errors=remount-ro
+23 22 0:21 / /dev/shm rw,nosuid,nodev shared:2 - tmpfs tmpfs rw,inode64
+24 22 0:22 / /tmp rw,nosuid,nodev,noexec,relatime shared:3 master:1 - tmpfs tmpfs rw,size=1048576k
+25 22 8:2 /data /srv/my\040data rw,relatime - xfs /dev/sda2 rw
+26 22 0:23 / /run/empty rw - none none
+`
+
+var testFstab = `# <file system> <mount point> <type> <options> <dump> <pass>
+UUID=1234-abcd /               ext4    errors=remount-ro 0       1
+/dev/sda2       /srv/my\040data xfs defaults,nodev 0 2
+tmpfs           /dev/shm        tmpfs   defaults,nosuid,nodev,noexec,noauto
+/swapfile       none            swap    sw
+`
+
+func TestParseMountInfo(t *testing.T) {
+	writeHostFile("proc/self/mountinfo", testMountInfo)
+	hostRoot = "./output/host"
+
+	mounts, err := parseMountInfo(mountInfoFile)
+	assert.Nil(t, err)
+	assert.Len(t, mounts, 5)
+	assert.Equal(t, MountEntry{Id: 24, ParentId: 22, MajorMinor: "0:22", Root: "/", Device: "tmpfs", Mountpoint: "/tmp", Fstype: "tmpfs",
+		Options: []string{"rw", "nosuid", "nodev", "noexec", "relatime"}, SuperOptions: []string{"rw", "size=1048576k"}}, mounts[2])
+	assert.Equal(t, "/srv/my data", mounts[3].Mountpoint)
+	assert.Equal(t, "/data", mounts[3].Root)
+	assert.Equal(t, "none", mounts[4].Device)
+
+	writeHostFile("proc/self/mountinfo", "22 1 8:1 / / rw shared:1 ext4 /dev/sda1 rw\n")
+	_, err = parseMountInfo(mountInfoFile)
+	assert.Equal(t, "mounts: /proc/self/mountinfo line 1 is invalid", err.Error())
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestFstabAndMountUnits(t *testing.T) {
+	writeHostFile("etc/fstab", testFstab)
+	writeHostFile("usr/lib/systemd/system/tmp.mount", "[Unit]\nDescription=Temporary Directory /tmp\n\n[Mount]\nWhat=tmpfs\nWhere=/tmp\nType=tmpfs\nOptions=mode=1777,strictatime,nosuid,nodev,size=50%\n")
+	writeHostFile("etc/systemd/system/tmp.mount.d/options.conf", "[Mount]\nOptions=mode=1777,nosuid,nodev,noexec\n")
+	os.MkdirAll("./output/host/etc/systemd/system/local-fs.target.wants", 0755)
+	os.Symlink("/usr/lib/systemd/system/tmp.mount", "./output/host/etc/systemd/system/local-fs.target.wants/tmp.mount")
+	writeHostFile("usr/lib/systemd/system/var-tmp.mount", "[Mount]\nWhat=/tmp\nWhere=/var/tmp\nOptions=bind\n")
+	writeHostFile("usr/lib/systemd/system/data.mount", "[Mount]\nWhat=/dev/sdb1\nWhere=/data\n")
+	os.MkdirAll("./output/host/etc/systemd/system", 0755)
+	os.Symlink("/dev/null", "./output/host/etc/systemd/system/data.mount")
+	hostRoot = "./output/host"
+
+	entries, err := parseFstab(fstabFile)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 4)
+	assert.Equal(t, FstabEntry{Device: "UUID=1234-abcd", Mountpoint: "/", Fstype: "ext4", Options: []string{"errors=remount-ro"}, Pass: 1, Enabled: true, File: "/etc/fstab", Line: 2}, entries[0])
+	assert.Equal(t, "/srv/my data", entries[1].Mountpoint)
+	assert.Equal(t, 2, entries[1].Pass)
+	assert.False(t, entries[2].Enabled)
+	assert.Equal(t, []string{"sw"}, entries[3].Options)
+
+	units, err := mountUnits()
+	assert.Nil(t, err)
+	assert.Len(t, units, 2)
+	assert.Equal(t, FstabEntry{Device: "tmpfs", Mountpoint: "/tmp", Fstype: "tmpfs", Options: []string{"mode=1777", "nosuid", "nodev", "noexec"}, Enabled: true, Unit: "tmp.mount", File: "/usr/lib/systemd/system/tmp.mount"}, units[0])
+	assert.Equal(t, "/var/tmp", units[1].Mountpoint)
+	assert.False(t, units[1].Enabled)
+
+	writeHostFile("etc/fstab", "tmpfs /tmp\n")
+	_, err = parseFstab(fstabFile)
+	assert.Equal(t, "fstab: /etc/fstab line 1 needs device, mountpoint and fstype", err.Error())
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestUnescapeMountField(t *testing.T) {
+	assert.Equal(t, "/mnt/a b\tc\\d", unescapeMountField(`/mnt/a\040b\011c\134d`))
+	assert.Equal(t, `/mnt/x\04`, unescapeMountField(`/mnt/x\04`))
+}
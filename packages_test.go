@@ -0,0 +1,90 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func copyHostFile(source string, path string) {
+	content, _ := os.ReadFile(source)
+	writeHostFile(path, string(content))
+}
+
+func TestReadDpkgStatus(t *testing.T) {
+	packages, err := readDpkgStatus("./testdata/packages/dpkg-status")
+	assert.Nil(t, err)
+	assert.Equal(t, []InstalledPackage{
+		{Name: "openssh-server", Version: "1:9.2p1-2+deb12u1", Architecture: "amd64", State: "installed", Manager: "dpkg"},
+		{Name: "telnetd", Version: "0.17+2.4-2", Architecture: "amd64", State: "config-files", Manager: "dpkg"},
+		{Name: "libc6", Version: "2.36-9+deb12u3", Architecture: "i386", State: "installed", Manager: "dpkg"},
+		{Name: "libc6", Version: "2.36-9+deb12u3", Architecture: "amd64", State: "installed", Manager: "dpkg"},
+	}, packages)
+
+	writeHostFile("status", "Package: broken\nStatus: installed\n")
+	_, err = readDpkgStatus("./output/host/status")
+	assert.Equal(t, "dpkg: ./output/host/status has an invalid status for broken", err.Error())
+
+	deleteOutput()
+}
+
+func TestReadInstalledPackages(t *testing.T) {
+	copyHostFile("./testdata/packages/dpkg-status", "var/lib/dpkg/status")
+	copyHostFile("./testdata/packages/Packages.db", "usr/lib/sysimage/rpm/Packages.db")
+	hostRoot = "./output/host"
+	installedPackages = nil
+
+	packages, err := readInstalledPackages()
+	assert.Nil(t, err)
+	assert.Len(t, packages, 8)
+	assert.Equal(t, InstalledPackage{Name: "grub2-common", Version: "1:2.06-61.el9", Architecture: "noarch", State: "installed", Manager: "rpm"}, packages[7])
+
+	// the inventory is cached for the run
+	os.Remove("./output/host/var/lib/dpkg/status")
+	packages, _ = readInstalledPackages()
+	assert.Len(t, packages, 8)
+
+	installedPackages = nil
+	copyHostFile("./testdata/packages/rpmdb.sqlite", "var/lib/rpm/rpmdb.sqlite")
+	packages, _ = readInstalledPackages()
+	assert.Len(t, packages, 45)
+
+	installedPackages = nil
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestReadInstalledPackagesBerkeleyDb(t *testing.T) {
+	writeHostFile("var/lib/rpm/Packages", "")
+	hostRoot = "./output/host"
+	installedPackages = nil
+
+	_, err := readInstalledPackages()
+	assert.Equal(t, "rpm: the Berkeley DB database /var/lib/rpm/Packages is not supported", err.Error())
+	assert.Nil(t, installedPackages)
+
+	hostRoot = "/"
+	deleteOutput()
+}
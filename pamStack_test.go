@@ -0,0 +1,157 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writePamFixture() {
+	writeHostFile("etc/pam.d/system-auth", `#%PAM-1.0
+auth        required      pam_env.so
+auth        required      pam_faillock.so preauth silent deny=5 unlock_time=900
+auth        [success=1 default=ignore] pam_unix.so nullok \
+                                        try_first_pass
+auth        requisite     pam_deny.so
+auth        sufficient    pam_permit.so
+-auth       optional      pam_systemd_home.so
+account     required      pam_unix.so
+password    requisite     pam_pwquality.so retry=3 # minlen is set in pwquality.conf
+password    sufficient    pam_unix.so sha512 shadow use_authtok
+session     optional      pam_keyinit.so revoke
+session     [success=ok default=bad] pam_mkhomedir.so
+`)
+	writeHostFile("etc/pam.d/sshd", `auth       substack     system-auth
+auth       include      postlogin
+account    required     pam_nologin.so
+account    include      system-auth
+password   include      system-auth
+session    required     pam_selinux.so close
+session    optional     pam_exec.so [cmd=/usr/bin/logger -t pam \]x]
+session    include      system-auth
+`)
+	writeHostFile("etc/pam.d/postlogin", "auth optional pam_lastlog.so\nsession optional pam_motd.so\n")
+	writeHostFile("etc/pam.d/common-auth", "auth [success=2 default=ignore] pam_unix.so nullok\nauth requisite pam_deny.so\n")
+	writeHostFile("etc/pam.d/common-session", "session required pam_limits.so\n")
+	writeHostFile("etc/pam.d/su", "auth sufficient pam_rootok.so\nauth required pam_wheel.so use_uid group=wheel\n@include common-auth\n@include common-session\n")
+	writeHostFile("etc/pam.d/other", "auth required pam_deny.so\n")
+	hostRoot = "./output/host"
+}
+
+func TestPamStackIncludeAndSubstack(t *testing.T) {
+	writePamFixture()
+
+	stack, err := pamStack("sshd")
+	assert.Nil(t, err)
+
+	var authModules []string
+	for _, entry := range stack["auth"] {
+		authModules = append(authModules, entry.Name)
+	}
+	assert.Equal(t, []string{"pam_env", "pam_faillock", "pam_unix", "pam_deny", "pam_permit", "pam_systemd_home", "pam_lastlog"}, authModules)
+
+	faillock := stack["auth"][1]
+	assert.Equal(t, "required", faillock.Control)
+	assert.Equal(t, "5", faillock.Options["deny"])
+	assert.Equal(t, true, faillock.Options["preauth"])
+	assert.Equal(t, "system-auth", faillock.Substack)
+	assert.Equal(t, "system-auth", faillock.Service)
+	assert.Equal(t, 3, faillock.Line)
+
+	unix := stack["auth"][2]
+	assert.Equal(t, "[success=1 default=ignore]", unix.Control)
+	assert.Equal(t, map[string]string{"success": "1", "default": "ignore"}, unix.Actions)
+	assert.Equal(t, []string{"nullok", "try_first_pass"}, unix.Arguments)
+	assert.Equal(t, 4, unix.Line)
+
+	assert.True(t, stack["auth"][5].Optional)
+	assert.Equal(t, "", stack["auth"][6].Substack)
+	assert.Equal(t, "postlogin", stack["auth"][6].Service)
+
+	assert.Len(t, stack["account"], 2)
+	assert.Equal(t, "pam_pwquality", stack["password"][0].Name)
+	assert.Equal(t, []string{"retry=3"}, stack["password"][0].Arguments)
+	assert.Len(t, stack["session"], 4)
+	assert.Equal(t, "bad", stack["session"][0].Actions["default"])
+	assert.Equal(t, []string{"cmd=/usr/bin/logger -t pam ]x"}, stack["session"][1].Arguments)
+	assert.Equal(t, map[string]string{"success": "ok", "default": "bad"}, stack["session"][3].Actions)
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestPamStackDebianInclude(t *testing.T) {
+	writePamFixture()
+
+	stack, err := pamStack("su")
+	assert.Nil(t, err)
+	assert.Len(t, stack["auth"], 4)
+	assert.Equal(t, "pam_wheel", stack["auth"][1].Name)
+	assert.Equal(t, "wheel", stack["auth"][1].Options["group"])
+	assert.Equal(t, "common-auth", stack["auth"][2].Service)
+	assert.Equal(t, "pam_limits", stack["session"][0].Name)
+
+	// services without a file use "other"
+	stack, err = pamStack("vsftpd")
+	assert.Nil(t, err)
+	assert.Equal(t, "other", stack["auth"][0].Service)
+	assert.Equal(t, []PamEntry{}, stack["session"])
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestPamStackErrors(t *testing.T) {
+	writePamFixture()
+	writeHostFile("etc/pam.d/broken", "auth required\n")
+	writeHostFile("etc/pam.d/loop", "auth include loop\n")
+	writeHostFile("etc/pam.d/missing", "auth include not-there\n")
+	writeHostFile("etc/pam.d/control", "auth maybe pam_unix.so\n")
+
+	_, err := pamStack("broken")
+	assert.Equal(t, "pam: /etc/pam.d/broken line 1: expected type, control and module", err.Error())
+	_, err = pamStack("loop")
+	assert.Contains(t, err.Error(), "too many nested includes")
+	_, err = pamStack("missing")
+	assert.Equal(t, "pam: cannot read /etc/pam.d/not-there", err.Error())
+	_, err = pamStack("control")
+	assert.Contains(t, err.Error(), "unknown control maybe")
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestPamConf(t *testing.T) {
+	writeHostFile("etc/pam.conf", "# service type control module\nlogin auth required pam_unix.so\nlogin account include common\ncommon account required pam_access.so\nsshd auth required pam_deny.so\n")
+	hostRoot = "./output/host"
+
+	stack, err := pamStack("login")
+	assert.Nil(t, err)
+	assert.Equal(t, "pam_unix", stack["auth"][0].Name)
+	assert.Equal(t, "pam_access", stack["account"][0].Name)
+	assert.Equal(t, "/etc/pam.conf", stack["account"][0].File)
+
+	hostRoot = "/"
+	deleteOutput()
+}
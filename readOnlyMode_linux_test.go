@@ -0,0 +1,57 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestrictFileSystemWrites(t *testing.T) {
+	if _, err := landlockABIVersion(); err != nil {
+		t.Skip(err.Error())
+	}
+	os.MkdirAll("./output/writable", 0755)
+	os.MkdirAll("./output/blocked", 0755)
+	writable, _ := filepath.Abs("./output/writable")
+	blocked, _ := filepath.Abs("./output/blocked")
+
+	// the restricted thread ends together with the goroutine
+	results := make(chan error, 3)
+	go func() {
+		results <- restrictFileSystemWrites([]string{writable}, []string{os.DevNull})
+		results <- exec.Command("touch", writable+"/allowed").Run()
+		results <- exec.Command("touch", blocked+"/denied").Run()
+	}()
+
+	assert.Nil(t, <-results)
+	assert.Nil(t, <-results)
+	assert.Error(t, <-results)
+	assert.FileExists(t, writable+"/allowed")
+	assert.NoFileExists(t, blocked+"/denied")
+
+	deleteOutput()
+}
@@ -0,0 +1,101 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckReadOnlyViolation(t *testing.T) {
+	createFolderIfNotExist("./output/", "output")
+	outputPath, _ := filepath.Abs("./output")
+	flags.readOnly = false
+	assert.Nil(t, checkReadOnlyViolation("touch", "touch: cannot touch '"+outputPath+"/x': Permission denied\n"))
+
+	flags.readOnly = true
+	assert.EqualError(t, checkReadOnlyViolation("touch", "touch: cannot touch '"+outputPath+"/x': Permission denied\nmore\n"), "read-only violation: touch: touch: cannot touch '"+outputPath+"/x': Permission denied")
+	assert.EqualError(t, checkReadOnlyViolation("sed", "sed: couldn't open temporary file: Read-only file system"), "read-only violation: sed: sed: couldn't open temporary file: Read-only file system")
+	assert.Nil(t, checkReadOnlyViolation("grep", "grep: /etc/x: No such file or directory"))
+	// a read that the permissions deny is no write
+	assert.Nil(t, checkReadOnlyViolation("cat", "cat: /not-existing/shadow: Permission denied"))
+	assert.Nil(t, checkReadOnlyViolation("systemctl", "Failed to stop cron.service: Operation not permitted"))
+
+	readOnlyWritablePaths = []string{outputPath}
+	assert.Nil(t, checkReadOnlyViolation("touch", "touch: cannot touch '"+outputPath+"/x': Permission denied"))
+	readOnlyWritablePaths = nil
+	flags.readOnly = false
+	deleteOutput()
+}
+
+func TestCheckReadOnlyCommandPolicy(t *testing.T) {
+	var testCases = []struct {
+		command   string
+		arguments []string
+		expected  string
+	}{
+		{"systemctl", []string{"is-enabled", "cron.service"}, ""},
+		{"systemctl", []string{"show", "-p", "Restart", "stop.service"}, ""},
+		{"systemctl", []string{"stop", "cron.service"}, "read-only violation: argument \"stop\" of systemctl is forbidden"},
+		{"systemctl", []string{"--now", "mask", "cron"}, "read-only violation: argument \"mask\" of systemctl is forbidden"},
+		{"iptables", []string{"-nvL", "INPUT"}, ""},
+		{"iptables", []string{"-F"}, "read-only violation: argument \"-F\" of iptables is forbidden"},
+		{"ip6tables", []string{"--policy", "INPUT", "ACCEPT"}, "read-only violation: argument \"--policy\" of ip6tables is forbidden"},
+		{"nft", []string{"-j", "list", "ruleset"}, ""},
+		{"nft", []string{"flush", "ruleset"}, "read-only violation: argument \"flush\" of nft is forbidden"},
+		{"nft", []string{"'flush", "ruleset'"}, "read-only violation: argument \"'flush\" of nft is forbidden"},
+		{"auditctl", []string{"-l"}, ""},
+		{"auditctl", []string{"-D"}, "read-only violation: argument \"-D\" of auditctl is forbidden"},
+		{"auditctl", []string{"-w", "/etc/sudoers", "-p", "wa"}, "read-only violation: argument \"-w\" of auditctl is forbidden"},
+	}
+
+	for _, test := range testCases {
+		flags.readOnly = false
+		assert.Nil(t, checkCommandPolicy(test.command, test.arguments))
+		flags.readOnly = true
+		err := checkCommandPolicy(test.command, test.arguments)
+		if test.expected == "" {
+			assert.Nil(t, err)
+		} else {
+			assert.EqualError(t, err, test.expected)
+		}
+	}
+	flags.readOnly = false
+}
+
+func TestShellReadOnly(t *testing.T) {
+	flags.readOnly = true
+	assert.EqualError(t, Shell("ls"), "read-only violation: shell() is blocked")
+	flags.readOnly = false
+}
+
+func TestWrapperForAllReadOnlyEnvironment(t *testing.T) {
+	commandInSteps = ""
+	assert.Nil(t, WrapperForAll("ls").Env)
+
+	flags.readOnly = true
+	commandInSteps = ""
+	assert.Equal(t, readOnlyEnvironment(), WrapperForAll("ls").Env)
+	flags.readOnly = false
+}
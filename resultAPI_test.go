@@ -0,0 +1,105 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultAPI(t *testing.T) {
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Pass", Command: "result.pass('all good')"}))
+	assert.Equal(t, CheckResult{Status: "passed", Message: "all good"}, checkResult)
+
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Skip", Command: "result.skip()"}))
+	assert.Equal(t, CheckResult{Status: "skipped"}, checkResult)
+
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Fail", Command: "result.fail('wrong mode', {mode: '0777', files: ['a', 'b']}); result.pass('ignored')"}))
+	assert.Equal(t, "failed", checkResult.Status)
+	assert.Equal(t, "wrong mode", checkResult.Message)
+	assert.Equal(t, map[string]interface{}{"mode": "0777", "files": []interface{}{"a", "b"}}, checkResult.Details)
+
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Undecided", Command: "'output'"}))
+	assert.Equal(t, CheckResult{}, checkResult)
+
+	dontSaveArtefact = false
+}
+
+func TestResultEvidence(t *testing.T) {
+	command := "result.evidence('config', 'password=secret1'); result.evidence('mode', '0600'); result.evidence('config', 'password=secret2')"
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Evidence", Command: command, BlackenContent: "secret[0-9]"}))
+	assert.Equal(t, []Evidence{{Name: "config", Text: "password=REDACTED"}, {Name: "mode", Text: "0600"}}, checkResult.Evidence)
+	assert.Equal(t, "", checkResult.Status)
+
+	bigAudit = BigAudit{}
+	dontSaveArtefact = false
+}
+
+func TestExportDetails(t *testing.T) {
+	createCommandVM()
+	value, _ := VmCommand.RunString("(function () {})")
+	assert.Equal(t, value.String(), exportDetails(value))
+	value, _ = VmCommand.RunString("undefined")
+	assert.Nil(t, exportDetails(value))
+	value, _ = VmCommand.RunString("42")
+	assert.Equal(t, int64(42), exportDetails(value))
+}
+
+func TestWriteCheckResult(t *testing.T) {
+	os.Mkdir("./output", 0777)
+	ConfigName = "./output/configResult.json"
+	FirstResultEntry = false
+	bigAudit = BigAudit{Name: "Script", Command: "result.fail('bad')"}
+	checkResult = CheckResult{Status: "failed", Message: "bad", Details: map[string]interface{}{"uid": 0}, Evidence: []Evidence{{Name: "stat", Text: "0777"}}}
+
+	writeCheckResult(bigAudit)
+	assert.False(t, auditResult)
+
+	expectedResult := `{
+		"./output/configResult.json": [
+			{
+				"Name": "Script",
+				"Command": "result.fail('bad')",
+				"Command was executed": true,
+				"Status": "failed",
+				"Message": "bad",
+				"Details": {
+					"uid": 0
+				},
+				"Evidence": [
+					{
+						"Name": "stat",
+						"Text": "0777"
+					}
+				]
+			}
+		]
+	}`
+	CheckFileContent(t, pathResult, expectedResult, nil)
+	CheckFileContent(t, "./output/audit.log", "[FAIL] : Script failed by script: bad", nil)
+
+	checkResult = CheckResult{}
+	bigAudit = BigAudit{}
+	deleteOutput()
+}
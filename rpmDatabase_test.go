@@ -0,0 +1,72 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadRpmSqlite(t *testing.T) {
+	headers, err := readRpmSqlite("./testdata/packages/rpmdb.sqlite")
+	assert.Nil(t, err)
+	assert.Len(t, headers, 45)
+	assert.Equal(t, RpmHeader{Name: "bash", Version: "5.1.8", Release: "6.el9", Arch: "x86_64"}, headers[0])
+	assert.Equal(t, "openssh-server", headers[1].Name)
+	assert.Equal(t, "1:2.06-61.el9", rpmFullVersion(headers[3]))
+	assert.Equal(t, "", headers[4].Arch)
+}
+
+func TestReadRpmNdb(t *testing.T) {
+	headers, err := readRpmNdb("./testdata/packages/Packages.db")
+	assert.Nil(t, err)
+	assert.Equal(t, []RpmHeader{
+		{Name: "bash", Version: "5.1.8", Release: "6.el9", Arch: "x86_64"},
+		{Name: "openssh-server", Version: "8.7p1", Release: "34.el9", Arch: "x86_64"},
+		{Name: "tzdata", Version: "2023c", Release: "1.el9", Arch: "noarch"},
+		{Name: "grub2-common", Epoch: 1, Version: "2.06", Release: "61.el9", Arch: "noarch"},
+	}, headers)
+
+	_, err = readRpmNdb("./testdata/packages/rpmdb.sqlite")
+	assert.Equal(t, "rpm: ./testdata/packages/rpmdb.sqlite is not an ndb database", err.Error())
+
+	// a slot pointing to a block without blob
+	content, _ := os.ReadFile("./testdata/packages/Packages.db")
+	content[40] = 0x7f
+	os.Mkdir("./output", 0777)
+	os.WriteFile("./output/Packages.db", content, 0644)
+	_, err = readRpmNdb("./output/Packages.db")
+	assert.Equal(t, "rpm: ./output/Packages.db has a slot pointing outside of the file", err.Error())
+
+	deleteOutput()
+}
+
+func TestParseRpmHeaderErrors(t *testing.T) {
+	_, err := parseRpmHeader([]byte{0, 0, 0, 1})
+	assert.Equal(t, "package header is too short", err.Error())
+	_, err = parseRpmHeader([]byte{0, 0, 0, 9, 0, 0, 0, 0})
+	assert.Equal(t, "package header has an invalid size", err.Error())
+	_, err = parseRpmHeader([]byte{0, 0, 0, 0, 0, 0, 0, 0})
+	assert.Equal(t, "package header has no name", err.Error())
+}
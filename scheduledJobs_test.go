@@ -0,0 +1,172 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadScheduledJobs(t *testing.T) {
+	writeHostFile("etc/crontab", "SHELL=/bin/sh\nPATH = /usr/bin\n# m h dom mon dow user command\n17 *\t* * *\troot    cd / && run-parts --report /etc/cron.hourly\n@reboot root /usr/local/bin/boot.sh  --now\n")
+	writeHostFile("etc/cron.d/backup", "MAILTO=root\n*/5 * * * * backup /usr/bin/backup --quiet\n")
+	writeHostFile("etc/cron.d/backup.dpkg-old", "* * * * * root /bin/false\n")
+	writeHostFile("etc/cron.d/.placeholder", "")
+	writeHostFile("var/spool/cron/crontabs/alice", "# edit with crontab -e\n0 3 * * 1 /home/alice/report.sh > /dev/null 2>&1\n")
+	writeHostFile("etc/anacrontab", "START_HOURS_RANGE=3-22\n1\t5\tcron.daily\t\tnice run-parts /etc/cron.daily\n@monthly 45 cron.monthly nice run-parts /etc/cron.monthly\n")
+	writeHostFile("etc/cron.daily/logrotate", "#!/bin/sh\n")
+	writeHostFile("etc/cron.daily/old.bak", "#!/bin/sh\n")
+	writeHostFile("usr/lib/systemd/system/fstrim.timer", "[Timer]\nOnCalendar=weekly\nPersistent=true\n")
+	writeHostFile("usr/lib/systemd/system/fstrim.service", "[Service]\nExecStart=/sbin/fstrim --listed-in /etc/fstab\n")
+	writeHostFile("usr/lib/systemd/system/cleanup.timer", "[Timer]\nOnBootSec=15min\nOnUnitActiveSec=1d\nUnit=tmp-cleanup.service\n")
+	writeHostFile("usr/lib/systemd/system/tmp-cleanup.service", "[Service]\nUser=nobody\nExecStart=/usr/bin/cleanup\n")
+	os.Chmod("./output/host/etc/cron.daily/logrotate", 0755)
+	os.MkdirAll("./output/host/etc/systemd/system/timers.target.wants", 0755)
+	os.Symlink("/usr/lib/systemd/system/fstrim.timer", "./output/host/etc/systemd/system/timers.target.wants/fstrim.timer")
+	hostRoot = "./output/host"
+
+	jobs, err := readScheduledJobs()
+	assert.Nil(t, err)
+	assert.Len(t, jobs, 9)
+	for i := range jobs {
+		assert.NotNil(t, jobs[i].FileStat)
+		jobs[i].FileStat = nil
+	}
+	assert.Equal(t, []ScheduledJob{
+		{Source: "crontab", Schedule: "17 * * * *", Command: "cd / && run-parts --report /etc/cron.hourly", User: "root", Enabled: true, File: "/etc/crontab", Line: 4},
+		{Source: "crontab", Schedule: "@reboot", Command: "/usr/local/bin/boot.sh  --now", User: "root", Enabled: true, File: "/etc/crontab", Line: 5},
+		{Source: "cron.d", Schedule: "*/5 * * * *", Command: "/usr/bin/backup --quiet", User: "backup", Enabled: true, File: "/etc/cron.d/backup", Line: 2},
+		{Source: "spool", Schedule: "0 3 * * 1", Command: "/home/alice/report.sh > /dev/null 2>&1", User: "alice", Enabled: true, File: "/var/spool/cron/crontabs/alice", Line: 2},
+		{Source: "anacrontab", Schedule: "1", Command: "nice run-parts /etc/cron.daily", User: "root", Enabled: true, File: "/etc/anacrontab", Line: 2},
+		{Source: "anacrontab", Schedule: "@monthly", Command: "nice run-parts /etc/cron.monthly", User: "root", Enabled: true, File: "/etc/anacrontab", Line: 3},
+		{Source: "cron.daily", Schedule: "@daily", Command: "/etc/cron.daily/logrotate", User: "root", Enabled: true, File: "/etc/cron.daily/logrotate"},
+		{Source: "timer", Schedule: "OnBootSec=15min; OnUnitActiveSec=1d", Command: "/usr/bin/cleanup", User: "nobody", File: "/usr/lib/systemd/system/cleanup.timer"},
+		{Source: "timer", Schedule: "OnCalendar=weekly", Command: "/sbin/fstrim --listed-in /etc/fstab", User: "root", Enabled: true, File: "/usr/lib/systemd/system/fstrim.timer"},
+	}, jobs)
+
+	writeHostFile("etc/cron.d/broken", "* * * * * root\n")
+	_, err = readScheduledJobs()
+	assert.Equal(t, "cron: /etc/cron.d/broken line 1: missing command", err.Error())
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestCronDFilesDebian(t *testing.T) {
+	writeHostFile("etc/cron.d/backup", "* * * * * root /usr/bin/backup\n")
+	writeHostFile("etc/cron.d/sysstat.conf", "* * * * * root /usr/lib/sysstat/sa1\n")
+	writeHostFile("etc/cron.d/job.bak", "* * * * * root /bin/false\n")
+	writeHostFile("etc/cron.d/.placeholder", "")
+	hostRoot = "./output/host"
+
+	// cronie reads every name that is not hidden, a backup or a file of the package manager
+	assert.Equal(t, []string{"/etc/cron.d/backup", "/etc/cron.d/job.bak", "/etc/cron.d/sysstat.conf"}, cronDFiles())
+
+	writeHostFile("etc/debian_version", "12.4\n")
+	assert.Equal(t, []string{"/etc/cron.d/backup"}, cronDFiles())
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestTimerJobsVendorLinks(t *testing.T) {
+	writeHostFile("usr/lib/systemd/system/fstrim.timer", "[Timer]\nOnCalendar=weekly\n\n[Install]\nWantedBy=timers.target\n")
+	writeHostFile("usr/lib/systemd/system/fstrim.service", "[Service]\nExecStart=/sbin/fstrim --all\n")
+	os.MkdirAll("./output/host/usr/lib/systemd/system/timers.target.wants", 0755)
+	os.Symlink("../fstrim.timer", "./output/host/usr/lib/systemd/system/timers.target.wants/fstrim.timer")
+	hostRoot = "./output/host"
+
+	jobs, err := timerJobs()
+	assert.Nil(t, err)
+	assert.Len(t, jobs, 1)
+	assert.False(t, jobs[0].Enabled)
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestScheduledJobFileStat(t *testing.T) {
+	writeHostFile("etc/cron.d/insecure", "* * * * * root /usr/bin/true\n")
+	os.Chmod("./output/host/etc/cron.d/insecure", 0666)
+	hostRoot = "./output/host"
+
+	command := "scheduledJobs().filter(function (j) { return j.fileStat.mode != '0644' && j.fileStat.mode != '0600' }).map(function (j) { return j.file }).join()"
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "Cron", Command: command}))
+	assert.Equal(t, "/etc/cron.d/insecure", output)
+
+	hostRoot = "/"
+	dontSaveArtefact = false
+	deleteOutput()
+}
+
+func TestReadScheduledJobFiles(t *testing.T) {
+	writeHostFile("etc/crontab", "")
+	writeHostFile("etc/cron.d/empty", "")
+	writeHostFile("etc/cron.d/job.bak", "* * * * * root /bin/false\n")
+	writeHostFile("etc/cron.daily/logrotate", "#!/bin/sh\n")
+	writeHostFile("etc/cron.allow", "# users that may use crontab\nroot\n\n  alice\n")
+	writeHostFile("var/spool/cron/crontabs/alice", "")
+	os.Chmod("./output/host/etc/crontab", 0600)
+	os.Chmod("./output/host/etc/cron.d", 0700)
+	os.Chmod("./output/host/etc/cron.d/empty", 0666)
+	hostRoot = "./output/host"
+
+	files := readScheduledJobFiles()
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	assert.Equal(t, []string{"/etc/crontab", "/etc/cron.d", "/etc/cron.d/empty", "/etc/cron.d/job.bak", "/etc/cron.hourly", "/etc/cron.daily", "/etc/cron.daily/logrotate",
+		"/etc/cron.weekly", "/etc/cron.monthly", "/var/spool/cron/crontabs", "/var/spool/cron/crontabs/alice", "/var/spool/cron", "/etc/anacrontab", "/etc/cron.allow", "/etc/cron.deny"}, paths)
+
+	assert.True(t, files[0].Exists)
+	assert.Equal(t, "0600", files[0].FileStat["mode"])
+	assert.True(t, files[1].Directory)
+	assert.Equal(t, "0700", files[1].FileStat["mode"])
+	assert.Equal(t, "cron.d", files[2].Source)
+	assert.Equal(t, "0666", files[2].FileStat["mode"])
+	assert.False(t, files[4].Exists)
+	assert.Nil(t, files[4].FileStat)
+	assert.Nil(t, files[0].Users)
+
+	assert.Equal(t, ScheduledJobFile{Path: "/etc/cron.allow", Source: "cron.allow", Exists: true, FileStat: files[13].FileStat, Users: []string{"root", "alice"}}, files[13])
+	assert.Equal(t, ScheduledJobFile{Path: "/etc/cron.deny", Source: "cron.deny", Users: []string{}}, files[14])
+
+	command := "scheduledJobFiles().filter(function (f) { return f.exists && f.fileStat.mode == '0666' }).map(function (f) { return f.path }).join() + ' ' + scheduledJobFiles().filter(function (f) { return f.source == 'cron.allow' })[0].users.join()"
+	assert.Nil(t, runCheckInNewRuntime(BigAudit{Name: "CronFiles", Command: command}))
+	assert.Equal(t, "/etc/cron.d/empty root,alice", output)
+
+	hostRoot = "/"
+	dontSaveArtefact = false
+	deleteOutput()
+}
+
+func TestSplitCronLine(t *testing.T) {
+	fields, command := splitCronLine("0  1 * * *\tuser  echo  'a  b'", 6)
+	assert.Equal(t, []string{"0", "1", "*", "*", "*", "user"}, fields)
+	assert.Equal(t, "echo  'a  b'", command)
+	fields, command = splitCronLine("@daily", 2)
+	assert.Equal(t, []string{"@daily"}, fields)
+	assert.Equal(t, "", command)
+}
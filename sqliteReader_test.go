@@ -0,0 +1,134 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadSqliteTable(t *testing.T) {
+	database, err := openSqliteDatabase("./testdata/packages/rpmdb.sqlite")
+	assert.Nil(t, err)
+	assert.Equal(t, 1024, database.PageSize)
+
+	// 45 rows do not fit on one page, one of them needs overflow pages
+	rows, err := readSqliteTable(database, "Packages")
+	assert.Nil(t, err)
+	assert.Len(t, rows, 45)
+	assert.Nil(t, rows[0][0])
+	assert.Greater(t, len(rows[1][1].([]byte)), 3000)
+
+	rows, err = readSqliteTable(database, "Name")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"bash", int64(1), int64(0)}, rows[0])
+
+	_, err = readSqliteTable(database, "Missing")
+	assert.Equal(t, "sqlite: ./testdata/packages/rpmdb.sqlite has no table Missing", err.Error())
+}
+
+func TestReadSqliteWal(t *testing.T) {
+	database, err := openSqliteDatabase("./testdata/packages/rpmdb-wal.sqlite")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, database.WalPages)
+
+	rows, err := readSqliteTable(database, "Name")
+	assert.Nil(t, err)
+	var names []interface{}
+	for _, row := range rows {
+		names = append(names, row[0])
+	}
+	assert.Equal(t, []interface{}{"bash", "openssh-server", "tzdata", "kernel"}, names)
+
+	rows, _ = readSqliteTable(database, "Packages")
+	assert.Len(t, rows, 3)
+}
+
+func TestReadSqliteWalChecksum(t *testing.T) {
+	wal, err := ioutil.ReadFile("./testdata/packages/rpmdb-wal.sqlite-wal")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, readSqliteWal(wal, 1024))
+
+	// a frame of an earlier checkpoint has the same salt but does not continue the checksum
+	corrupted := append([]byte{}, wal...)
+	corrupted[sqliteWalHeaderSize+sqliteWalFrameHeaderSize+100] ^= 0xff
+	assert.Empty(t, readSqliteWal(corrupted, 1024))
+
+	corrupted = append([]byte{}, wal...)
+	corrupted[24] ^= 0xff
+	assert.Empty(t, readSqliteWal(corrupted, 1024))
+}
+
+func TestSqliteCellPayloadBounds(t *testing.T) {
+	database := &SqliteDatabase{Path: "test.sqlite", Content: make([]byte, 1024), PageSize: 512, UsableSize: 512}
+	page := make([]byte, 512)
+
+	// payload size larger than any record
+	copy(page[100:], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+	_, err := sqliteCellPayload(database, page, 100)
+	assert.EqualError(t, err, "sqlite: test.sqlite has an invalid cell")
+
+	// varint cut off at the end of the page
+	page[511] = 0x80
+	_, err = sqliteCellPayload(database, page, 511)
+	assert.EqualError(t, err, "sqlite: test.sqlite has an invalid cell")
+
+	copy(page[400:], []byte{0x83, 0x10, 0x01})
+	_, err = sqliteCellPayload(database, page, 400)
+	assert.EqualError(t, err, "sqlite: test.sqlite has a cell larger than its page")
+
+	// overflow payload that needs more pages than the file has
+	copy(page[200:], []byte{0x84, 0x80, 0x80, 0x00, 0x01})
+	_, err = sqliteCellPayload(database, page, 200)
+	assert.EqualError(t, err, "sqlite: test.sqlite has a broken overflow chain")
+}
+
+func TestOpenSqliteDatabaseErrors(t *testing.T) {
+	_, err := openSqliteDatabase("./testdata/packages/dpkg-status")
+	assert.Equal(t, "sqlite: ./testdata/packages/dpkg-status is not a SQLite 3 database", err.Error())
+	_, err = openSqliteDatabase("./testdata/packages/missing")
+	assert.Equal(t, "sqlite: cannot read ./testdata/packages/missing", err.Error())
+}
+
+func TestDecodeSqliteRecord(t *testing.T) {
+	// header of 7 bytes: NULL, int8, int16, constant 1, text of 2, blob of 1
+	record := []byte{7, 0, 1, 2, 9, 17, 14, 0xff, 0x01, 0x00, 'h', 'i', 0x42}
+	values, err := decodeSqliteRecord(record)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{nil, int64(-1), int64(256), int64(1), "hi", []byte{0x42}}, values)
+
+	_, err = decodeSqliteRecord([]byte{3, 1, 1})
+	assert.Equal(t, "record is shorter than its header", err.Error())
+
+	value, length := sqliteVarint([]byte{0x81, 0x00})
+	assert.Equal(t, uint64(128), value)
+	assert.Equal(t, 2, length)
+}
+
+func TestDecodeSqliteRecordCorrupt(t *testing.T) {
+	_, err := decodeSqliteRecord([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+	assert.EqualError(t, err, "invalid record")
+	_, err = decodeSqliteRecord([]byte{10, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 'x'})
+	assert.EqualError(t, err, "record is shorter than its header")
+}
@@ -0,0 +1,177 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testSshdConfig = `# first value wins
+Port 2222
+Port=2200
+PermitRootLogin no
+permitrootlogin yes
+ChallengeResponseAuthentication no
+AllowUsers alice bob
+AllowUsers carol
+Banner "/etc/issue net"
+Include sshd_config.d/*.conf
+PasswordAuthentication no # trailing comment
+
+Match User admin,!root Address 10.0.0.0/8
+	PermitRootLogin prohibit-password
+	X11Forwarding yes
+	Include /etc/ssh/match.d/*.conf
+
+Match Group sftp
+	ForceCommand internal-sftp
+	X11Forwarding no
+	PasswordAuthentication yes
+
+Match all
+	MaxSessions 2
+`
+
+func writeSshdFixture() {
+	writeHostFile("etc/ssh/sshd_config", testSshdConfig)
+	writeHostFile("etc/ssh/sshd_config.d/10-hardening.conf", "PasswordAuthentication yes\nMaxAuthTries 3\nMatch User backup\n\tAllowTcpForwarding no\n")
+	writeHostFile("etc/ssh/sshd_config.d/20-late.conf", "MaxAuthTries 5\nLogLevel VERBOSE\n")
+	writeHostFile("etc/ssh/match.d/admin.conf", "PermitTunnel yes\n")
+	hostRoot = "./output/host"
+}
+
+func TestSshdConfigGlobal(t *testing.T) {
+	writeSshdFixture()
+
+	config, err := SshdConfig("/etc/ssh/sshd_config", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2222", "2200"}, config["port"])
+	assert.Equal(t, "no", config["permitrootlogin"])
+	assert.Equal(t, "no", config["kbdinteractiveauthentication"])
+	assert.Equal(t, []string{"alice", "bob", "carol"}, config["allowusers"])
+	assert.Equal(t, "/etc/issue net", config["banner"])
+	// the included file comes before the line in sshd_config
+	assert.Equal(t, "yes", config["passwordauthentication"])
+	assert.Equal(t, "3", config["maxauthtries"])
+	assert.Equal(t, "VERBOSE", config["loglevel"])
+	assert.Equal(t, "10", config["maxsessions"])
+	assert.Equal(t, "no", config["x11forwarding"])
+	assert.Equal(t, []string{"0.0.0.0", "::"}, config["listenaddress"])
+	assert.Equal(t, "yes", config["allowtcpforwarding"])
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestSshdConfigMatch(t *testing.T) {
+	writeSshdFixture()
+
+	config, err := SshdConfig("/etc/ssh/sshd_config", map[string]interface{}{"user": "admin", "groups": []interface{}{"wheel"}, "address": "10.1.2.3"})
+	assert.Nil(t, err)
+	assert.Equal(t, "prohibit-password", config["permitrootlogin"])
+	assert.Equal(t, "yes", config["x11forwarding"])
+	assert.Equal(t, "yes", config["permittunnel"])
+	assert.Equal(t, "2", config["maxsessions"])
+	assert.Nil(t, config["forcecommand"])
+
+	config, err = SshdConfig("/etc/ssh/sshd_config", map[string]interface{}{"user": "admin", "groups": []interface{}{"sftp"}, "address": "192.168.1.1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "no", config["permitrootlogin"])
+	assert.Equal(t, "internal-sftp", config["forcecommand"])
+	assert.Equal(t, "no", config["x11forwarding"])
+	assert.Equal(t, "yes", config["passwordauthentication"])
+
+	config, err = SshdConfig("/etc/ssh/sshd_config", map[string]interface{}{"user": "backup", "groups": []interface{}{}})
+	assert.Nil(t, err)
+	assert.Equal(t, "no", config["allowtcpforwarding"])
+
+	// a missing address never matches
+	config, err = SshdConfig("/etc/ssh/sshd_config", map[string]interface{}{"user": "admin", "groups": []interface{}{}})
+	assert.Nil(t, err)
+	assert.Equal(t, "no", config["permitrootlogin"])
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestSshdConfigErrors(t *testing.T) {
+	writeHostFile("etc/ssh/sshd_config", "Include loop.conf\n")
+	writeHostFile("etc/ssh/loop.conf", "Include loop.conf\n")
+	hostRoot = "./output/host"
+
+	_, err := SshdConfig("/etc/ssh/sshd_config", nil)
+	assert.Contains(t, err.Error(), "too many nested includes")
+
+	writeHostFile("etc/ssh/sshd_config", "Match Foo bar\n\tX11Forwarding yes\n")
+	_, err = SshdConfig("/etc/ssh/sshd_config", map[string]interface{}{"user": "admin"})
+	assert.Contains(t, err.Error(), "line 1: unsupported Match criterion Foo")
+
+	writeHostFile("etc/ssh/sshd_config", "Banner \"/etc/issue\n")
+	_, err = SshdConfig("/etc/ssh/sshd_config", nil)
+	assert.Contains(t, err.Error(), "line 1: unterminated quote")
+
+	_, err = SshdConfig("/etc/ssh/missing", nil)
+	assert.NotNil(t, err)
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestSshdConfigMatchNegatedGroup(t *testing.T) {
+	writeHostFile("etc/ssh/sshd_config", "PasswordAuthentication no\nMatch Group !wheel,*\n\tPasswordAuthentication yes\n")
+	hostRoot = "./output/host"
+
+	// a group that matches the negated pattern wins over the other groups that match "*"
+	config, err := SshdConfig("/etc/ssh/sshd_config", map[string]interface{}{"user": "admin", "groups": []interface{}{"users", "wheel"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "no", config["passwordauthentication"])
+
+	config, err = SshdConfig("/etc/ssh/sshd_config", map[string]interface{}{"user": "backup", "groups": []interface{}{"users", "backup"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "yes", config["passwordauthentication"])
+
+	config, err = SshdConfig("/etc/ssh/sshd_config", map[string]interface{}{"user": "nobody", "groups": []interface{}{}})
+	assert.Nil(t, err)
+	assert.Equal(t, "no", config["passwordauthentication"])
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestMatchGroupPatternList(t *testing.T) {
+	assert.False(t, matchGroupPatternList([]string{"wheel", "users"}, "!wheel,*"))
+	assert.False(t, matchGroupPatternList([]string{"users", "wheel"}, "*,!wheel"))
+	assert.True(t, matchGroupPatternList([]string{"users", "sftp"}, "!wheel,sftp"))
+	assert.False(t, matchGroupPatternList([]string{"users"}, "!wheel"))
+}
+
+func TestMatchPatternLists(t *testing.T) {
+	assert.True(t, matchPatternList("admin", "adm*,ops", false))
+	assert.False(t, matchPatternList("root", "*,!root", false))
+	assert.True(t, matchPatternList("Web01.Example.com", "web??.example.com", true))
+	assert.False(t, matchPatternList("Admin", "admin", false))
+	assert.True(t, matchAddressList("192.168.1.7", "10.0.0.0/8,192.168.1.*"))
+	assert.False(t, matchAddressList("10.0.0.5", "10.0.0.0/8,!10.0.0.5"))
+	assert.True(t, matchAddressList("2001:db8::1", "2001:db8::/32"))
+}
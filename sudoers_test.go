@@ -0,0 +1,160 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testSudoers = `# sudoers fixture
+Defaults	env_reset
+Defaults	use_pty, logfile="/var/log/sudo.log"
+Defaults	timestamp_timeout=5
+Defaults	env_keep += "LANG LC_ALL"
+Defaults:%wheel	!lecture
+Defaults!SHUTDOWN	!syslog
+Defaults	!visiblepw # inline comment
+
+User_Alias	ADMINS = alice, bob : OPERATORS = carol, ADMINS
+Cmnd_Alias	SHUTDOWN = /sbin/halt, /sbin/reboot
+Host_Alias	WEB = web1, web2
+
+root	ALL=(ALL:ALL) ALL
+%sudo	ALL=(ALL:ALL) ALL
+ADMINS	ALL = (root) NOPASSWD: SHUTDOWN, PASSWD: /usr/bin/systemctl restart nginx
+OPERATORS WEB = (www-data) /usr/bin/tail, \
+	(root : adm) TIMEOUT=60 /usr/bin/journalctl : db1 = NOEXEC: /usr/bin/psql
+#0	ALL = (ALL) NOPASSWD: ALL
+
+@includedir /etc/sudoers.d
+#include sudoers.local
+`
+
+func writeSudoersFixture() {
+	writeHostFile("etc/sudoers", testSudoers)
+	writeHostFile("etc/sudoers.d/10-deploy", "deploy ALL = NOPASSWD: /usr/bin/rsync\nDefaults timestamp_timeout=15\n")
+	writeHostFile("etc/sudoers.d/README.txt", "evil ALL = NOPASSWD: ALL\n")
+	writeHostFile("etc/sudoers.d/20-backup~", "evil ALL = NOPASSWD: ALL\n")
+	writeHostFile("etc/sudoers.local", "backup ALL = (root) sha256:0123abcd /usr/bin/tar, !/usr/bin/su\n")
+	hostRoot = "./output/host"
+}
+
+func TestSudoersDefaults(t *testing.T) {
+	writeSudoersFixture()
+
+	config, err := parseSudoers("/etc/sudoers")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/etc/sudoers", "/etc/sudoers.d/10-deploy", "/etc/sudoers.local"}, config.Files)
+
+	assert.Equal(t, true, config.Settings["use_pty"])
+	assert.Equal(t, "/var/log/sudo.log", config.Settings["logfile"])
+	assert.Equal(t, "15", config.Settings["timestamp_timeout"])
+	assert.Equal(t, "LANG LC_ALL", config.Settings["env_keep"])
+	assert.Equal(t, false, config.Settings["visiblepw"])
+	assert.Nil(t, config.Settings["lecture"])
+
+	lecture := config.Defaults[5]
+	assert.Equal(t, "user", lecture.Scope)
+	assert.Equal(t, []string{"%wheel"}, lecture.Targets)
+	assert.Equal(t, false, lecture.Value)
+	assert.Equal(t, "+=", config.Defaults[4].Operator)
+	syslog := config.Defaults[6]
+	assert.Equal(t, "command", syslog.Scope)
+	assert.Equal(t, []string{"/sbin/halt", "/sbin/reboot"}, syslog.Targets)
+	assert.Equal(t, 7, syslog.Line)
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestSudoersUserSpecs(t *testing.T) {
+	writeSudoersFixture()
+
+	config, err := parseSudoers("/etc/sudoers")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, config.Aliases["user"]["ADMINS"])
+	assert.Len(t, config.UserSpecs, 12)
+
+	root := config.UserSpecs[0]
+	assert.Equal(t, []string{"root"}, root.Users)
+	assert.Equal(t, []string{"ALL"}, root.RunasUsers)
+	assert.Equal(t, []string{"ALL"}, root.RunasGroups)
+	assert.Equal(t, "ALL", root.Command)
+
+	halt := config.UserSpecs[2]
+	assert.Equal(t, []string{"alice", "bob"}, halt.Users)
+	assert.Equal(t, []string{"NOPASSWD"}, halt.Tags)
+	assert.Equal(t, "/sbin/halt", halt.Command)
+	assert.Equal(t, "/sbin/reboot", config.UserSpecs[3].Command)
+	restart := config.UserSpecs[4]
+	assert.Equal(t, []string{"PASSWD"}, restart.Tags)
+	assert.Equal(t, []string{"root"}, restart.RunasUsers)
+	assert.Equal(t, "/usr/bin/systemctl restart nginx", restart.Command)
+
+	tail := config.UserSpecs[5]
+	assert.Equal(t, []string{"carol", "alice", "bob"}, tail.Users)
+	assert.Equal(t, []string{"web1", "web2"}, tail.Hosts)
+	assert.Equal(t, []string{"www-data"}, tail.RunasUsers)
+	assert.Equal(t, []string{}, tail.RunasGroups)
+	journalctl := config.UserSpecs[6]
+	assert.Equal(t, []string{"adm"}, journalctl.RunasGroups)
+	assert.Equal(t, "60", journalctl.Options["TIMEOUT"])
+	assert.Equal(t, 17, journalctl.Line)
+	psql := config.UserSpecs[7]
+	assert.Equal(t, []string{"db1"}, psql.Hosts)
+	assert.Equal(t, []string{}, psql.RunasUsers)
+	assert.Equal(t, []string{"NOEXEC"}, psql.Tags)
+
+	assert.Equal(t, []string{"#0"}, config.UserSpecs[8].Users)
+	assert.Equal(t, "/etc/sudoers.d/10-deploy", config.UserSpecs[9].File)
+	assert.Equal(t, "sha256:0123abcd /usr/bin/tar", config.UserSpecs[10].Command)
+	assert.Equal(t, "!/usr/bin/su", config.UserSpecs[11].Command)
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestSudoersErrors(t *testing.T) {
+	writeHostFile("etc/sudoers", "alice ALL (root) ALL\n")
+	hostRoot = "./output/host"
+	_, err := parseSudoers("/etc/sudoers")
+	assert.Equal(t, `sudoers: /etc/sudoers line 1: expected "=" after the hosts`, err.Error())
+
+	writeHostFile("etc/sudoers", "@include missing\n")
+	_, err = parseSudoers("/etc/sudoers")
+	assert.Equal(t, "sudoers: cannot read /etc/missing", err.Error())
+
+	writeHostFile("etc/sudoers", "Cmnd_Alias lower = /bin/ls\n")
+	_, err = parseSudoers("/etc/sudoers")
+	assert.Contains(t, err.Error(), "invalid alias lower = /bin/ls")
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestExpandSudoersList(t *testing.T) {
+	aliases := map[string][]string{"A": {"x", "!y", "B"}, "B": {"z", "A"}}
+	assert.Equal(t, []string{"x", "!y", "z", "A", "w"}, expandSudoersList([]string{"A", "w"}, aliases))
+	assert.Equal(t, []string{"!x", "y", "!z", "!A"}, expandSudoersList([]string{"!A"}, aliases))
+}
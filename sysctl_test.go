@@ -0,0 +1,120 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeSysctlFixture() {
+	writeHostFile("usr/lib/sysctl.d/10-default.conf", "# defaults\nnet.ipv4.ip_forward = 0\nkernel.randomize_va_space = 1\nnet.ipv4.conf.*.rp_filter = 2\n-net.ipv4.tcp_syncookies=1\n")
+	writeHostFile("usr/lib/sysctl.d/50-masked.conf", "kernel.kptr_restrict = 0\n")
+	writeHostFile("usr/lib/sysctl.d/60-replaced.conf", "kernel.dmesg_restrict = 0\n")
+	writeHostFile("etc/sysctl.d/60-replaced.conf", "; replaced by the admin\nkernel.dmesg_restrict = 1\n")
+	writeHostFile("run/sysctl.d/20-runtime.conf", "net/ipv4/ip_forward = 1\nnet.ipv4.conf.all.rp_filter = 1\nnet.ipv4.tcp_rmem = 4096\t87380   6291456\n")
+	writeHostFile("etc/sysctl.conf", "kernel.randomize_va_space = 2\nbroken line\n")
+	os.MkdirAll("./output/host/etc/sysctl.d", 0755)
+	os.Symlink("/dev/null", "./output/host/etc/sysctl.d/50-masked.conf")
+	writeHostFile("proc/sys/net/ipv4/tcp_rmem", "4096\t131072\t6291456\n")
+	writeHostFile("proc/sys/net/ipv4/conf/eth0.10/forwarding", "1\n")
+	hostRoot = "./output/host"
+}
+
+func TestSysctlPersisted(t *testing.T) {
+	writeSysctlFixture()
+
+	setting, found, err := sysctlPersisted("net.ipv4.ip_forward")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "1", setting.Value)
+	assert.Equal(t, "/run/sysctl.d/20-runtime.conf", setting.File)
+	assert.Equal(t, 1, setting.Line)
+	assert.Equal(t, "/usr/lib/sysctl.d/10-default.conf", setting.Overridden[0].File)
+
+	setting, _, _ = sysctlPersisted("kernel/randomize_va_space")
+	assert.Equal(t, "2", setting.Value)
+	assert.Equal(t, "/etc/sysctl.conf", setting.File)
+
+	setting, _, _ = sysctlPersisted("kernel.dmesg_restrict")
+	assert.Equal(t, "1", setting.Value)
+	assert.Equal(t, "/etc/sysctl.d/60-replaced.conf", setting.File)
+	assert.Len(t, setting.Overridden, 0)
+
+	_, found, _ = sysctlPersisted("kernel.kptr_restrict")
+	assert.False(t, found)
+
+	// explicit settings win over globs also if the glob comes later
+	setting, _, _ = sysctlPersisted("net.ipv4.conf.all.rp_filter")
+	assert.Equal(t, "1", setting.Value)
+	setting, _, _ = sysctlPersisted("net.ipv4.conf.eth0.rp_filter")
+	assert.Equal(t, "2", setting.Value)
+	assert.Equal(t, "net.ipv4.conf.*.rp_filter", setting.Pattern)
+	assert.Equal(t, "net.ipv4.conf.eth0.rp_filter", setting.Key)
+
+	setting, _, _ = sysctlPersisted("net.ipv4.tcp_syncookies")
+	assert.Equal(t, "1", setting.Value)
+	setting, _, _ = sysctlPersisted("net.ipv4.tcp_rmem")
+	assert.Equal(t, "4096 87380 6291456", setting.Value)
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestSysctlRuntime(t *testing.T) {
+	writeSysctlFixture()
+
+	value, err := SysctlRuntime("net.ipv4.tcp_rmem")
+	assert.Nil(t, err)
+	assert.Equal(t, "4096 131072 6291456", value)
+	value, _ = SysctlRuntime("net.ipv4.conf.eth0/10.forwarding")
+	assert.Equal(t, "1", value)
+	value, _ = SysctlRuntime("net/ipv4/conf/eth0.10/forwarding")
+	assert.Equal(t, "1", value)
+	value, err = SysctlRuntime("net.ipv4.missing")
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestSysctlFilesWithLinkedSysctlConf(t *testing.T) {
+	writeHostFile("etc/sysctl.conf", "vm.swappiness = 10\n")
+	os.MkdirAll("./output/host/etc/sysctl.d", 0755)
+	os.Symlink("../sysctl.conf", "./output/host/etc/sysctl.d/99-sysctl.conf")
+	hostRoot = "./output/host"
+
+	assert.Equal(t, []string{"/etc/sysctl.d/99-sysctl.conf"}, sysctlFiles())
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestNormalizeSysctlKey(t *testing.T) {
+	assert.Equal(t, "net.ipv4.ip_forward", normalizeSysctlKey("net/ipv4/ip_forward"))
+	assert.Equal(t, "net.ipv4.conf.eth0/10.forwarding", normalizeSysctlKey("net/ipv4/conf/eth0.10/forwarding"))
+	assert.Equal(t, "net.ipv4.conf.eth0/10.forwarding", normalizeSysctlKey(" net.ipv4.conf.eth0/10.forwarding"))
+	assert.Equal(t, "/proc/sys/net/ipv4/conf/eth0.10/forwarding", sysctlProcPath("net.ipv4.conf.eth0/10.forwarding"))
+}
@@ -0,0 +1,163 @@
+/*
+Copyright (c) 2021 Seculeet
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSystemdUnit(t *testing.T) {
+	writeHostFile("usr/lib/systemd/system/demo.service", "# comment\n[Unit]\nDescription=Demo\n\n[Service]\nExecStart=/usr/bin/demo \\\n\t--verbose\nEnvironment=A=1\nEnvironment=B=2\nUser=demo\n")
+	writeHostFile("usr/lib/systemd/system/demo.service.d/10-vendor.conf", "[Service]\nUser=vendor\n")
+	writeHostFile("usr/lib/systemd/system/demo.service.d/20-reset.conf", "[Service]\nUser=nobody\n")
+	writeHostFile("etc/systemd/system/demo.service.d/10-vendor.conf", "[Service]\nEnvironment=\nEnvironment=C=3\n")
+	writeHostFile("etc/systemd/system/demo.service.d/ignored.txt", "[Service]\nUser=root\n")
+	hostRoot = "./output/host"
+
+	unit, found, err := loadSystemdUnit("demo.service")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.False(t, unit.Masked)
+	assert.Equal(t, "/usr/lib/systemd/system/demo.service", unit.Path)
+	assert.Equal(t, []string{"/etc/systemd/system/demo.service.d/10-vendor.conf", "/usr/lib/systemd/system/demo.service.d/20-reset.conf"}, unit.DropIns)
+	assert.Equal(t, "/usr/bin/demo --verbose", systemdUnitValue(unit, "Service", "ExecStart"))
+	assert.Equal(t, []string{"C=3"}, unit.Sections["Service"]["Environment"])
+	assert.Equal(t, "nobody", systemdUnitValue(unit, "Service", "User"))
+	assert.Equal(t, "", systemdUnitValue(unit, "Install", "WantedBy"))
+
+	os.MkdirAll("./output/host/etc/systemd/system", 0755)
+	os.Symlink("/dev/null", "./output/host/etc/systemd/system/demo.service")
+	unit, found, _ = loadSystemdUnit("demo.service")
+	assert.True(t, found)
+	assert.True(t, unit.Masked)
+
+	_, found, _ = loadSystemdUnit("missing.service")
+	assert.False(t, found)
+	assert.Equal(t, []string{"demo.service"}, listSystemdUnits(".service"))
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestSystemdUnitState(t *testing.T) {
+	writeHostFile("usr/lib/systemd/system/rsyslog.service", "[Service]\nType=notify\nExecStart=/usr/sbin/rsyslogd -n\nRestart=on-failure\n\n[Install]\nWantedBy=multi-user.target\nAlias=syslog.service\n")
+	writeHostFile("usr/lib/systemd/system/syslog.service.d/override.conf", "[Service]\nRestart=always\n")
+	writeHostFile("usr/lib/systemd/system/getty@.service", "[Service]\nExecStart=-/sbin/agetty %I\n\n[Install]\nWantedBy=getty.target\n")
+	writeHostFile("usr/lib/systemd/system/systemd-journald.service", "[Service]\nType=notify\n")
+	writeHostFile("usr/lib/systemd/system/tmp.mount", "[Mount]\nWhat=tmpfs\n\n[Install]\nWantedBy=local-fs.target\n")
+	writeHostFile("usr/lib/systemd/system/cups.service", "[Install]\nAlso=cups.socket\n")
+	os.MkdirAll("./output/host/etc/systemd/system/multi-user.target.wants", 0755)
+	os.Symlink("/usr/lib/systemd/system/rsyslog.service", "./output/host/etc/systemd/system/multi-user.target.wants/rsyslog.service")
+	os.Symlink("/usr/lib/systemd/system/rsyslog.service", "./output/host/etc/systemd/system/syslog.service")
+	hostRoot = "./output/host"
+
+	state, err := systemdUnitState("syslog")
+	assert.Nil(t, err)
+	assert.True(t, state.Found)
+	assert.Equal(t, "rsyslog.service", state.Name)
+	assert.Equal(t, "/usr/lib/systemd/system/rsyslog.service", state.Path)
+	assert.Equal(t, []string{"syslog.service"}, state.Aliases)
+	assert.Equal(t, []string{"/usr/lib/systemd/system/syslog.service.d/override.conf"}, state.DropIns)
+	assert.True(t, state.Enabled)
+	assert.Equal(t, "enabled", state.State)
+	assert.Equal(t, []string{"multi-user.target"}, state.WantedBy)
+	assert.Equal(t, map[string]string{"Type": "notify", "ExecStart": "/usr/sbin/rsyslogd -n", "Restart": "always"}, state.Service)
+
+	state, _ = systemdUnitState("tmp.mount")
+	assert.Equal(t, "disabled", state.State)
+	assert.Empty(t, state.Service)
+	state, _ = systemdUnitState("systemd-journald.service")
+	assert.Equal(t, "static", state.State)
+	state, _ = systemdUnitState("cups")
+	assert.Equal(t, "indirect", state.State)
+	state, _ = systemdUnitState("getty@.service")
+	assert.Equal(t, "disabled", state.State)
+	state, _ = systemdUnitState("missing")
+	assert.False(t, state.Found)
+	assert.Equal(t, "not-found", state.State)
+
+	// masking the unit masks its aliases as well
+	os.Symlink("/dev/null", "./output/host/etc/systemd/system/rsyslog.service")
+	state, _ = systemdUnitState("syslog.service")
+	assert.True(t, state.Masked)
+	assert.False(t, state.Enabled)
+	assert.Equal(t, "masked", state.State)
+	assert.Equal(t, "/etc/systemd/system/rsyslog.service", state.Path)
+
+	os.Symlink("loop-b.service", "./output/host/etc/systemd/system/loop-a.service")
+	os.Symlink("loop-a.service", "./output/host/etc/systemd/system/loop-b.service")
+	_, err = systemdUnitState("loop-a")
+	assert.Equal(t, "systemd: too many aliases for loop-a.service", err.Error())
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestSystemdUnitStateEnablement(t *testing.T) {
+	writeHostFile("usr/lib/systemd/system/systemd-journald.service", "[Service]\nType=notify\n")
+	writeHostFile("usr/lib/systemd/system/chronyd.service", "[Service]\nExecStart=/usr/sbin/chronyd\n\n[Install]\nWantedBy=multi-user.target\n")
+	writeHostFile("usr/lib/systemd/system/getty@.service", "[Service]\nExecStart=-/sbin/agetty %I\n\n[Install]\nWantedBy=getty.target\n")
+	writeHostFile("usr/lib/systemd/system/getty@.service.d/10-vendor.conf", "[Service]\nTTYVTDisallocate=no\nRestart=always\n")
+	writeHostFile("etc/systemd/system/getty@tty2.service.d/override.conf", "[Service]\nRestart=no\n")
+	// vendor links in /usr/lib do not enable a unit
+	os.MkdirAll("./output/host/usr/lib/systemd/system/sysinit.target.wants", 0755)
+	os.Symlink("../systemd-journald.service", "./output/host/usr/lib/systemd/system/sysinit.target.wants/systemd-journald.service")
+	os.Symlink("../chronyd.service", "./output/host/usr/lib/systemd/system/sysinit.target.wants/chronyd.service")
+	os.MkdirAll("./output/host/run/systemd/system/multi-user.target.wants", 0755)
+	os.Symlink("/usr/lib/systemd/system/chronyd.service", "./output/host/run/systemd/system/multi-user.target.wants/chronyd.service")
+	os.MkdirAll("./output/host/etc/systemd/system/getty.target.wants", 0755)
+	os.Symlink("/usr/lib/systemd/system/getty@.service", "./output/host/etc/systemd/system/getty.target.wants/getty@tty1.service")
+	hostRoot = "./output/host"
+
+	state, _ := systemdUnitState("systemd-journald.service")
+	assert.False(t, state.Enabled)
+	assert.Equal(t, "static", state.State)
+	state, _ = systemdUnitState("chronyd")
+	assert.True(t, state.Enabled)
+	assert.Equal(t, "enabled-runtime", state.State)
+
+	state, err := systemdUnitState("getty@tty1.service")
+	assert.Nil(t, err)
+	assert.True(t, state.Found)
+	assert.Equal(t, "getty@tty1.service", state.Name)
+	assert.Equal(t, "/usr/lib/systemd/system/getty@.service", state.Path)
+	assert.Equal(t, "enabled", state.State)
+	assert.Equal(t, "always", state.Service["Restart"])
+	state, _ = systemdUnitState("getty@tty2.service")
+	assert.Equal(t, "disabled", state.State)
+	assert.Equal(t, "no", state.Service["Restart"])
+	assert.Equal(t, []string{"/usr/lib/systemd/system/getty@.service.d/10-vendor.conf", "/etc/systemd/system/getty@tty2.service.d/override.conf"}, state.DropIns)
+
+	hostRoot = "/"
+	deleteOutput()
+}
+
+func TestSystemdTemplateName(t *testing.T) {
+	assert.Equal(t, "getty@.service", systemdTemplateName("getty@tty1.service"))
+	assert.Equal(t, "", systemdTemplateName("getty@.service"))
+	assert.Equal(t, "", systemdTemplateName("sshd.service"))
+	assert.Equal(t, "getty@tty3.service", systemdInstanceName("getty@.service", "autovt@tty3.service"))
+	assert.Equal(t, "rsyslog.service", systemdInstanceName("rsyslog.service", "syslog.service"))
+}
@@ -268,6 +268,46 @@ func TestWriteResultJSON(t *testing.T) {
 	deleteOutput()
 }
 
+func TestWriteRunMetadata(t *testing.T) {
+	ConfigName = "./output/config.json"
+	FirstResultEntry = false
+	os.Mkdir("./output", 0777)
+	runMetadata = RunMetadata{}
+
+	WriteResultJSON(BigAudit{Name: "TestName", Command: "TestCommand"}, true, true, "", "", "")
+	WriteRunMetadata()
+	assert.NotContains(t, getResultJSONContent(), "Run Metadata")
+
+	runMetadata.PinnedBinaries = []PinnedBinary{{Command: "grep", Path: "/bin/grep", ResolvedPath: "/usr/bin/grep", Sha256: "abc", VerifiedBy: "SHA-256"}}
+	WriteRunMetadata()
+
+	expectedResult := `{
+		"./output/config.json": [
+			{
+				"Name": "TestName",
+				"Command": "TestCommand",
+				"Command was executed": true,
+				"Output is as expected": true
+			}
+		],
+		"Run Metadata": {
+			"Pinned Binaries": [
+				{
+					"Command": "grep",
+					"Path": "/bin/grep",
+					"Resolved Path": "/usr/bin/grep",
+					"SHA-256": "abc",
+					"Verified by": "SHA-256"
+				}
+			]
+		}
+	}`
+	CheckFileContent(t, pathResult, expectedResult, nil)
+
+	runMetadata = RunMetadata{}
+	deleteOutput()
+}
+
 func TestWriteCommandSuccessLog(t *testing.T) {
 	expected := []string{"[INFO] : Name: TestName",
 		"TestName: TestCommand executed",